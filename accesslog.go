@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Formats for -web.access-log.
+const (
+	accessLogCommon = "common"
+	accessLogJSON   = "json"
+)
+
+// accessLogEntry is a request to the exporter, as logged in the JSON format.
+type accessLogEntry struct {
+	Time            time.Time `json:"time"`
+	RemoteAddr      string    `json:"remote_addr"`
+	Method          string    `json:"method"`
+	Path            string    `json:"path"`
+	Status          int       `json:"status"`
+	Bytes           int       `json:"bytes"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	UserAgent       string    `json:"user_agent"`
+}
+
+// accessLogHandler logs each request to next to w once it's been served, in the common log format
+// with the duration in seconds on the end, or as a line of JSON, so that who is scraping can be
+// audited, and scrapes which Prometheus reports as failing can be found.
+func accessLogHandler(format string, w io.Writer, next http.Handler) http.Handler {
+	var mu sync.Mutex // so that concurrent requests don't interleave their lines
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &accessLogRecorder{ResponseWriter: rw, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r)
+
+		entry := accessLogEntry{
+			Time:            start,
+			RemoteAddr:      clientIP(r),
+			Method:          r.Method,
+			Path:            r.URL.Path,
+			Status:          recorder.status,
+			Bytes:           recorder.bytes,
+			DurationSeconds: time.Since(start).Seconds(),
+			UserAgent:       r.UserAgent(),
+		}
+
+		if entry.RemoteAddr == "" || entry.RemoteAddr == "@" {
+			entry.RemoteAddr = "-" // a Unix domain socket
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if format == accessLogJSON {
+			_ = json.NewEncoder(w).Encode(entry)
+			return
+		}
+
+		fmt.Fprintf(w, "%s - - [%s] %q %d %d %.3f\n", entry.RemoteAddr, start.Format("02/Jan/2006:15:04:05 -0700"),
+			r.Method+" "+r.URL.RequestURI()+" "+r.Proto, entry.Status, entry.Bytes, entry.DurationSeconds)
+	})
+}
+
+// accessLogRecorder records the status and size of a response for the access log.
+type accessLogRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *accessLogRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *accessLogRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+
+	return n, err
+}
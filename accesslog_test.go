@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestAccessLogIsWritten(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("not ready"))
+	})
+
+	var out bytes.Buffer
+	req := httptest.NewRequest("GET", "/readyz?verbose=1", nil)
+	req.RemoteAddr = "192.0.2.10:51234"
+
+	accessLogHandler(accessLogCommon, &out, next).ServeHTTP(httptest.NewRecorder(), req)
+
+	common := regexp.MustCompile(`^192\.0\.2\.10 - - \[[^\]]+\] "GET /readyz\?verbose=1 HTTP/1\.1" 503 9 \d+\.\d{3}\n$`)
+	if !common.MatchString(out.String()) {
+		t.Errorf("Unexpected common log line %q", out.String())
+	}
+
+	out.Reset()
+	req.Header.Set("User-Agent", "Prometheus/2.22.0")
+
+	accessLogHandler(accessLogJSON, &out, next).ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry accessLogEntry
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.RemoteAddr != "192.0.2.10" || entry.Method != "GET" || entry.Path != "/readyz" || entry.Status != 503 || entry.UserAgent != "Prometheus/2.22.0" {
+		t.Errorf("Unexpected JSON log entry %+v", entry)
+	}
+}
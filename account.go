@@ -0,0 +1,100 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// accountCollector exports the plan of a Docker Hub account, and its seats if it's an
+// organization, from the Hub API. Pull limits differ so much by plan, 200 pulls for a free
+// account and 5000 or more for the paid ones, that alert thresholds can be set from the plan
+// rather than hard-coded. The Hub API needs credentials, and only tells members of the account.
+type accountCollector struct {
+	api     *hubAPI
+	account string
+
+	mu sync.Mutex // polls one at a time
+
+	up, info, seats, seatsUsed *prometheus.Desc
+}
+
+// accountSubscription is the part of the Hub billing API's subscription response which is
+// exported.
+type accountSubscription struct {
+	Tier     string  `json:"tier"`
+	Quantity float64 `json:"quantity"` // seats, for an organization
+}
+
+func newAccountCollector(api *hubAPI, account string) *accountCollector {
+	return &accountCollector{
+		api:     api,
+		account: account,
+
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "account", "up"),
+			"Whether the last poll of the account's plan from the Hub API succeeded (1) or not (0).",
+			[]string{"account"}, nil),
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "account", "info"),
+			"The Docker Hub plan of the account, eg free, pro, team or business.",
+			[]string{"account", "plan"}, nil),
+		seats: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "account", "seats"),
+			"Number of seats the organization has bought.",
+			[]string{"account"}, nil),
+		seatsUsed: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "account", "seats_used"),
+			"Number of members of the organization.",
+			[]string{"account"}, nil),
+	}
+}
+
+// Describe describes the account metrics. It implements prometheus.Collector.
+func (a *accountCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- a.up
+	ch <- a.info
+	ch <- a.seats
+	ch <- a.seatsUsed
+}
+
+// Collect polls the Hub API and delivers the account metrics. It implements prometheus.Collector.
+func (a *accountCollector) Collect(ch chan<- prometheus.Metric) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var subscription accountSubscription
+
+	if err := a.api.get(a.billingURL(), &subscription); err != nil {
+		fmt.Printf("Unable to poll the plan of %s: %v\n", a.account, err)
+		ch <- prometheus.MustNewConstMetric(a.up, prometheus.GaugeValue, 0, a.account)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(a.up, prometheus.GaugeValue, 1, a.account)
+	ch <- prometheus.MustNewConstMetric(a.info, prometheus.GaugeValue, 1, a.account, strings.ToLower(subscription.Tier))
+
+	var members struct {
+		Count float64 `json:"count"`
+	}
+
+	// Personal accounts have neither seats nor members, so that isn't a failure to poll
+	if err := a.api.get(a.api.url+"/orgs/"+url.PathEscape(a.account)+"/members?page_size=1", &members); err != nil {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(a.seats, prometheus.GaugeValue, subscription.Quantity, a.account)
+	ch <- prometheus.MustNewConstMetric(a.seatsUsed, prometheus.GaugeValue, members.Count, a.account)
+}
+
+// billingURL returns the URL of the account's subscription, which the Hub's billing API has
+// outside of its /v2 API.
+func (a *accountCollector) billingURL() string {
+	return strings.TrimSuffix(a.api.url, "/v2") + "/api/billing/v4/accounts/" + url.PathEscape(a.account) + "/subscription"
+}
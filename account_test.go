@@ -0,0 +1,70 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAccountPlanAndSeatsAreExported(t *testing.T) {
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/users/login" {
+			w.Write([]byte(`{"token": "hub-jwt"}`))
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer hub-jwt" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/api/billing/v4/accounts/myorg/subscription":
+			w.Write([]byte(`{"tier": "Team", "quantity": 10}`))
+		case "/v2/orgs/myorg/members":
+			w.Write([]byte(`{"count": 7, "results": [{"username": "jabley"}]}`))
+		case "/api/billing/v4/accounts/jabley/subscription":
+			w.Write([]byte(`{"tier": "pro", "quantity": 1}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer hub.Close()
+
+	api := newHubAPI(hub.URL+"/v2", &credentials{"jabley", "dckr_pat_secret"}, nil)
+
+	expected := `
+# HELP dockerhub_account_info The Docker Hub plan of the account, eg free, pro, team or business.
+# TYPE dockerhub_account_info gauge
+dockerhub_account_info{account="myorg",plan="team"} 1
+# HELP dockerhub_account_seats Number of seats the organization has bought.
+# TYPE dockerhub_account_seats gauge
+dockerhub_account_seats{account="myorg"} 10
+# HELP dockerhub_account_seats_used Number of members of the organization.
+# TYPE dockerhub_account_seats_used gauge
+dockerhub_account_seats_used{account="myorg"} 7
+`
+
+	if err := testutil.CollectAndCompare(newAccountCollector(api, "myorg"), strings.NewReader(expected),
+		"dockerhub_account_info", "dockerhub_account_seats", "dockerhub_account_seats_used"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A personal account has a plan, but no seats
+	expected = `
+# HELP dockerhub_account_info The Docker Hub plan of the account, eg free, pro, team or business.
+# TYPE dockerhub_account_info gauge
+dockerhub_account_info{account="jabley",plan="pro"} 1
+`
+
+	if err := testutil.CollectAndCompare(newAccountCollector(api, "jabley"), strings.NewReader(expected),
+		"dockerhub_account_info", "dockerhub_account_seats"); err != nil {
+		t.Fatal(err)
+	}
+}
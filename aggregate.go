@@ -0,0 +1,109 @@
+package main
+
+import (
+	"math"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// identityLabels are the labels which could identify an account or the infrastructure that it's
+// used from, and so are left out in aggregation mode.
+var identityLabels = map[string]bool{
+	"repository": true,
+	"source_ip":  true,
+	"username":   true,
+}
+
+// aggregations says how to combine the series of a metric when its identity labels are left out,
+// where summing them wouldn't make sense. The repositories all share the same rate limit, so eg the
+// remaining requests for the group are the fewest seen for any of them, and the requests consumed
+// from it have been seen by all of them.
+var aggregations = map[string]func(a, b float64) float64{
+	namespace + "_pulls_consumed_total":                            math.Max,
+	namespace + "_limit_consumed_requests_total":                   math.Max,
+	namespace + "_limit_remaining_requests_total":                  math.Min,
+	namespace + "_limit_max_requests_total":                        math.Min,
+	namespace + "_limit_min_remaining_requests":                    math.Min,
+	namespace + "_limit_consumed_requests_start_timestamp_seconds": math.Min,
+	namespace + "_limit_consumed_requests_per_second":              math.Max,
+	namespace + "_limit_estimated_exhaustion_timestamp_seconds":    math.Min,
+	namespace + "_exporter_last_scrape_success":                    math.Min,
+	namespace + "_exporter_data_age_seconds":                       math.Max,
+	namespace + "_exporter_probe_cost_requests":                    math.Max,
+	namespace + "_exporter_credentials_misconfigured":              math.Max,
+	namespace + "_ratelimit_source_info":                           math.Max,
+}
+
+// aggregatingGatherer gathers from g, and merges the series which only differ by their identity
+// labels, so that the metrics can be shared outside of the team without giving away which accounts
+// and repositories are behind them. Counters and gauges are combined as aggregations says, or
+// summed, and histograms are summed.
+func aggregatingGatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+
+		for _, mf := range families {
+			aggregateFamily(mf)
+		}
+
+		return families, err
+	})
+}
+
+func aggregateFamily(mf *dto.MetricFamily) {
+	combine, ok := aggregations[mf.GetName()]
+	if !ok {
+		combine = func(a, b float64) float64 { return a + b }
+	}
+
+	var (
+		keys   []string
+		merged = map[string]*dto.Metric{}
+	)
+
+	for _, m := range mf.Metric {
+		var labels []*dto.LabelPair
+		var key strings.Builder
+
+		for _, l := range m.Label {
+			if !identityLabels[l.GetName()] {
+				labels = append(labels, l)
+				key.WriteString(l.GetName() + "=" + l.GetValue() + ",")
+			}
+		}
+
+		m.Label = labels
+
+		into, ok := merged[key.String()]
+		if !ok {
+			merged[key.String()] = m
+			keys = append(keys, key.String())
+			continue
+		}
+
+		switch {
+		case into.Counter != nil:
+			*into.Counter.Value = combine(into.GetCounter().GetValue(), m.GetCounter().GetValue())
+		case into.Gauge != nil:
+			*into.Gauge.Value = combine(into.GetGauge().GetValue(), m.GetGauge().GetValue())
+		case into.Untyped != nil:
+			*into.Untyped.Value = combine(into.GetUntyped().GetValue(), m.GetUntyped().GetValue())
+		case into.Histogram != nil:
+			*into.Histogram.SampleCount += m.GetHistogram().GetSampleCount()
+			*into.Histogram.SampleSum += m.GetHistogram().GetSampleSum()
+
+			for i, b := range into.Histogram.Bucket {
+				*b.CumulativeCount += m.GetHistogram().GetBucket()[i].GetCumulativeCount()
+			}
+		}
+	}
+
+	mf.Metric = mf.Metric[:0]
+	for _, key := range keys {
+		mf.Metric = append(mf.Metric, merged[key])
+	}
+
+	sortMetrics(mf.Metric)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestIdentityLabelsAreAggregatedAway(t *testing.T) {
+	e := NewExporter("http://localhost:0", "http://localhost:0", nil, nil)
+	e.remaining.WithLabelValues("library/alpine").Set(76)
+	e.remaining.WithLabelValues("library/redis").Set(70)
+	e.dataAge.WithLabelValues("library/alpine").Set(10)
+	e.dataAge.WithLabelValues("library/redis").Set(30)
+	e.consumed.WithLabelValues("library/alpine", hoursBusiness).Add(5)
+	e.consumed.WithLabelValues("library/redis", hoursBusiness).Add(3)
+	e.consumed.WithLabelValues("library/redis", hoursOff).Add(1)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(e)
+
+	expected := `
+# HELP dockerhub_exporter_data_age_seconds Seconds since the exported Docker Hub rate limits were last successfully polled.
+# TYPE dockerhub_exporter_data_age_seconds gauge
+dockerhub_exporter_data_age_seconds 30
+# HELP dockerhub_limit_consumed_requests_total Docker Hub requests seen to be consumed from the rate limit, during business or off hours
+# TYPE dockerhub_limit_consumed_requests_total counter
+dockerhub_limit_consumed_requests_total{hours="business"} 5
+dockerhub_limit_consumed_requests_total{hours="off"} 1
+# HELP dockerhub_limit_remaining_requests_total Docker Hub Rate Limit Remaining Requests
+# TYPE dockerhub_limit_remaining_requests_total gauge
+dockerhub_limit_remaining_requests_total 70
+`
+
+	if err := testutil.GatherAndCompare(aggregatingGatherer(registry), strings.NewReader(expected),
+		"dockerhub_exporter_data_age_seconds", "dockerhub_limit_consumed_requests_total", "dockerhub_limit_remaining_requests_total"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Payload formats for the alert webhook
+const (
+	alertFormatJSON  = "json"
+	alertFormatSlack = "slack"
+)
+
+// How bad the remaining requests are, from an alerting point of view.
+const (
+	alertLevelOK = iota
+	alertLevelLow
+	alertLevelExhausted
+)
+
+// alerter POSTs to a webhook, and tells syslog, when the remaining requests for a target fall below
+// a threshold, and again when they run out, for people who don't run Alertmanager. It alerts when things get worse
+// rather than on every poll, and is reset once the remaining requests recover.
+type alerter struct {
+	url       string // or "" not to POST the alerts anywhere
+	format    string
+	threshold float64
+	events    *syslogWriter // also told about alerts, if it isn't nil
+	bus       *eventBus     // told about every change of alert level, including recoveries
+	client    *http.Client
+
+	failures prometheus.Counter
+}
+
+func newAlerter(url string, format string, threshold float64, client *http.Client) *alerter {
+	return &alerter{
+		url:       url,
+		format:    format,
+		threshold: threshold,
+		client:    client,
+
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exporter_alert_failures_total",
+			Help:      "Number of errors while sending alerts to the webhook.",
+		}),
+	}
+}
+
+// alert is the JSON payload sent to the webhook.
+type alert struct {
+	Repository string    `json:"repository"`
+	Limit      float64   `json:"limit"`
+	Remaining  float64   `json:"remaining"`
+	Threshold  float64   `json:"threshold"`
+	Exhausted  bool      `json:"exhausted"`
+	Time       time.Time `json:"time"`
+}
+
+func (a alert) String() string {
+	if a.Exhausted {
+		return fmt.Sprintf("%s has no Docker Hub pulls remaining, out of a limit of %v", a.Repository, a.Limit)
+	}
+
+	return fmt.Sprintf("%s has %v of %v Docker Hub pulls remaining, below the alert threshold of %v", a.Repository, a.Remaining, a.Limit, a.Threshold)
+}
+
+// observe sends an alert if remaining is worse than when t was last polled. The alert is sent in
+// the background, so that a slow webhook doesn't hold up the scrape. During maintenance, nothing
+// gets worse, so the alert is sent afterwards if things still are bad, but recoveries still count.
+func (a *alerter) observe(t *target, now time.Time, limit float64, remaining float64, maintenance bool) {
+	level := alertLevelOK
+
+	switch {
+	case remaining <= 0:
+		level = alertLevelExhausted
+	case remaining < a.threshold:
+		level = alertLevelLow
+	}
+
+	if maintenance && level > t.alertLevel {
+		return
+	}
+
+	if level != t.alertLevel {
+		a.bus.publishAlertTransition(t, now, level, limit, remaining, a.threshold)
+	}
+
+	if level > t.alertLevel {
+		al := alert{
+			Repository: t.repository,
+			Limit:      limit,
+			Remaining:  remaining,
+			Threshold:  a.threshold,
+			Exhausted:  level == alertLevelExhausted,
+			Time:       now,
+		}
+
+		severity := severityWarning
+		if al.Exhausted {
+			severity = severityError
+		}
+
+		a.events.event(severity, eventAlert, al.String(), "repository", al.Repository,
+			"limit", fmt.Sprint(al.Limit), "remaining", fmt.Sprint(al.Remaining), "threshold", fmt.Sprint(al.Threshold))
+
+		if a.url != "" {
+			go a.send(al)
+		}
+	}
+
+	t.alertLevel = level
+}
+
+func (a *alerter) send(al alert) {
+	if err := a.post(al); err != nil {
+		fmt.Printf("Unable to send alert: %+v\n", err)
+		a.failures.Inc()
+	}
+}
+
+func (a *alerter) post(al alert) error {
+	var payload interface{} = al
+
+	if a.format == alertFormatSlack {
+		payload = map[string]string{"text": al.String()}
+	}
+
+	body, err := json.Marshal(payload)
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", a.url, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := fetchHTTP(context.Background(), a.client, req)
+
+	if err != nil {
+		return err
+	}
+
+	closeResponse(res.Body)
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+)
+
+func webhook(t *testing.T) (*httptest.Server, chan map[string]interface{}) {
+	payloads := make(chan map[string]interface{}, 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+
+		payloads <- payload
+	}))
+
+	return server, payloads
+}
+
+func expectNoAlert(t *testing.T, payloads chan map[string]interface{}) {
+	select {
+	case payload := <-payloads:
+		t.Errorf("Expected no alert, got %v", payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func nextAlert(t *testing.T, payloads chan map[string]interface{}) map[string]interface{} {
+	select {
+	case payload := <-payloads:
+		return payload
+	case <-time.After(time.Second):
+		t.Fatal("Expected an alert")
+		return nil
+	}
+}
+
+func TestAlertsAreSentAsThingsGetWorse(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	server, payloads := webhook(t)
+	defer server.Close()
+
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+	e.alerter = newAlerter(server.URL, alertFormatJSON, 10, nil)
+
+	for _, step := range []struct {
+		remaining int
+		exhausted interface{} // or nil for no alert
+	}{
+		{50, nil},
+		{9, false},
+		{5, nil}, // still low, so already alerted
+		{0, true},
+		{0, nil},
+		{20, nil}, // recovered, which resets the alert
+		{8, false},
+	} {
+		hub.SetRateLimit(100, step.remaining)
+		e.scrape(context.Background(), e.targets[0], time.Now())
+
+		if step.exhausted == nil {
+			expectNoAlert(t, payloads)
+			continue
+		}
+
+		payload := nextAlert(t, payloads)
+
+		if payload["exhausted"] != step.exhausted || payload["remaining"] != float64(step.remaining) || payload["repository"] != defaultRepository {
+			t.Errorf("Unexpected alert for %d remaining: %v", step.remaining, payload)
+		}
+	}
+}
+
+func TestSlackAlertsHaveText(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	server, payloads := webhook(t)
+	defer server.Close()
+
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+	e.alerter = newAlerter(server.URL, alertFormatSlack, 10, nil)
+
+	hub.SetRateLimit(100, 0)
+	e.scrape(context.Background(), e.targets[0], time.Now())
+
+	expected := "ratelimitpreview/test has no Docker Hub pulls remaining, out of a limit of 100"
+
+	if payload := nextAlert(t, payloads); payload["text"] != expected {
+		t.Errorf("Expected %q, got %v", expected, payload)
+	}
+}
+
+func TestAlertsAreSentToSyslogWithoutAWebhook(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	events, err := newSyslogWriter("udp://"+conn.LocalAddr().String(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+	e.alerter = newAlerter("", alertFormatJSON, 10, nil)
+	e.alerter.events = events
+
+	hub.SetRateLimit(100, 0)
+	e.scrape(context.Background(), e.targets[0], time.Now())
+
+	buf := make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := string(buf[:n]); !strings.HasPrefix(got, "<27>1 ") || !strings.Contains(got, " alert [dockerhub@32473 ") {
+		t.Errorf("Expected an alert, got %q", got)
+	}
+}
+
+func TestAlertsAreSuppressedDuringMaintenance(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	server, payloads := webhook(t)
+	defer server.Close()
+
+	now := time.Date(2020, 11, 20, 10, 30, 0, 0, time.UTC)
+
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+	e.alerter = newAlerter(server.URL, alertFormatJSON, 10, nil)
+	e.maintenanceWindows = maintenanceWindows{{start: now.Add(-time.Hour), end: now.Add(time.Hour)}}
+
+	hub.SetRateLimit(100, 0)
+	e.scrape(context.Background(), e.targets[0], now)
+
+	expectNoAlert(t, payloads)
+
+	// Still exhausted once the window is over
+	e.scrape(context.Background(), e.targets[0], now.Add(2*time.Hour))
+
+	if payload := nextAlert(t, payloads); payload["exhausted"] != true {
+		t.Errorf("Expected an alert once the maintenance is over, got %v", payload)
+	}
+}
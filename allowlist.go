@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// allowList only lets clients in some networks use the exporter, eg the Prometheus servers'
+// ranges, which is cheaper than a reverse proxy just for access control. The liveness and
+// readiness probes are left open, since the kubelet probes from the node's address.
+type allowList []*net.IPNet
+
+// parseAllowCIDR parses an -allow-cidr, which is a CIDR range, or a single IP address.
+func parseAllowCIDR(flag string) (*net.IPNet, error) {
+	if !strings.Contains(flag, "/") {
+		ip := net.ParseIP(flag)
+
+		if ip == nil {
+			return nil, fmt.Errorf("invalid -allow-cidr %q: not a CIDR range or IP address", flag)
+		}
+
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, network, err := net.ParseCIDR(flag)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid -allow-cidr %q: %w", flag, err)
+	}
+
+	return network, nil
+}
+
+// allows returns whether the client at the request's remote address is allowed.
+func (l allowList) allows(r *http.Request) bool {
+	ip := net.ParseIP(clientIP(r))
+
+	// Connections over a Unix domain socket are from the same host
+	if ip == nil {
+		return r.RemoteAddr == "" || r.RemoteAddr == "@"
+	}
+
+	for _, network := range l {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// wrap returns next, answering clients which aren't allowed with 403 Forbidden first, unless the
+// list is empty.
+func (l allowList) wrap(next http.Handler) http.Handler {
+	if len(l) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" && r.URL.Path != "/readyz" && !l.allows(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
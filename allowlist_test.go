@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAllowListOnlyLetsInTheAllowedNetworks(t *testing.T) {
+	var allowed allowList
+
+	for _, flag := range []string{"10.0.0.0/8", "192.0.2.10", "2001:db8::/32"} {
+		network, err := parseAllowCIDR(flag)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		allowed = append(allowed, network)
+	}
+
+	handler := allowed.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, test := range []struct {
+		remoteAddr, path string
+		expected         int
+	}{
+		{"10.1.2.3:40000", "/metrics", http.StatusOK},
+		{"192.0.2.10:40000", "/", http.StatusOK},
+		{"192.0.2.11:40000", "/metrics", http.StatusForbidden},
+		{"[2001:db8::1]:40000", "/metrics", http.StatusOK},
+		{"[2001:db9::1]:40000", "/api/v1/ratelimit", http.StatusForbidden},
+		{"198.51.100.1:40000", "/healthz", http.StatusOK},
+		{"@", "/metrics", http.StatusOK},
+	} {
+		req := httptest.NewRequest("GET", test.path, nil)
+		req.RemoteAddr = test.remoteAddr
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("Expected %d for %s from %s, got %d", test.expected, test.path, test.remoteAddr, w.Code)
+		}
+	}
+}
+
+func TestParseAllowCIDR(t *testing.T) {
+	network, err := parseAllowCIDR("192.0.2.10")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if network.String() != "192.0.2.10/32" || !network.Contains(net.ParseIP("192.0.2.10")) {
+		t.Errorf("Expected a single IP address to be a /32, got %s", network)
+	}
+
+	for _, flag := range []string{"10.0.0.0/33", "prometheus", ""} {
+		if _, err := parseAllowCIDR(flag); err == nil {
+			t.Errorf("Expected an error parsing %q", flag)
+		}
+	}
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// awsSecret reads Docker Hub credentials from AWS Secrets Manager or SSM Parameter Store, as a JSON
+// object with username and password keys, using the IAM role of the pod or instance. Like
+// kubernetesSecret, it talks to the APIs directly rather than taking on the AWS SDK.
+type awsSecret struct {
+	source   string
+	service  string // secretsmanager or ssm
+	endpoint string
+	region   string
+
+	credentials *awsCredentialsProvider
+	client      *http.Client
+}
+
+// newAWSSecret returns an awsSecret for source, which is the ARN of a Secrets Manager secret or an
+// SSM parameter, or the name of an SSM parameter in the region from the environment.
+func newAWSSecret(source string) (*awsSecret, error) {
+	s := &awsSecret{
+		source:      source,
+		credentials: newAWSCredentialsProvider(),
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+
+	domain := "amazonaws.com"
+
+	if strings.HasPrefix(source, "arn:") {
+		// arn:partition:service:region:account:resource
+		parts := strings.SplitN(source, ":", 6)
+
+		if len(parts) != 6 || parts[3] == "" {
+			return nil, fmt.Errorf("%q isn't the ARN of a secret or parameter", source)
+		}
+
+		if parts[1] == "aws-cn" {
+			domain = "amazonaws.com.cn"
+		}
+
+		s.service, s.region = parts[2], parts[3]
+	} else {
+		s.service, s.region = "ssm", awsRegion()
+	}
+
+	if s.service != "secretsmanager" && s.service != "ssm" {
+		return nil, fmt.Errorf("%q should be a Secrets Manager secret or an SSM parameter", source)
+	}
+
+	if s.region == "" {
+		return nil, fmt.Errorf("no region for %q, set AWS_REGION", source)
+	}
+
+	s.endpoint = "https://" + s.service + "." + s.region + "." + domain
+
+	return s, nil
+}
+
+func awsRegion() string {
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
+
+func (s *awsSecret) String() string {
+	return s.source
+}
+
+// read returns the credentials in the secret or parameter, and its version.
+func (s *awsSecret) read() (*credentials, string, error) {
+	var value, version string
+
+	if s.service == "secretsmanager" {
+		var res struct {
+			SecretString string
+			VersionId    string
+		}
+
+		if err := s.call("secretsmanager.GetSecretValue", map[string]interface{}{"SecretId": s.source}, &res); err != nil {
+			return nil, "", err
+		}
+
+		value, version = res.SecretString, res.VersionId
+	} else {
+		var res struct {
+			Parameter struct {
+				Value   string
+				Version int64
+			}
+		}
+
+		if err := s.call("AmazonSSM.GetParameter", map[string]interface{}{"Name": s.source, "WithDecryption": true}, &res); err != nil {
+			return nil, "", err
+		}
+
+		value, version = res.Parameter.Value, strconv.FormatInt(res.Parameter.Version, 10)
+	}
+
+	var parsed struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+
+	if err := json.Unmarshal([]byte(value), &parsed); err != nil || parsed.Username == "" || parsed.Password == "" {
+		return nil, "", fmt.Errorf("%s should be a JSON object with a username and password", s)
+	}
+
+	return &credentials{username: parsed.Username, passphrase: parsed.Password}, version, nil
+}
+
+// call makes a request to one of the AWS JSON APIs.
+func (s *awsSecret) call(target string, body interface{}, res interface{}) error {
+	c, err := s.credentials.get()
+
+	if err != nil {
+		return fmt.Errorf("unable to get AWS credentials: %w", err)
+	}
+
+	payload, err := json.Marshal(body)
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", s.endpoint+"/", bytes.NewReader(payload))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	signAWSRequest(req, payload, c, s.region, s.service, time.Now())
+
+	r, err := s.client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer closeResponse(r.Body)
+
+	if r.StatusCode != http.StatusOK {
+		// AWS explains what went wrong, eg that the role isn't allowed to read the secret
+		var awsErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+
+		_ = json.NewDecoder(r.Body).Decode(&awsErr)
+
+		return fmt.Errorf("unable to read %s: %w: %s %s", s, &httpStatusError{StatusCode: r.StatusCode}, awsErr.Type, awsErr.Message)
+	}
+
+	return json.NewDecoder(r.Body).Decode(res)
+}
+
+// signAWSRequest signs req, whose body is body, with AWS Signature Version 4. Every header that is
+// already on req is signed.
+func signAWSRequest(req *http.Request, body []byte, c *awsCredentials, region string, service string, now time.Time) {
+	timestamp := now.UTC().Format("20060102T150405Z")
+	date := timestamp[:8]
+
+	req.Header.Set("X-Amz-Date", timestamp)
+
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		strings.Replace(req.URL.Query().Encode(), "+", "%20", -1),
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + timestamp + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := []byte("AWS4" + c.secretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKeyID, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))))
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsCredentials are for signing requests to AWS.
+type awsCredentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	expires         time.Time // zero if they don't expire
+}
+
+// awsCredentialsProvider finds credentials like the AWS SDKs do: from the environment, from a web
+// identity token for IAM roles for service accounts on EKS, from the ECS container credentials
+// endpoint, or from the EC2 instance metadata service. Temporary credentials are kept until shortly
+// before they expire.
+type awsCredentialsProvider struct {
+	client       *http.Client
+	stsURL       string
+	containerURL string
+	imdsURL      string
+
+	cached *awsCredentials
+}
+
+func newAWSCredentialsProvider() *awsCredentialsProvider {
+	stsURL := "https://sts.amazonaws.com"
+	if region := awsRegion(); region != "" {
+		stsURL = "https://sts." + region + ".amazonaws.com"
+	}
+
+	return &awsCredentialsProvider{
+		client:       &http.Client{Timeout: 10 * time.Second},
+		stsURL:       stsURL,
+		containerURL: "http://169.254.170.2",
+		imdsURL:      "http://169.254.169.254",
+	}
+}
+
+func (p *awsCredentialsProvider) get() (*awsCredentials, error) {
+	if p.cached != nil && (p.cached.expires.IsZero() || time.Until(p.cached.expires) > 5*time.Minute) {
+		return p.cached, nil
+	}
+
+	c, err := p.fetch()
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.cached = c
+
+	return c, nil
+}
+
+func (p *awsCredentialsProvider) fetch() (*awsCredentials, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return &awsCredentials{
+			accessKeyID:     id,
+			secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	if tokenFile := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"); tokenFile != "" {
+		return p.assumeRoleWithWebIdentity(tokenFile, os.Getenv("AWS_ROLE_ARN"))
+	}
+
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		req, err := http.NewRequest("GET", p.containerURL+uri, nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return p.fetchRoleCredentials(req)
+	}
+
+	return p.instanceCredentials()
+}
+
+// assumeRoleWithWebIdentity exchanges the token in tokenFile for credentials for role. The request
+// doesn't need signing, since the token is what authenticates it.
+func (p *awsCredentialsProvider) assumeRoleWithWebIdentity(tokenFile string, role string) (*awsCredentials, error) {
+	token, err := ioutil.ReadFile(tokenFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {role},
+		"RoleSessionName":  {"dockerhub-exporter"},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+
+	res, err := p.client.Get(p.stsURL + "/?" + query.Encode())
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeResponse(res.Body)
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to assume %s: %w", role, &httpStatusError{StatusCode: res.StatusCode})
+	}
+
+	var parsed struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+
+	if err := xml.NewDecoder(res.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+
+	return &awsCredentials{
+		accessKeyID:     parsed.Credentials.AccessKeyID,
+		secretAccessKey: parsed.Credentials.SecretAccessKey,
+		sessionToken:    parsed.Credentials.SessionToken,
+		expires:         parsed.Credentials.Expiration,
+	}, nil
+}
+
+// instanceCredentials gets the credentials for the EC2 instance's role, using IMDSv2.
+func (p *awsCredentialsProvider) instanceCredentials() (*awsCredentials, error) {
+	req, err := http.NewRequest("PUT", p.imdsURL+"/latest/api/token", nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "300")
+
+	token, err := p.fetchText(req)
+
+	if err != nil {
+		return nil, fmt.Errorf("no AWS credentials in the environment, and unable to reach the instance metadata service: %w", err)
+	}
+
+	rolesURL := p.imdsURL + "/latest/meta-data/iam/security-credentials/"
+
+	if req, err = http.NewRequest("GET", rolesURL, nil); err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+
+	role, err := p.fetchText(req)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to find the instance's role: %w", err)
+	}
+
+	if req, err = http.NewRequest("GET", rolesURL+strings.SplitN(role, "\n", 2)[0], nil); err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+
+	return p.fetchRoleCredentials(req)
+}
+
+func (p *awsCredentialsProvider) fetchText(req *http.Request) (string, error) {
+	res, err := p.client.Do(req)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer closeResponse(res.Body)
+
+	if res.StatusCode != http.StatusOK {
+		return "", &httpStatusError{StatusCode: res.StatusCode}
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+
+	return strings.TrimSpace(string(b)), err
+}
+
+// fetchRoleCredentials gets credentials from the ECS container credentials endpoint or the instance
+// metadata service, which both return them in the same way.
+func (p *awsCredentialsProvider) fetchRoleCredentials(req *http.Request) (*awsCredentials, error) {
+	res, err := p.client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeResponse(res.Body)
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to get role credentials: %w", &httpStatusError{StatusCode: res.StatusCode})
+	}
+
+	var parsed struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string
+		Token           string
+		Expiration      time.Time
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+
+	return &awsCredentials{
+		accessKeyID:     parsed.AccessKeyID,
+		secretAccessKey: parsed.SecretAccessKey,
+		sessionToken:    parsed.Token,
+		expires:         parsed.Expiration,
+	}, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// From get-vanilla in the AWS Signature Version 4 test suite.
+func TestAWSRequestsAreSigned(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	now, _ := time.Parse(time.RFC3339, "2015-08-30T12:36:00Z")
+	c := &awsCredentials{accessKeyID: "AKIDEXAMPLE", secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+
+	signAWSRequest(req, nil, c, "us-east-1", "service", now)
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+
+	if actual := req.Header.Get("Authorization"); actual != expected {
+		t.Errorf("Expected %s, got %s", expected, actual)
+	}
+}
+
+func TestCredentialsAreReadFromAWS(t *testing.T) {
+	for _, source := range []string{
+		"arn:aws:secretsmanager:eu-west-1:123456789012:secret:dockerhub-AbCdEf",
+		"arn:aws:ssm:eu-west-1:123456789012:parameter/dockerhub",
+	} {
+		t.Run(strings.SplitN(source, ":", 4)[2], func(t *testing.T) {
+			aws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=ASIAEXAMPLE/") ||
+					r.Header.Get("X-Amz-Security-Token") != "session-token" {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+
+				value := `{"username":"username","password":"password"}`
+
+				switch r.Header.Get("X-Amz-Target") {
+				case "secretsmanager.GetSecretValue":
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{"SecretString": value, "VersionId": "v1"})
+				case "AmazonSSM.GetParameter":
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{"Parameter": map[string]interface{}{"Value": value, "Version": 1}})
+				default:
+					w.WriteHeader(http.StatusBadRequest)
+				}
+			}))
+			defer aws.Close()
+
+			// The credentials come from the ECS container credentials endpoint
+			ecs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"AccessKeyId":     "ASIAEXAMPLE",
+					"SecretAccessKey": "secret",
+					"Token":           "session-token",
+					"Expiration":      time.Now().Add(time.Hour),
+				})
+			}))
+			defer ecs.Close()
+
+			for name, value := range map[string]string{
+				"AWS_ACCESS_KEY_ID":                      "",
+				"AWS_WEB_IDENTITY_TOKEN_FILE":            "",
+				"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI": "/v2/credentials/id",
+			} {
+				defer os.Setenv(name, os.Getenv(name))
+				os.Setenv(name, value)
+			}
+
+			secret, err := newAWSSecret(source)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if secret.endpoint != "https://"+secret.service+".eu-west-1.amazonaws.com" {
+				t.Errorf("Unexpected endpoint %s", secret.endpoint)
+			}
+
+			secret.endpoint = aws.URL
+			secret.credentials.containerURL = ecs.URL
+
+			c, _, err := secret.read()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if *c != (credentials{username: "username", passphrase: "password"}) {
+				t.Errorf("Unexpected credentials %+v", *c)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/version"
+)
+
+// The build information is set with -ldflags at build time, eg
+//
+//	go build -ldflags="-X github.com/prometheus/common/version.Version=1.2.0
+//	  -X github.com/prometheus/common/version.Revision=$(git rev-parse HEAD)
+//	  -X github.com/prometheus/common/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// which the Dockerfile does from its VERSION, REVISION and BUILD_DATE build args.
+func init() {
+	// go install github.com/jabley/dockerhub_exporter@v1.2.0 records the module version instead
+	if info, ok := debug.ReadBuildInfo(); ok && version.Version == "" && info.Main.Version != "(devel)" {
+		version.Version = info.Main.Version
+	}
+}
+
+// newBuildInfoCollector returns the dockerhub_exporter_build_info metric, which is
+// version.NewCollector's with the build date too, to tell which build is running where.
+func newBuildInfoCollector() prometheus.Collector {
+	return prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace: "dockerhub_exporter",
+			Name:      "build_info",
+			Help:      "A metric with a constant '1' value labeled by version, revision, branch, build date and goversion from which dockerhub_exporter was built.",
+			ConstLabels: prometheus.Labels{
+				"version":    version.Version,
+				"revision":   version.Revision,
+				"branch":     version.Branch,
+				"build_date": version.BuildDate,
+				"goversion":  version.GoVersion,
+			},
+		},
+		func() float64 { return 1 },
+	)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/version"
+)
+
+func TestBuildInfoHasTheBuildDate(t *testing.T) {
+	defer func(v, r, d string) {
+		version.Version, version.Revision, version.BuildDate = v, r, d
+	}(version.Version, version.Revision, version.BuildDate)
+
+	version.Version, version.Revision, version.BuildDate = "1.2.0", "abc123", "2020-11-16T10:00:00Z"
+
+	expected := `
+# HELP dockerhub_exporter_build_info A metric with a constant '1' value labeled by version, revision, branch, build date and goversion from which dockerhub_exporter was built.
+# TYPE dockerhub_exporter_build_info gauge
+dockerhub_exporter_build_info{branch="",build_date="2020-11-16T10:00:00Z",goversion="` + version.GoVersion + `",revision="abc123",version="1.2.0"} 1
+`
+
+	if err := testutil.CollectAndCompare(newBuildInfoCollector(), strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+}
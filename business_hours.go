@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	hoursBusiness = "business"
+	hoursOff      = "off"
+)
+
+// businessHours describes when people are at work, so that rate limit usage during the day can be
+// reported separately from overnight batch jobs.
+type businessHours struct {
+	start, end time.Duration // offsets from local midnight
+	days       map[time.Weekday]bool
+	location   *time.Location
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// parseBusinessHours parses hours like "09:00-17:30", days like "mon,tue,wed,thu,fri" and an IANA
+// time zone name like "Europe/London".
+func parseBusinessHours(hours string, days string, timezone string) (*businessHours, error) {
+	parts := strings.Split(hours, "-")
+
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("business hours %q should be written as <start>-<end>, eg 09:00-17:00", hours)
+	}
+
+	start, err := parseTimeOfDay(parts[0])
+
+	if err != nil {
+		return nil, err
+	}
+
+	end, err := parseTimeOfDay(parts[1])
+
+	if err != nil {
+		return nil, err
+	}
+
+	if end <= start {
+		return nil, fmt.Errorf("business hours %q end before they start", hours)
+	}
+
+	location, err := time.LoadLocation(timezone)
+
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q: %v", timezone, err)
+	}
+
+	b := &businessHours{start: start, end: end, days: map[time.Weekday]bool{}, location: location}
+
+	for _, day := range strings.Split(days, ",") {
+		weekday, ok := weekdays[strings.ToLower(strings.TrimSpace(day))]
+
+		if !ok {
+			return nil, fmt.Errorf("unknown day %q in business days %q", day, days)
+		}
+
+		b.days[weekday] = true
+	}
+
+	return b, nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, should be like 09:00", s)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// hours returns which hours t falls in, either hoursBusiness or hoursOff.
+func (b *businessHours) hours(t time.Time) string {
+	local := t.In(b.location)
+
+	if !b.days[local.Weekday()] {
+		return hoursOff
+	}
+
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, b.location)
+	sinceMidnight := local.Sub(midnight)
+
+	if sinceMidnight >= b.start && sinceMidnight < b.end {
+		return hoursBusiness
+	}
+
+	return hoursOff
+}
+
+// day returns the local date of t, used to start the minimums afresh each day.
+func (b *businessHours) day(t time.Time) string {
+	return t.In(b.location).Format("2006-01-02")
+}
+
+// observeRemaining updates the business hours aggregates for t with a freshly polled remaining.
+func (e *Exporter) observeRemaining(t *target, now time.Time, remaining float64) {
+	hours := e.businessHours.hours(now)
+
+	if day := e.businessHours.day(now); day != t.minRemainingDay {
+		e.minRemaining.DeleteLabelValues(t.repository, hoursBusiness)
+		e.minRemaining.DeleteLabelValues(t.repository, hoursOff)
+		t.minRemainingDay = day
+		t.minRemaining = map[string]float64{}
+	}
+
+	if min, ok := t.minRemaining[hours]; !ok || remaining < min {
+		t.minRemaining[hours] = remaining
+		e.minRemaining.WithLabelValues(t.repository, hours).Set(remaining)
+	}
+
+	if _, ok := t.consumedCreated[hours]; !ok {
+		e.consumed.WithLabelValues(t.repository, hours)
+		e.consumedCreated.WithLabelValues(t.repository, hours).Set(float64(now.Unix()))
+		t.consumedCreated[hours] = now
+	}
+
+	// Only count decreases. An increase means that earlier requests have dropped out of the
+	// window, which doesn't tell us anything about how many were made since the last poll.
+	if t.hasRemaining && remaining < t.lastRemaining {
+		e.consumed.WithLabelValues(t.repository, hours).Add(t.lastRemaining - remaining)
+		t.consumed[hours] += t.lastRemaining - remaining
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestBusinessHoursAreInTheirTimeZone(t *testing.T) {
+	b, err := parseBusinessHours("09:00-17:30", "mon,tue,wed,thu,fri", "America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for ts, expected := range map[string]string{
+		"2020-11-16T13:59:00Z": hoursOff,      // Monday 08:59 in New York
+		"2020-11-16T14:00:00Z": hoursBusiness, // Monday 09:00
+		"2020-11-16T22:29:00Z": hoursBusiness, // Monday 17:29
+		"2020-11-16T22:30:00Z": hoursOff,      // Monday 17:30
+		"2020-11-21T15:00:00Z": hoursOff,      // Saturday 10:00
+	} {
+		at, _ := time.Parse(time.RFC3339, ts)
+
+		if hours := b.hours(at); hours != expected {
+			t.Errorf("Expected %s to be in %s hours, got %s", ts, expected, hours)
+		}
+	}
+}
+
+func TestParseBusinessHoursRejectsBadConfig(t *testing.T) {
+	for _, c := range [][]string{
+		{"09:00", "mon", "UTC"},
+		{"9am-5pm", "mon", "UTC"},
+		{"17:00-09:00", "mon", "UTC"},
+		{"09:00-17:00", "someday", "UTC"},
+		{"09:00-17:00", "mon", "Mars/Olympus_Mons"},
+	} {
+		if _, err := parseBusinessHours(c[0], c[1], c[2]); err == nil {
+			t.Errorf("Expected an error parsing %v", c)
+		}
+	}
+}
+
+func TestConsumptionIsSplitBetweenBusinessAndOffHours(t *testing.T) {
+	authServer := httptest.NewServer(handler(&mockResponse{
+		response: authResponseBody(),
+	}))
+	defer authServer.Close()
+
+	remaining := 0
+	rateLimitServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("RateLimit-Limit", "100;w=21600")
+		w.Header().Set("RateLimit-Remaining", fmt.Sprintf("%d;w=21600", remaining))
+	}))
+	defer rateLimitServer.Close()
+
+	exporter := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository}, nil)
+	exporter.businessHours, _ = parseBusinessHours("09:00-17:00", "mon,tue,wed,thu,fri", "Europe/London")
+
+	for _, poll := range []struct {
+		at        string
+		remaining int
+	}{
+		{"2020-11-16T10:00:00Z", 90},
+		{"2020-11-16T11:00:00Z", 80},
+		{"2020-11-16T12:00:00Z", 95}, // earlier requests dropped out of the window
+		{"2020-11-16T18:00:00Z", 85},
+		{"2020-11-16T19:00:00Z", 70},
+	} {
+		remaining = poll.remaining
+		at, _ := time.Parse(time.RFC3339, poll.at)
+		exporter.scrape(context.Background(), exporter.targets[0], at)
+	}
+
+	for hours, expected := range map[string][2]float64{
+		hoursBusiness: {80, 10},
+		hoursOff:      {70, 25},
+	} {
+		if min := testutil.ToFloat64(exporter.minRemaining.WithLabelValues(defaultRepository, hours)); min != expected[0] {
+			t.Errorf("Expected minimum remaining in %s hours to be %v, got %v", hours, expected[0], min)
+		}
+
+		if consumed := testutil.ToFloat64(exporter.consumed.WithLabelValues(defaultRepository, hours)); consumed != expected[1] {
+			t.Errorf("Expected consumed in %s hours to be %v, got %v", hours, expected[1], consumed)
+		}
+	}
+}
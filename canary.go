@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// headerMapping names the response headers that the rate limit is read from.
+type headerMapping struct {
+	limit, remaining string
+}
+
+var defaultHeaderMapping = headerMapping{
+	limit:     "RateLimit-Limit",
+	remaining: "RateLimit-Remaining",
+}
+
+// canary evaluates a candidate header mapping against the responses polled with the active one,
+// for a limited time, so that a change can be checked against real traffic before it's promoted.
+// It doesn't make any requests of its own.
+type canary struct {
+	headers headerMapping
+	until   time.Time
+
+	active *prometheus.Desc
+	polls  *prometheus.CounterVec
+}
+
+func newCanary(headers headerMapping, until time.Time) *canary {
+	return &canary{
+		headers: headers,
+		until:   until,
+
+		active: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "canary", "active"),
+			"Whether a candidate header mapping is being evaluated (1) or not (0).",
+			nil, nil),
+		polls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "canary",
+			Name:      "polls_total",
+			Help:      "Polls evaluated with the candidate header mapping, by whether the result matched the active mapping.",
+		}, []string{"repository", "result"}),
+	}
+}
+
+func (c *canary) isActive(now time.Time) bool {
+	return now.Before(c.until)
+}
+
+// evaluate parses header with the candidate mapping and records whether it agrees with what the
+// active mapping made of it.
+func (c *canary) evaluate(t *target, now time.Time, header http.Header, limit float64, remaining float64) {
+	if !c.isActive(now) {
+		return
+	}
+
+	candidateLimit, candidateRemaining, err := parseRateLimitHeaders(header, c.headers)
+
+	switch {
+	case err != nil:
+		fmt.Printf("%s: canary: %+v\n", t.repository, err)
+		c.polls.WithLabelValues(t.repository, "error").Inc()
+	case candidateLimit != limit || candidateRemaining != remaining:
+		fmt.Printf("%s: canary: got limit %v and remaining %v, expected %v and %v\n", t.repository, candidateLimit, candidateRemaining, limit, remaining)
+		c.polls.WithLabelValues(t.repository, "mismatch").Inc()
+	default:
+		c.polls.WithLabelValues(t.repository, "match").Inc()
+	}
+}
+
+func (c *canary) collect(ch chan<- prometheus.Metric, now time.Time) {
+	active := 0.0
+	if c.isActive(now) {
+		active = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.active, prometheus.GaugeValue, active)
+	c.polls.Collect(ch)
+}
+
+func (c *canary) describe(ch chan<- *prometheus.Desc) {
+	ch <- c.active
+	c.polls.Describe(ch)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCanaryComparesCandidateHeadersWithActiveOnes(t *testing.T) {
+	authServer := httptest.NewServer(handler(&mockResponse{
+		response: authResponseBody(),
+	}))
+	defer authServer.Close()
+
+	rateLimitServer := httptest.NewServer(handler(&mockResponse{
+		headers: map[string][]string{
+			"RateLimit-Limit":       {"100;w=21600"},
+			"RateLimit-Remaining":   {"76;w=21600"},
+			"X-RateLimit-Limit":     {"100"},
+			"X-RateLimit-Remaining": {"75"},
+			"X-Quota-Limit":         {"100"},
+			"X-Quota-Remaining":     {"76"},
+		},
+	}))
+	defer rateLimitServer.Close()
+
+	now := time.Now()
+
+	for _, c := range []struct {
+		headers  headerMapping
+		result   string
+		expected float64
+	}{
+		{headerMapping{limit: "X-Quota-Limit", remaining: "X-Quota-Remaining"}, "match", 1},
+		{headerMapping{limit: "X-RateLimit-Limit", remaining: "X-RateLimit-Remaining"}, "mismatch", 1},
+		{headerMapping{limit: "X-RateLimit-Limit", remaining: "X-Missing"}, "error", 1},
+	} {
+		exporter := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository}, nil)
+		exporter.canary = newCanary(c.headers, now.Add(time.Hour))
+		exporter.scrape(context.Background(), exporter.targets[0], now)
+
+		if polls := testutil.ToFloat64(exporter.canary.polls.WithLabelValues(defaultRepository, c.result)); polls != c.expected {
+			t.Errorf("Expected %v %s polls for %v, got %v", c.expected, c.result, c.headers, polls)
+		}
+
+		exporter.scrape(context.Background(), exporter.targets[0], now.Add(2*time.Hour))
+
+		if polls := testutil.ToFloat64(exporter.canary.polls.WithLabelValues(defaultRepository, c.result)); polls != c.expected {
+			t.Errorf("Expected polls after the canary finished not to be evaluated for %v", c.headers)
+		}
+	}
+}
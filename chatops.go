@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxSlackRequestAge is how old a slash command can be, to stop a captured one being replayed.
+	maxSlackRequestAge = 5 * time.Minute
+
+	maxSlackRequestBytes = 64 * 1024
+)
+
+// slackCommandHandler answers a Slack slash command, eg /dockerhub limits, with the remaining
+// requests for each of e's targets as of the last poll, so that on-call can check them from chat
+// during an incident. It doesn't poll Docker Hub itself. Requests must be signed with Slack's
+// signing secret for the app.
+func slackCommandHandler(e *Exporter, signingSecret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "Only POST is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxSlackRequestBytes))
+
+		if err != nil {
+			http.Error(w, "Unable to read the request", http.StatusBadRequest)
+			return
+		}
+
+		if err := verifySlackSignature(r.Header, body, signingSecret, e.clock()); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		form, err := url.ParseQuery(string(body))
+
+		if err != nil {
+			http.Error(w, "Unable to parse the command", http.StatusBadRequest)
+			return
+		}
+
+		response := map[string]string{"response_type": "ephemeral"}
+
+		switch strings.TrimSpace(form.Get("text")) {
+		case "", "limits":
+			response["response_type"] = "in_channel"
+			response["text"] = formatLimitsForChat(e.status(), e.clock())
+		default:
+			response["text"] = fmt.Sprintf("Usage: `%s limits` shows the remaining Docker Hub requests for each repository", form.Get("command"))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response)
+	}
+}
+
+// verifySlackSignature checks the signature Slack sends with each request, which is an HMAC of
+// its timestamp and body with the signing secret.
+func verifySlackSignature(header http.Header, body []byte, signingSecret string, now time.Time) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+
+	if err != nil {
+		return fmt.Errorf("missing or invalid X-Slack-Request-Timestamp")
+	}
+
+	if age := now.Sub(time.Unix(seconds, 0)); age > maxSlackRequestAge || age < -maxSlackRequestAge {
+		return fmt.Errorf("the request is too old")
+	}
+
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	_, _ = mac.Write([]byte("v0:" + timestamp + ":"))
+	_, _ = mac.Write(body)
+
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(header.Get("X-Slack-Signature")), []byte(expected)) {
+		return fmt.Errorf("invalid X-Slack-Signature")
+	}
+
+	return nil
+}
+
+// formatLimitsForChat formats statuses as a line per repository in Slack's markdown.
+func formatLimitsForChat(statuses []rateLimitStatus, now time.Time) string {
+	var lines []string
+
+	for _, s := range statuses {
+		if s.LastSuccess == nil {
+			lines = append(lines, fmt.Sprintf("`%s`: not polled successfully yet", s.Repository))
+			continue
+		}
+
+		line := fmt.Sprintf("`%s`: %v of %v requests remaining", s.Repository, s.Remaining, s.Limit)
+
+		if s.Limit > 0 {
+			line += fmt.Sprintf(" (%.0f%%)", 100*s.Remaining/s.Limit)
+		}
+
+		line += fmt.Sprintf(", as of %v ago", now.Sub(*s.LastSuccess).Round(time.Second))
+
+		if s.SourceIP != "" {
+			line += " for " + s.SourceIP
+		}
+
+		lines = append(lines, line)
+	}
+
+	if len(lines) == 0 {
+		return "No repositories are being polled"
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+)
+
+func slackRequest(body string, secret string, timestamp time.Time) *http.Request {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte("v0:" + ts + ":" + body))
+
+	req := httptest.NewRequest("POST", "/hooks/slack", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Slack-Request-Timestamp", ts)
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+
+	return req
+}
+
+func TestSlackCommandAnswersWithTheLimits(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	hub.SetRateLimit(100, 42)
+	hub.SetSource("192.0.2.1")
+
+	now := time.Date(2020, 11, 16, 10, 0, 0, 0, time.UTC)
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository, "library/alpine"}, nil)
+	e.clock = func() time.Time { return now }
+	e.scrape(context.Background(), e.targets[0], now.Add(-2*time.Minute))
+
+	w := httptest.NewRecorder()
+	slackCommandHandler(e, "s3cret")(w, slackRequest("command=%2Fdockerhub&text=limits", "s3cret", now))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body)
+	}
+
+	var response map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "`ratelimitpreview/test`: 42 of 100 requests remaining (42%), as of 2m0s ago for 192.0.2.1\n" +
+		"`library/alpine`: not polled successfully yet"
+
+	if response["text"] != expected || response["response_type"] != "in_channel" {
+		t.Errorf("Expected %q in the channel, got %+v", expected, response)
+	}
+
+	w = httptest.NewRecorder()
+	slackCommandHandler(e, "s3cret")(w, slackRequest("command=%2Fdockerhub&text=help", "s3cret", now))
+
+	if !strings.Contains(w.Body.String(), "Usage: `/dockerhub limits`") {
+		t.Errorf("Expected the usage for an unknown command, got %s", w.Body)
+	}
+}
+
+func TestSlackCommandsMustBeSigned(t *testing.T) {
+	e := NewExporter("", "", []string{defaultRepository}, nil)
+	now := time.Now()
+	e.clock = func() time.Time { return now }
+
+	for name, req := range map[string]*http.Request{
+		"wrong secret": slackRequest("text=limits", "guess", now),
+		"replayed":     slackRequest("text=limits", "s3cret", now.Add(-10*time.Minute)),
+		"unsigned":     httptest.NewRequest("POST", "/hooks/slack", strings.NewReader("text=limits")),
+	} {
+		w := httptest.NewRecorder()
+		slackCommandHandler(e, "s3cret")(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected a %s command to be rejected, got %d", name, w.Code)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Exit codes for -once, following the Nagios plugin conventions.
+const (
+	checkOK       = 0
+	checkCritical = 2
+	checkUnknown  = 3
+)
+
+// checkResult is the outcome of polling Docker Hub once about a target.
+type checkResult struct {
+	Repository string  `json:"repository"`
+	Limit      float64 `json:"limit"`
+	Remaining  float64 `json:"remaining"`
+	SourceIP   string  `json:"source_ip,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	Reason     string  `json:"reason,omitempty"`
+}
+
+// rateLimitSource returns the IP address that Docker Hub counted the request against.
+func rateLimitSource(header http.Header) string {
+	return header.Get("Docker-RateLimit-Source")
+}
+
+// check polls Docker Hub once about each target, without updating any metrics.
+func (e *Exporter) check() []checkResult {
+	results := make([]checkResult, 0, len(e.targets))
+
+	for _, t := range e.targets {
+		result := checkResult{Repository: t.repository}
+		polled, credentials := e.pollCopy(t)
+		limit, remaining, header, err := e.fetchRateLimit(context.Background(), polled, nil)
+
+		e.lock()
+		e.keepAuth(t, polled, credentials)
+		e.mu.Unlock()
+
+		if err != nil {
+			result.Error = err.Error()
+			result.Reason = failureReason(err)
+		} else {
+			result.Limit = limit
+			result.Remaining = remaining
+			result.SourceIP = rateLimitSource(header)
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// runCheck polls Docker Hub once, writes the results to w as text or JSON, and returns the exit
+// code: critical if any target has fewer than threshold requests remaining, or unknown if it
+// couldn't be polled.
+func runCheck(e *Exporter, output string, threshold float64, w io.Writer) int {
+	results := e.check()
+	code := checkOK
+
+	for _, result := range results {
+		status := "OK"
+
+		switch {
+		case result.Error != "":
+			status = "UNKNOWN"
+			code = checkUnknown
+		case result.Remaining < threshold:
+			status = "CRITICAL"
+
+			if code != checkUnknown {
+				code = checkCritical
+			}
+		}
+
+		if output == "text" {
+			if result.Error != "" {
+				fmt.Fprintf(w, "%s: %s %s (%s)\n", status, result.Repository, result.Error, result.Reason)
+			} else {
+				fmt.Fprintf(w, "%s: %s %v/%v remaining from %s\n", status, result.Repository, result.Remaining, result.Limit, result.SourceIP)
+			}
+		}
+	}
+
+	if output == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(results)
+	}
+
+	return code
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func checkServers() (*httptest.Server, *httptest.Server) {
+	authServer := httptest.NewServer(handler(&mockResponse{
+		response: authResponseBody(),
+	}))
+
+	rateLimitServer := httptest.NewServer(handler(&mockResponse{
+		headers: map[string][]string{
+			"RateLimit-Limit":         {"100;w=21600"},
+			"RateLimit-Remaining":     {"76;w=21600"},
+			"Docker-RateLimit-Source": {"192.0.2.1"},
+		},
+	}))
+
+	return authServer, rateLimitServer
+}
+
+func TestCheckPrintsTheRateLimit(t *testing.T) {
+	authServer, rateLimitServer := checkServers()
+	defer authServer.Close()
+	defer rateLimitServer.Close()
+
+	exporter := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository}, nil)
+
+	var out bytes.Buffer
+	if code := runCheck(exporter, "text", 10, &out); code != checkOK {
+		t.Fatalf("Expected exit code %d, got %d", checkOK, code)
+	}
+
+	if expected := "OK: ratelimitpreview/test 76/100 remaining from 192.0.2.1\n"; out.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestCheckIsCriticalBelowTheThreshold(t *testing.T) {
+	authServer, rateLimitServer := checkServers()
+	defer authServer.Close()
+	defer rateLimitServer.Close()
+
+	exporter := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository}, nil)
+
+	var out bytes.Buffer
+	if code := runCheck(exporter, "json", 80, &out); code != checkCritical {
+		t.Fatalf("Expected exit code %d, got %d", checkCritical, code)
+	}
+
+	var results []checkResult
+	if err := json.Unmarshal(out.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := checkResult{Repository: defaultRepository, Limit: 100, Remaining: 76, SourceIP: "192.0.2.1"}
+	if len(results) != 1 || results[0] != expected {
+		t.Fatalf("Expected %+v, got %+v", expected, results)
+	}
+}
+
+func TestCheckIsUnknownWhenDockerHubCannotBePolled(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer authServer.Close()
+
+	exporter := NewExporter(authServer.URL, "http://localhost:0", []string{defaultRepository}, nil)
+
+	var out bytes.Buffer
+	if code := runCheck(exporter, "text", 0, &out); code != checkUnknown {
+		t.Fatalf("Expected exit code %d, got %d", checkUnknown, code)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultCircuitFailures = 5
+	defaultCircuitCooldown = time.Minute
+)
+
+// The states of the circuit breaker, used as the `state` label on its gauge.
+const (
+	circuitClosed   = "closed"    // polling as normal
+	circuitOpen     = "open"      // not polling until the cooldown is over
+	circuitHalfOpen = "half_open" // polling again to see if Docker Hub has recovered
+)
+
+var circuitStates = []string{circuitClosed, circuitOpen, circuitHalfOpen}
+
+// circuitBreaker stops polling Docker Hub for a while when it looks to be down, rather than
+// hammering it, and filling the logs, on every scrape. After threshold polls in a row have failed
+// on Docker Hub's side, the circuit opens, and polls are skipped until cooldown is over. Then the
+// next poll is let through to see if it has recovered, which closes the circuit if it succeeds, or
+// opens it again if it doesn't. A nil *circuitBreaker never opens.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	state    string
+	failures int
+	openedAt time.Time
+
+	gauge *prometheus.GaugeVec
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	c := &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		gauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "exporter_circuit_state",
+			Help:      "Whether the circuit breaker for polling Docker Hub is in each state (1) or not (0).",
+		}, []string{"state"}),
+	}
+
+	c.setState(circuitClosed)
+
+	return c
+}
+
+func (c *circuitBreaker) setState(state string) {
+	c.state = state
+
+	for _, s := range circuitStates {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+
+		c.gauge.WithLabelValues(s).Set(value)
+	}
+}
+
+// allow returns whether to poll Docker Hub at now.
+func (c *circuitBreaker) allow(now time.Time) bool {
+	if c == nil || c.state != circuitOpen {
+		return true
+	}
+
+	if now.Sub(c.openedAt) < c.cooldown {
+		return false
+	}
+
+	c.setState(circuitHalfOpen)
+
+	return true
+}
+
+// succeeded records a successful poll, and returns whether it closed the circuit.
+func (c *circuitBreaker) succeeded() bool {
+	if c == nil {
+		return false
+	}
+
+	c.failures = 0
+
+	if c.state == circuitClosed {
+		return false
+	}
+
+	c.setState(circuitClosed)
+
+	return true
+}
+
+// failed records a poll which failed at now, and returns whether it opened the circuit. Only
+// failures on Docker Hub's side count, rather than eg rejected credentials.
+func (c *circuitBreaker) failed(now time.Time, err error) bool {
+	if c == nil {
+		return false
+	}
+
+	switch failureReason(err) {
+	case failureReasonTimeout, failureReasonDNS, failureReasonReset, failureReasonTLS, failureReasonNetwork,
+		failureReasonHTTPStatus:
+	default:
+		return false
+	}
+
+	c.failures++
+
+	if c.state == circuitOpen || (c.state == circuitClosed && c.failures < c.threshold) {
+		return false
+	}
+
+	c.openedAt = now
+	c.setState(circuitOpen)
+
+	return true
+}
+
+func (c *circuitBreaker) collect(ch chan<- prometheus.Metric) {
+	if c != nil {
+		c.gauge.Collect(ch)
+	}
+}
+
+func (c *circuitBreaker) describe(ch chan<- *prometheus.Desc) {
+	if c != nil {
+		c.gauge.Describe(ch)
+	}
+}
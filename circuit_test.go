@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTheCircuitOpensWhileDockerHubIsDown(t *testing.T) {
+	var down int32 = 1
+	var requests int32
+
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		if atomic.LoadInt32(&down) == 1 {
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = w.Write(registrytest.TokenResponse("token", time.Now()))
+	}))
+	defer auth.Close()
+
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		if atomic.LoadInt32(&down) == 1 {
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", "100;w=21600")
+		w.Header().Set("RateLimit-Remaining", "76;w=21600")
+	}))
+	defer registry.Close()
+
+	now := time.Now()
+
+	e := NewExporter(auth.URL, registry.URL, []string{defaultRepository}, nil)
+	e.clock = func() time.Time { return now }
+	e.circuit = newCircuitBreaker(2, time.Minute)
+
+	state := func() string {
+		for _, s := range circuitStates {
+			if testutil.ToFloat64(e.circuit.gauge.WithLabelValues(s)) == 1 {
+				return s
+			}
+		}
+
+		return ""
+	}
+
+	for _, step := range []struct {
+		elapsed  time.Duration
+		up       bool
+		requests int32
+		state    string
+	}{
+		{0, false, 1, circuitClosed},
+		{10 * time.Second, false, 2, circuitOpen},
+		{10 * time.Second, false, 2, circuitOpen},   // skipped during the cooldown
+		{time.Minute, false, 3, circuitOpen},        // the probe failed
+		{time.Minute, true, 5, circuitClosed},       // the probe succeeded
+		{10 * time.Second, false, 6, circuitClosed}, // the failures start again from zero
+	} {
+		now = now.Add(step.elapsed)
+
+		if step.up {
+			atomic.StoreInt32(&down, 0)
+		} else {
+			atomic.StoreInt32(&down, 1)
+		}
+
+		testutil.CollectAndCount(e)
+
+		if n := atomic.LoadInt32(&requests); n != step.requests {
+			t.Errorf("Expected %d requests after %v, got %d", step.requests, step.elapsed, n)
+		}
+
+		if s := state(); s != step.state {
+			t.Errorf("Expected the circuit to be %s, got %s", step.state, s)
+		}
+	}
+}
+
+func TestRejectedCredentialsDontOpenTheCircuit(t *testing.T) {
+	c := newCircuitBreaker(1, time.Minute)
+
+	if c.failed(time.Now(), &scrapeError{reason: failureReasonAuth}) {
+		t.Error("Expected rejected credentials not to open the circuit")
+	}
+
+	var disabled *circuitBreaker
+
+	if !disabled.allow(time.Now()) || disabled.failed(time.Now(), &scrapeError{reason: failureReasonNetwork}) {
+		t.Error("Expected a disabled circuit breaker never to open")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The subcommands, with what they do for the usage message. serve is the default, so that the
+// exporter can still be run with just flags.
+var subcommands = []struct {
+	name, description string
+}{
+	{"serve", "Serve the metrics, the default"},
+	{"check", "Check the rate limit once, print it and exit, like -once"},
+	{"validate-config", "Check the flags and -config.file, and exit non-zero if they're invalid"},
+	{"dashboard", "Write a Grafana dashboard for the metrics that the flags would export"},
+	{"export", "Write the polls in -history-db as CSV, for spreadsheets and offline analysis"},
+	{"metrics-lint", "Print the metrics that the flags would export, to lint them"},
+	{"creds-verify", "Check a secret against the credentials a running exporter uses"},
+	{"version", "Print the version and exit"},
+}
+
+// subcommand splits the command line arguments into the subcommand and its own arguments. Without
+// a subcommand, or with flags first, it's serve. It returns an error for an unknown subcommand.
+func subcommand(args []string) (string, []string, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return "serve", args, nil
+	}
+
+	for _, s := range subcommands {
+		if s.name == args[0] {
+			return args[0], args[1:], nil
+		}
+	}
+
+	return "", nil, fmt.Errorf("unknown subcommand %q", args[0])
+}
+
+// printSubcommands writes the subcommands, for the usage message.
+func printSubcommands(w io.Writer) {
+	fmt.Fprintln(w, "Subcommands:")
+
+	for _, s := range subcommands {
+		fmt.Fprintf(w, "  %-18s%s\n", s.name, s.description)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSubcommandsDefaultToServe(t *testing.T) {
+	for _, test := range []struct {
+		args    []string
+		command string
+		rest    []string
+	}{
+		{nil, "serve", nil},
+		{[]string{"-once", "-threshold=20"}, "serve", []string{"-once", "-threshold=20"}},
+		{[]string{"serve", "-web.listen-address=:9090"}, "serve", []string{"-web.listen-address=:9090"}},
+		{[]string{"check", "-threshold=20"}, "check", []string{"-threshold=20"}},
+		{[]string{"version"}, "version", []string{}},
+	} {
+		command, rest, err := subcommand(test.args)
+
+		if err != nil {
+			t.Fatalf("Unexpected error for %v: %v", test.args, err)
+		}
+
+		if command != test.command || len(rest) != len(test.rest) || (len(rest) > 0 && !reflect.DeepEqual(rest, test.rest)) {
+			t.Errorf("Expected %v to be %s %v, got %s %v", test.args, test.command, test.rest, command, rest)
+		}
+	}
+
+	if _, _, err := subcommand([]string{"sevre"}); err == nil {
+		t.Error("Expected an error for an unknown subcommand")
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Phases of a request to Docker Hub, as the phase label of the client metrics
+const (
+	clientPhaseDNS       = "dns"
+	clientPhaseConnect   = "connect"
+	clientPhaseTLS       = "tls"
+	clientPhaseFirstByte = "first_byte"
+)
+
+// clientMetrics time the requests to Docker Hub, and each phase of them, so that a slow poll can
+// be put down to a slow resolver, network, TLS handshake or Docker Hub itself. Like
+// contentionMetrics, they're about the exporter rather than Docker Hub's rate limits, so they're
+// kept apart from the exporter's own metrics.
+type clientMetrics struct {
+	requests *prometheus.HistogramVec
+	phases   *prometheus.HistogramVec
+	inFlight prometheus.Gauge
+}
+
+func newClientMetrics() *clientMetrics {
+	return &clientMetrics{
+		requests: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "exporter_client_request_duration_seconds",
+			Help:      "How long requests to Docker Hub took, by response code and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"code", "method"}),
+		phases: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "exporter_client_phase_duration_seconds",
+			Help:      "How long each phase of the requests to Docker Hub took: dns, connect, tls, or first_byte from the start of the request.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+		}, []string{"phase"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "exporter_client_requests_in_flight",
+			Help:      "Number of requests to Docker Hub in progress.",
+		}),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *clientMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.requests.Describe(ch)
+	m.phases.Describe(ch)
+	m.inFlight.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *clientMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.requests.Collect(ch)
+	m.phases.Collect(ch)
+	m.inFlight.Collect(ch)
+}
+
+// instrument returns a copy of client whose requests are recorded in m.
+func (m *clientMetrics) instrument(client *http.Client) *http.Client {
+	transport := client.Transport
+
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	instrumented := *client
+	instrumented.Transport = promhttp.InstrumentRoundTripperInFlight(m.inFlight,
+		promhttp.InstrumentRoundTripperDuration(m.requests, m.traced(transport)))
+
+	return &instrumented
+}
+
+// traced returns a RoundTripper which times the phases of each request made with next. Phases
+// which don't happen, eg connecting when an idle connection is reused, aren't recorded.
+func (m *clientMetrics) traced(next http.RoundTripper) promhttp.RoundTripperFunc {
+	return func(r *http.Request) (*http.Response, error) {
+		var mu sync.Mutex
+		var dnsStart, tlsStart time.Time
+		connectStarts := map[string]time.Time{} // by address, since they can be dialled in parallel
+
+		observe := func(phase string, since time.Time) {
+			m.phases.WithLabelValues(phase).Observe(time.Since(since).Seconds())
+		}
+
+		start := time.Now()
+		trace := &httptrace.ClientTrace{
+			DNSStart: func(httptrace.DNSStartInfo) {
+				mu.Lock()
+				dnsStart = time.Now()
+				mu.Unlock()
+			},
+			DNSDone: func(info httptrace.DNSDoneInfo) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				if info.Err == nil && !dnsStart.IsZero() {
+					observe(clientPhaseDNS, dnsStart)
+				}
+			},
+			ConnectStart: func(network, address string) {
+				mu.Lock()
+				connectStarts[address] = time.Now()
+				mu.Unlock()
+			},
+			ConnectDone: func(network, address string, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				if started, ok := connectStarts[address]; ok && err == nil {
+					observe(clientPhaseConnect, started)
+				}
+			},
+			TLSHandshakeStart: func() {
+				mu.Lock()
+				tlsStart = time.Now()
+				mu.Unlock()
+			},
+			TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				if err == nil && !tlsStart.IsZero() {
+					observe(clientPhaseTLS, tlsStart)
+				}
+			},
+			GotFirstResponseByte: func() {
+				observe(clientPhaseFirstByte, start)
+			},
+		}
+
+		return next.RoundTrip(r.WithContext(httptrace.WithClientTrace(r.Context(), trace)))
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestEachPhaseOfARequestIsTimed(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// Go by name, so that the name has to be resolved, and check the certificate against its name
+	base := server.Client()
+	base.Transport.(*http.Transport).TLSClientConfig.ServerName = "example.com"
+
+	m := newClientMetrics()
+	client := m.instrument(base)
+	url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	for i := 0; i < 2; i++ {
+		res, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res.Body.Close()
+	}
+
+	// The second request reuses the first's connection, so only its first byte is timed
+	for phase, expected := range map[string]uint64{
+		clientPhaseDNS:       1,
+		clientPhaseConnect:   1,
+		clientPhaseTLS:       1,
+		clientPhaseFirstByte: 2,
+	} {
+		var metric dto.Metric
+		if err := m.phases.WithLabelValues(phase).(prometheus.Histogram).Write(&metric); err != nil {
+			t.Fatal(err)
+		}
+
+		if count := metric.Histogram.GetSampleCount(); count != expected {
+			t.Errorf("Expected %s to be timed %d times, got %d", phase, expected, count)
+		}
+	}
+
+	if n := testutil.CollectAndCount(m.requests); n != 1 {
+		t.Errorf("Expected one series of request durations, for GETs with a 200, got %d", n)
+	}
+
+	if n := testutil.ToFloat64(m.inFlight); n != 0 {
+		t.Errorf("Expected no requests in flight, got %v", n)
+	}
+}
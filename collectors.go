@@ -0,0 +1,15 @@
+package main
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// unregisterRuntimeCollectors takes the Go runtime collector, the process collector, or both, out
+// of reg, which the default registry comes with, for a more minimal exposition.
+func unregisterRuntimeCollectors(reg prometheus.Registerer, goRuntime bool, process bool) {
+	if goRuntime {
+		reg.Unregister(prometheus.NewGoCollector())
+	}
+
+	if process {
+		reg.Unregister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+	}
+}
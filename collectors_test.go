@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRuntimeCollectorsCanBeTurnedOff(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGoCollector())
+	registry.MustRegister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+
+	unregisterRuntimeCollectors(registry, true, false)
+
+	families, err := registry.Gather()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, family := range families {
+		if strings.HasPrefix(family.GetName(), "go_") {
+			t.Errorf("Expected no Go runtime metrics, got %s", family.GetName())
+		}
+	}
+
+	unregisterRuntimeCollectors(registry, false, true)
+
+	if families, _ := registry.Gather(); len(families) != 0 {
+		t.Errorf("Expected no metrics, got %d families", len(families))
+	}
+}
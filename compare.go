@@ -0,0 +1,22 @@
+package main
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Values of the auth label with -compare-anonymous
+const (
+	authAuthenticated = "authenticated"
+	authAnonymous     = "anonymous"
+)
+
+// registerComparison registers two exporters which poll the same repositories, one with
+// credentials and one without, labelling their metrics with auth="authenticated" or
+// auth="anonymous" so that they can be told apart. Docker Hub counts anonymous requests against
+// the IP address, so the anonymous one shows what's left for unauthenticated workloads sharing
+// our egress IP.
+func registerComparison(reg prometheus.Registerer, authenticated, anonymous *Exporter) error {
+	if err := prometheus.WrapRegistererWith(prometheus.Labels{"auth": authAuthenticated}, reg).Register(authenticated); err != nil {
+		return err
+	}
+
+	return prometheus.WrapRegistererWith(prometheus.Labels{"auth": authAnonymous}, reg).Register(anonymous)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestComparisonLabelsAuthenticatedAndAnonymousMetrics(t *testing.T) {
+	// The account has a bigger limit than anonymous pulls from the same IP
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := "anonymous"
+		if _, _, ok := r.BasicAuth(); ok {
+			token = "authenticated"
+		}
+
+		_, _ = w.Write(registrytest.TokenResponse(token, time.Now()))
+	}))
+	defer auth.Close()
+
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer authenticated" {
+			w.Header().Set("RateLimit-Limit", "5000;w=86400")
+			w.Header().Set("RateLimit-Remaining", "4900;w=86400")
+		} else {
+			w.Header().Set("RateLimit-Limit", "100;w=21600")
+			w.Header().Set("RateLimit-Remaining", "12;w=21600")
+		}
+	}))
+	defer registry.Close()
+
+	reg := prometheus.NewRegistry()
+	err := registerComparison(reg,
+		NewExporter(auth.URL, registry.URL, []string{defaultRepository}, &credentials{username: "username", passphrase: "password"}),
+		NewExporter(auth.URL, registry.URL, []string{defaultRepository}, nil))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `
+# HELP dockerhub_limit_remaining_requests_total Docker Hub Rate Limit Remaining Requests
+# TYPE dockerhub_limit_remaining_requests_total gauge
+dockerhub_limit_remaining_requests_total{auth="anonymous",repository="ratelimitpreview/test"} 12
+dockerhub_limit_remaining_requests_total{auth="authenticated",repository="ratelimitpreview/test"} 4900
+`
+
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "dockerhub_limit_remaining_requests_total"); err != nil {
+		t.Fatal(err)
+	}
+}
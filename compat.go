@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// The metric naming schemes for -metrics.compat
+const (
+	compatLegacy = "legacy" // the original names
+	compatBoth   = "both"   // both sets of names, while dashboards and alerts are migrated
+	compatV2     = "v2"     // names which follow the Prometheus naming conventions
+)
+
+// v2MetricNames are the names of the metrics which were renamed in v2 to follow the Prometheus
+// naming conventions, by their legacy names. Every other metric keeps its name.
+var v2MetricNames = map[string]string{
+	// Gauges shouldn't end in _total, which is for counters
+	"dockerhub_limit_remaining_requests_total": "dockerhub_limit_remaining_requests",
+	"dockerhub_limit_max_requests_total":       "dockerhub_limit_max_requests",
+}
+
+// legacyMetricNames are the legacy names of the metrics which the exporter gives their v2 names
+// itself, by their v2 names, so that the legacy names only come from -metrics.compat.
+var legacyMetricNames = map[string]string{
+	// _created is reserved by OpenMetrics for the created timestamps of counters, and timestamps
+	// should say that they're in seconds
+	"dockerhub_limit_consumed_requests_start_timestamp_seconds": "dockerhub_limit_consumed_requests_created",
+}
+
+// namespacePattern matches the valid -namespace values, which have to make valid metric names.
+var namespacePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func parseCompat(flag string) (string, error) {
+	switch flag {
+	case compatLegacy, compatBoth, compatV2:
+		return flag, nil
+	default:
+		return "", fmt.Errorf("-metrics.compat should be %s, %s or %s", compatLegacy, compatBoth, compatV2)
+	}
+}
+
+// compatGatherer gathers from g, and renames the metrics in v2MetricNames and legacyMetricNames
+// as compat says, or exports them under both names. It must come after anything which changes the
+// series, since with both names they're shared by the two families.
+func compatGatherer(g prometheus.Gatherer, compat string) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+		var renamed []*dto.MetricFamily
+
+		for _, mf := range families {
+			var name string
+			var ok bool
+
+			switch compat {
+			case compatV2:
+				name, ok = v2MetricNames[mf.GetName()]
+			case compatBoth:
+				if name, ok = v2MetricNames[mf.GetName()]; !ok {
+					name, ok = legacyMetricNames[mf.GetName()]
+				}
+			default:
+				name, ok = legacyMetricNames[mf.GetName()]
+			}
+
+			if !ok {
+				renamed = append(renamed, mf)
+				continue
+			}
+
+			if compat == compatBoth {
+				renamed = append(renamed, mf)
+			}
+
+			renamed = append(renamed, &dto.MetricFamily{Name: &name, Help: mf.Help, Type: mf.Type, Metric: mf.Metric})
+		}
+
+		sort.Slice(renamed, func(i, j int) bool { return renamed[i].GetName() < renamed[j].GetName() })
+
+		return renamed, err
+	})
+}
+
+// inNamespace returns name, one of the exporter's metric names, in the namespace ns instead of
+// dockerhub, as -namespace exports it. Other names, and every name with an empty ns, are unchanged.
+func inNamespace(name string, ns string) string {
+	if ns == "" || !strings.HasPrefix(name, namespace+"_") {
+		return name
+	}
+
+	return ns + strings.TrimPrefix(name, namespace)
+}
+
+// namespaceGatherer gathers from g, and moves the exporter's metrics into the namespace ns. It must
+// come last, since the other gatherers go by the exporter's own names.
+func namespaceGatherer(g prometheus.Gatherer, ns string) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+		renamed := make([]*dto.MetricFamily, 0, len(families))
+
+		for _, mf := range families {
+			name := inNamespace(mf.GetName(), ns)
+			renamed = append(renamed, &dto.MetricFamily{Name: &name, Help: mf.Help, Type: mf.Type, Metric: mf.Metric})
+		}
+
+		sort.Slice(renamed, func(i, j int) bool { return renamed[i].GetName() < renamed[j].GetName() })
+
+		return renamed, err
+	})
+}
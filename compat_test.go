@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsCanBeExportedWithV2Names(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	hub.SetRateLimit(100, 76)
+
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+	e.scrape(context.Background(), e.targets[0], time.Now())
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(e.remaining)
+
+	legacy := `
+# HELP dockerhub_limit_remaining_requests_total Docker Hub Rate Limit Remaining Requests
+# TYPE dockerhub_limit_remaining_requests_total gauge
+dockerhub_limit_remaining_requests_total{env="prod",repository="ratelimitpreview/test"} 76
+`
+	v2 := `
+# HELP dockerhub_limit_remaining_requests Docker Hub Rate Limit Remaining Requests
+# TYPE dockerhub_limit_remaining_requests gauge
+dockerhub_limit_remaining_requests{env="prod",repository="ratelimitpreview/test"} 76
+`
+
+	for compat, expected := range map[string]string{
+		compatLegacy: legacy,
+		compatV2:     v2,
+		compatBoth:   legacy + v2,
+	} {
+		args := &arguments{constLabels: prometheus.Labels{"env": "prod"}, compat: compat}
+		g := args.wrapGatherer(registry)
+
+		err := testutil.GatherAndCompare(g, strings.NewReader(expected),
+			"dockerhub_limit_remaining_requests_total", "dockerhub_limit_remaining_requests")
+
+		if err != nil {
+			t.Errorf("%s: %v", compat, err)
+		}
+	}
+
+	args := &arguments{constLabels: prometheus.Labels{"env": "prod"}, compat: compatV2, metricsNamespace: "edge"}
+	namespaced := strings.Replace(v2, "dockerhub_", "edge_", -1)
+
+	if err := testutil.GatherAndCompare(args.wrapGatherer(registry), strings.NewReader(namespaced), "edge_limit_remaining_requests"); err != nil {
+		t.Errorf("With -namespace: %v", err)
+	}
+
+	start := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "dockerhub",
+		Name:      "limit_consumed_requests_start_timestamp_seconds",
+		Help:      "Docker Hub Rate Limit Consumption Start",
+	})
+	start.Set(1600000000)
+
+	registry = prometheus.NewRegistry()
+	registry.MustRegister(start)
+
+	legacy = `
+# HELP dockerhub_limit_consumed_requests_created Docker Hub Rate Limit Consumption Start
+# TYPE dockerhub_limit_consumed_requests_created gauge
+dockerhub_limit_consumed_requests_created 1.6e+09
+`
+	v2 = `
+# HELP dockerhub_limit_consumed_requests_start_timestamp_seconds Docker Hub Rate Limit Consumption Start
+# TYPE dockerhub_limit_consumed_requests_start_timestamp_seconds gauge
+dockerhub_limit_consumed_requests_start_timestamp_seconds 1.6e+09
+`
+
+	for compat, expected := range map[string]string{
+		compatLegacy: legacy,
+		compatV2:     v2,
+		compatBoth:   legacy + v2,
+	} {
+		args := &arguments{compat: compat}
+
+		err := testutil.GatherAndCompare(args.wrapGatherer(registry), strings.NewReader(expected),
+			"dockerhub_limit_consumed_requests_created", "dockerhub_limit_consumed_requests_start_timestamp_seconds")
+
+		if err != nil {
+			t.Errorf("%s: %v", compat, err)
+		}
+	}
+
+	if _, err := parseCompat("v3"); err == nil {
+		t.Error("Expected an unknown naming scheme to be rejected")
+	}
+}
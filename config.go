@@ -0,0 +1,372 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configFile is the configuration read from -config.file: the values of flags, by flag name.
+//
+// The file is YAML, but only as much of it as flags need: keys with a value, a list of values for
+// flags which can be repeated, and nested keys for the flags with dots in their names, so that
+//
+//	web:
+//	  listen-address:
+//	    - :9090
+//	repository: [library/alpine, library/nginx]
+//	token: ${DOCKERHUB_TOKEN}
+//
+// sets -web.listen-address once, -repository twice, and -token from the environment.
+type configFile map[string][]string
+
+// configEnvPattern matches the ${VAR} references to the environment in a value.
+var configEnvPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+func readConfigFile(path string) (configFile, error) {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := parseConfigFile(string(data), os.LookupEnv)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// parseConfigFile parses the configuration, interpolating the ${VAR} references with lookup.
+func parseConfigFile(data string, lookup func(string) (string, bool)) (configFile, error) {
+	type parent struct {
+		indent int
+		key    string
+	}
+
+	config := configFile{}
+
+	var (
+		parents []parent // the keys without values that the following lines are nested in
+		list    string   // the key that - items belong to
+		empty   = map[string]int{}
+	)
+
+	for n, line := range strings.Split(data, "\n") {
+		content := strings.TrimSpace(stripConfigComment(line))
+
+		if content == "" || content == "---" {
+			continue
+		}
+
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+
+		if strings.HasPrefix(strings.TrimLeft(line, " "), "\t") {
+			return nil, fmt.Errorf("line %d: indent with spaces, not tabs", n+1)
+		}
+
+		if content == "-" || strings.HasPrefix(content, "- ") {
+			if list == "" {
+				return nil, fmt.Errorf("line %d: list item without a key", n+1)
+			}
+
+			value, err := parseConfigValue(strings.TrimSpace(content[1:]), lookup)
+
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+
+			config[list] = append(config[list], value)
+			delete(empty, list)
+			continue
+		}
+
+		for len(parents) > 0 && parents[len(parents)-1].indent >= indent {
+			parents = parents[:len(parents)-1]
+		}
+
+		i := strings.Index(content, ":")
+
+		if i <= 0 {
+			return nil, fmt.Errorf("line %d: expected key: value", n+1)
+		}
+
+		key := strings.TrimSpace(content[:i])
+		rest := strings.TrimSpace(content[i+1:])
+
+		if len(parents) > 0 {
+			key = parents[len(parents)-1].key + "." + key
+			delete(empty, parents[len(parents)-1].key)
+		}
+
+		if _, ok := config[key]; ok {
+			return nil, fmt.Errorf("line %d: %s is given more than once", n+1, key)
+		}
+
+		list = ""
+
+		switch {
+		case rest == "":
+			parents = append(parents, parent{indent: indent, key: key})
+			list = key
+			empty[key] = n + 1
+		case strings.HasPrefix(rest, "[") && strings.HasSuffix(rest, "]"):
+			items, err := splitFlowSequence(rest[1 : len(rest)-1])
+
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+
+			config[key] = []string{}
+
+			for _, item := range items {
+				if item = strings.TrimSpace(item); item == "" {
+					continue
+				}
+
+				value, err := parseConfigValue(item, lookup)
+
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", n+1, err)
+				}
+
+				config[key] = append(config[key], value)
+			}
+		default:
+			value, err := parseConfigValue(rest, lookup)
+
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+
+			config[key] = []string{value}
+		}
+	}
+
+	// The first key without a value, for a stable error
+	first := ""
+	for key, line := range empty {
+		if first == "" || line < empty[first] {
+			first = key
+		}
+	}
+
+	if first != "" {
+		return nil, fmt.Errorf("line %d: %s has no value", empty[first], first)
+	}
+
+	return config, nil
+}
+
+// parseConfigValue unquotes a value, and interpolates its ${VAR} references with lookup. Those
+// are interpolated after unquoting, so that whatever is in the environment is taken as it is.
+func parseConfigValue(value string, lookup func(string) (string, bool)) (string, error) {
+	switch {
+	case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+		unquoted, err := strconv.Unquote(value)
+
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted value %s", value)
+		}
+
+		value = unquoted
+	case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+		value = strings.Replace(value[1:len(value)-1], "''", "'", -1)
+	}
+
+	var missing []string
+
+	value = configEnvPattern.ReplaceAllStringFunc(value, func(ref string) string {
+		name := configEnvPattern.FindStringSubmatch(ref)[1]
+		v, ok := lookup(name)
+
+		if !ok {
+			missing = append(missing, name)
+		}
+
+		return v
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("$%s is not set", strings.Join(missing, ", $"))
+	}
+
+	return value, nil
+}
+
+// splitFlowSequence splits the items of a [a, b] list, between the brackets, on the commas which
+// aren't quoted, so that a quoted item can have commas in it, eg group labels.
+func splitFlowSequence(s string) ([]string, error) {
+	var (
+		items []string
+		quote rune
+		start int
+	)
+
+	for i, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote && !escapedConfigQuote(s, i) {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in [%s]", s)
+	}
+
+	return append(items, s[start:]), nil
+}
+
+// escapedConfigQuote returns whether the " at i in s is escaped with a backslash, within a double
+// quoted value.
+func escapedConfigQuote(s string, i int) bool {
+	backslashes := 0
+	for j := i - 1; j >= 0 && s[j] == '\\'; j-- {
+		backslashes++
+	}
+
+	return s[i] == '"' && backslashes%2 == 1
+}
+
+// stripConfigComment removes a # comment from the end of line, unless it's quoted.
+func stripConfigComment(line string) string {
+	var quote rune
+
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+
+	return line
+}
+
+// hasCredentials returns whether the credentials are set by the configuration, rather than by any
+// of the flags given on the command line.
+func (c configFile) hasCredentials(fs *flag.FlagSet) bool {
+	given := false
+	fs.Visit(func(f *flag.Flag) {
+		given = given || f.Name == "user" || f.Name == "pass" || f.Name == "token"
+	})
+
+	return !given && len(c["user"]) > 0 && (len(c["pass"]) > 0 || len(c["token"]) > 0)
+}
+
+// configFileCredentials reads the credentials from -config.file again, so that reloading picks up
+// new ones. The other flags can't change without a restart, so changes to them are only logged.
+type configFileCredentials struct {
+	path   string
+	loaded configFile
+}
+
+func (c *configFileCredentials) String() string {
+	return c.path
+}
+
+func (c *configFileCredentials) read() (*credentials, string, error) {
+	config, err := readConfigFile(c.path)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, name := range config.changed(c.loaded) {
+		if name != "user" && name != "pass" && name != "token" {
+			fmt.Printf("%s has changed in %s, which needs a restart to take effect\n", name, c.path)
+		}
+	}
+
+	if len(config["user"]) == 0 || (len(config["pass"]) == 0 && len(config["token"]) == 0) {
+		return nil, "", fmt.Errorf("%s no longer has user with pass or token", c.path)
+	}
+
+	creds := &credentials{username: lastConfigValue(config["user"])}
+
+	if len(config["token"]) > 0 {
+		creds.passphrase = lastConfigValue(config["token"])
+	} else {
+		creds.passphrase = lastConfigValue(config["pass"])
+	}
+
+	return creds, creds.fingerprint(), nil
+}
+
+// changed returns the keys which are different in c than in previous, in order.
+func (c configFile) changed(previous configFile) []string {
+	var names []string
+
+	for name, values := range c {
+		if !reflect.DeepEqual(values, previous[name]) {
+			names = append(names, name)
+		}
+	}
+
+	for name := range previous {
+		if _, ok := c[name]; !ok {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// lastConfigValue returns the last of values, which a flag that isn't repeatable ends up with.
+func lastConfigValue(values []string) string {
+	return values[len(values)-1]
+}
+
+// apply sets the flags in fs from the configuration, apart from those given on the command line,
+// which take precedence. It returns an error for a key which isn't a flag, or an invalid value.
+func (c configFile) apply(fs *flag.FlagSet) error {
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if fs.Lookup(name) == nil || name == "config.file" {
+			return fmt.Errorf("%s isn't a flag which can be configured", name)
+		}
+
+		if given[name] {
+			continue
+		}
+
+		for _, value := range c[name] {
+			if err := fs.Set(name, value); err != nil {
+				return fmt.Errorf("invalid value for %s: %w", name, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfigFileIsParsed(t *testing.T) {
+	env := map[string]string{"DOCKERHUB_TOKEN": "dckr_pat_s3cr#t"}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	config, err := parseConfigFile(`---
+# The exporter's configuration
+web:
+  listen-address:
+    - :9090
+    - unix:///run/dockerhub-exporter.sock
+  telemetry-path: /metrics # the default
+  tls-cert-file: /etc/dockerhub_exporter/tls.crt
+  tls-key-file: /etc/dockerhub_exporter/tls.key
+repository: [library/alpine, 'library/nginx{team="web"}']
+user: "jabley"
+token: ${DOCKERHUB_TOKEN}
+timeout: 3s
+`, lookup)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := configFile{
+		"web.listen-address": {":9090", "unix:///run/dockerhub-exporter.sock"},
+		"web.telemetry-path": {"/metrics"},
+		"web.tls-cert-file":  {"/etc/dockerhub_exporter/tls.crt"},
+		"web.tls-key-file":   {"/etc/dockerhub_exporter/tls.key"},
+		"repository":         {"library/alpine", `library/nginx{team="web"}`},
+		"user":               {"jabley"},
+		"token":              {"dckr_pat_s3cr#t"},
+		"timeout":            {"3s"},
+	}
+
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("Expected %v, got %v", expected, config)
+	}
+}
+
+func TestQuotedItemsInFlowListsCanHaveCommas(t *testing.T) {
+	lookup := func(string) (string, bool) { return "", false }
+
+	config, err := parseConfigFile(`repository: ['library/alpine{team="web",env="prod"}', "library/nginx{team=\"a,b\"}", library/redis]`, lookup)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := configFile{"repository": {`library/alpine{team="web",env="prod"}`, `library/nginx{team="a,b"}`, "library/redis"}}
+
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("Expected %v, got %v", expected, config)
+	}
+}
+
+func TestInvalidConfigFilesAreRejected(t *testing.T) {
+	lookup := func(string) (string, bool) { return "", false }
+
+	for _, data := range []string{
+		"token: ${MISSING}",
+		"- library/alpine",
+		"repository:",
+		"timeout: 3s\ntimeout: 5s",
+		"\ttimeout: 3s",
+		"just a line",
+		`repository: ["library/alpine, library/nginx]`,
+	} {
+		if _, err := parseConfigFile(data, lookup); err == nil {
+			t.Errorf("Expected an error parsing %q", data)
+		}
+	}
+}
+
+func TestCommandLineFlagsTakePrecedenceOverTheConfigFile(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	timeout := fs.Duration("timeout", 5*time.Second, "")
+	user := fs.String("user", "", "")
+	var repositories stringsFlag
+	fs.Var(&repositories, "repository", "")
+
+	if err := fs.Parse([]string{"-timeout=1s"}); err != nil {
+		t.Fatal(err)
+	}
+
+	config := configFile{"timeout": {"3s"}, "user": {"jabley"}, "repository": {"library/alpine", "library/nginx"}}
+
+	if err := config.apply(fs); err != nil {
+		t.Fatal(err)
+	}
+
+	if *timeout != time.Second || *user != "jabley" || len(repositories) != 2 {
+		t.Errorf("Expected -timeout from the command line and the rest from the file, got %v %q %v", *timeout, *user, repositories)
+	}
+
+	if err := (configFile{"bogus": {"1"}}).apply(fs); err == nil {
+		t.Error("Expected an error for a key which isn't a flag")
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Duration("timeout", 5*time.Second, "")
+
+	if err := (configFile{"timeout": {"soon"}}).apply(fs); err == nil {
+		t.Error("Expected an error for an invalid value")
+	}
+}
+
+func TestReloadingReadsTheCredentialsFromTheConfigFileAgain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dockerhub_exporter.yml")
+	if err := ioutil.WriteFile(path, []byte("user: jabley\ntoken: dckr_pat_old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := readConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("user", "", "")
+	fs.String("token", "", "")
+
+	if !config.hasCredentials(fs) {
+		t.Fatal("Expected the credentials to be from the config file")
+	}
+
+	if err := fs.Parse([]string{"-user=someone"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.hasCredentials(fs) {
+		t.Error("Expected the credentials on the command line to take precedence over the config file")
+	}
+
+	loaded := &credentials{username: "jabley", passphrase: "dckr_pat_old"}
+	e := NewExporter("http://localhost:0", "http://localhost:0", []string{defaultRepository}, loaded)
+	w := &credentialsWatcher{exporter: e, source: &configFileCredentials{path: path, loaded: config}, version: loaded.fingerprint()}
+
+	if err := ioutil.WriteFile(path, []byte("user: jabley\ntoken: dckr_pat_new\ntimeout: 3s\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c := e.currentCredentials(); c.passphrase != "dckr_pat_new" {
+		t.Errorf("Expected the new token from the config file, got %+v", c)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("user: jabley\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.reload(); err == nil {
+		t.Error("Expected an error reloading a config file without credentials")
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+// observeConsumption counts the requests consumed from the rate limit since t was last polled, as a
+// counter, which is easier to use with rate() and increase() than the remaining requests gauge.
+func (e *Exporter) observeConsumption(t *target, remaining float64) {
+	// The series should exist from the first poll, so that increase() sees the first consumption
+	consumed := e.pullsConsumed.WithLabelValues(t.repository)
+
+	// Only count decreases. An increase means that earlier requests have dropped out of the window,
+	// and the window resetting doesn't mean that any requests were made.
+	if t.hasRemaining && remaining < t.lastRemaining {
+		consumed.Add(t.lastRemaining - remaining)
+		t.pullsConsumed += t.lastRemaining - remaining
+	}
+}
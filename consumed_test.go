@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPullsConsumedCountsDecreasesAcrossWindowResets(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+
+	for _, remaining := range []int{100, 90, 95, 80} {
+		hub.SetRateLimit(100, remaining)
+		e.scrape(context.Background(), e.targets[0], time.Now())
+	}
+
+	if consumed := testutil.ToFloat64(e.pullsConsumed.WithLabelValues(defaultRepository)); consumed != 25 {
+		t.Errorf("Expected 10 then 15 pulls to be consumed, got %v", consumed)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// contentionMetrics show how much collects and the API wait for each other, to see whether the
+// locking needs changing, and whether a change helped. They're kept apart from the exporter's own
+// metrics since they're about the exporter rather than Docker Hub.
+type contentionMetrics struct {
+	lockWait         *prometheus.HistogramVec
+	collectsInFlight prometheus.Gauge
+}
+
+func newContentionMetrics() *contentionMetrics {
+	return &contentionMetrics{
+		lockWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "exporter_lock_wait_seconds",
+			Help:      "How long was spent waiting for the exporter's lock, for reading or writing.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+		}, []string{"mode"}),
+		collectsInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "exporter_collects_in_flight",
+			Help:      "Number of collects of the exporter's metrics in progress.",
+		}),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *contentionMetrics) Describe(ch chan<- *prometheus.Desc) {
+	c.lockWait.Describe(ch)
+	c.collectsInFlight.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *contentionMetrics) Collect(ch chan<- prometheus.Metric) {
+	c.lockWait.Collect(ch)
+	c.collectsInFlight.Collect(ch)
+}
+
+// lock locks e for writing, and records how long that took.
+func (e *Exporter) lock() {
+	start := time.Now()
+	e.mu.Lock()
+	e.contention.lockWait.WithLabelValues("write").Observe(time.Since(start).Seconds())
+}
+
+// rlock locks e for reading, and records how long that took.
+func (e *Exporter) rlock() {
+	start := time.Now()
+	e.mu.RLock()
+	e.contention.lockWait.WithLabelValues("read").Observe(time.Since(start).Seconds())
+}
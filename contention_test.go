@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestLockWaitsAndCollectsInFlightAreMeasured(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+
+	// Hold the lock, as a long poll would, while a collect and a status request wait for it
+	e.lock()
+
+	collected := make(chan struct{})
+	go func() {
+		testutil.CollectAndCount(e)
+		close(collected)
+	}()
+
+	statused := make(chan struct{})
+	go func() {
+		e.status()
+		close(statused)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+
+	if n := testutil.ToFloat64(e.contention.collectsInFlight); n != 1 {
+		t.Errorf("Expected 1 collect in flight, got %v", n)
+	}
+
+	e.mu.Unlock()
+	<-collected
+	<-statused
+
+	if n := testutil.ToFloat64(e.contention.collectsInFlight); n != 0 {
+		t.Errorf("Expected no collects in flight, got %v", n)
+	}
+
+	var m dto.Metric
+	if err := e.contention.lockWait.WithLabelValues("read").(prometheus.Histogram).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Histogram.GetSampleCount() < 2 || m.Histogram.GetSampleSum() < 0.02 {
+		t.Errorf("Expected the waits for the read lock to be recorded, got %v", m.Histogram)
+	}
+}
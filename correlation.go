@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// defaultCorrelationHeader is the request header that each poll's scrape ID is sent to Docker Hub
+// in, so that it can be found in the logs of an egress proxy or, with Docker's help, Docker Hub.
+const defaultCorrelationHeader = "X-Correlation-ID"
+
+type scrapeIDKey struct{}
+
+// newScrapeID returns an ID for the scrape which s is the root span of. It's the trace ID when
+// tracing is turned on, so that the requests can be found in the traces too.
+func newScrapeID(s *span) string {
+	if s != nil {
+		return hex.EncodeToString(s.traceID[:])
+	}
+
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+
+	return hex.EncodeToString(id[:])
+}
+
+func withScrapeID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, scrapeIDKey{}, id)
+}
+
+// scrapeID returns the ID of the scrape that ctx belongs to, or empty if it isn't part of one.
+func scrapeID(ctx context.Context) string {
+	id, _ := ctx.Value(scrapeIDKey{}).(string)
+	return id
+}
+
+// lastScrapeInfo is what /debug/last-scrape says about the most recent poll of Docker Hub.
+type lastScrapeInfo struct {
+	ID              string    `json:"id"`
+	Repository      string    `json:"repository"`
+	Time            time.Time `json:"time"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Error           string    `json:"error,omitempty"`
+	Reason          string    `json:"reason,omitempty"` // the failureReason of Error
+}
+
+// lastScrapeHandler serves the lastScrapeInfo of e's most recent poll as JSON.
+func lastScrapeHandler(e *Exporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		e.rlock()
+		last := e.lastScrapeInfo
+		e.mu.RUnlock()
+
+		if last == nil {
+			http.Error(w, "Docker Hub hasn't been polled yet", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(last)
+	}
+}
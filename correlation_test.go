@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScrapeIDIsSentToDockerHubAndServed(t *testing.T) {
+	var mu sync.Mutex
+	var ids []string
+
+	record := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			ids = append(ids, r.Header.Get("X-Request-ID"))
+			mu.Unlock()
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	authServer := httptest.NewServer(record(handler(&mockResponse{response: authResponseBody()})))
+	defer authServer.Close()
+
+	rateLimitServer := httptest.NewServer(record(handler(&mockResponse{headers: http.Header{
+		"Ratelimit-Limit":     []string{"100;w=21600"},
+		"Ratelimit-Remaining": []string{"76;w=21600"},
+	}})))
+	defer rateLimitServer.Close()
+
+	e := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository}, nil)
+	e.correlationHeader = "X-Request-ID"
+
+	w := httptest.NewRecorder()
+	lastScrapeHandler(e)(w, httptest.NewRequest("GET", "/debug/last-scrape", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 before the first scrape, got %d", w.Code)
+	}
+
+	now := time.Date(2020, 11, 16, 10, 0, 0, 0, time.UTC)
+	e.scrape(context.Background(), e.targets[0], now)
+
+	w = httptest.NewRecorder()
+	lastScrapeHandler(e)(w, httptest.NewRequest("GET", "/debug/last-scrape", nil))
+
+	var last lastScrapeInfo
+	if err := json.NewDecoder(w.Body).Decode(&last); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(last.ID) != 32 || last.Repository != defaultRepository || !last.Time.Equal(now) || last.Error != "" {
+		t.Errorf("Unexpected last scrape %+v", last)
+	}
+
+	if len(ids) != 2 || ids[0] != last.ID || ids[1] != last.ID {
+		t.Errorf("Expected both requests to carry the scrape ID %s, got %v", last.ID, ids)
+	}
+
+	e.scrape(context.Background(), e.targets[0], now)
+
+	if ids[2] == last.ID {
+		t.Errorf("Expected each scrape to have its own ID, got %s twice", last.ID)
+	}
+}
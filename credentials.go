@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// credentialsInfo is what the exporter will say about the credentials it is using. It never
+// includes the passphrase itself.
+type credentialsInfo struct {
+	Anonymous   bool   `json:"anonymous"`
+	Username    string `json:"username,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// fingerprint identifies the credentials, so that the exporter can tell when they change. It's
+// never served, since an unsalted hash of a passphrase can be cracked offline.
+func (c *credentials) fingerprint() string {
+	sum := sha256.Sum256([]byte(c.username + ":" + c.passphrase))
+	return "sha256:" + hex.EncodeToString(sum[:])[:16]
+}
+
+// keyedFingerprint identifies the credentials to whoever else holds key, without revealing them.
+// Without key, it can't be used to guess the passphrase either.
+func (c *credentials) keyedFingerprint(key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	_, _ = mac.Write([]byte(c.username + ":" + c.passphrase))
+
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// info returns what can be said about the credentials, with a fingerprint keyed with key, or none
+// if key is empty.
+func (c *credentials) info(key string) credentialsInfo {
+	if c == nil {
+		return credentialsInfo{Anonymous: true}
+	}
+
+	info := credentialsInfo{Username: c.username}
+
+	if key != "" {
+		info.Fingerprint = c.keyedFingerprint(key)
+	}
+
+	return info
+}
+
+// credentialsHandler serves the credentialsInfo for the credentials that e is using, with a
+// fingerprint keyed with key.
+func credentialsHandler(e *Exporter, key string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(e.currentCredentials().info(key))
+	}
+}
+
+// currentCredentials returns the credentials that e is using, which can change if they are rotated.
+func (e *Exporter) currentCredentials() *credentials {
+	e.rlock()
+	defer e.mu.RUnlock()
+
+	return e.credentials
+}
+
+// setCredentials makes e use c from now on, and forgets the tokens it got with the old ones.
+func (e *Exporter) setCredentials(c *credentials) {
+	e.lock()
+	defer e.mu.Unlock()
+
+	e.credentials = c
+
+	for _, t := range e.targets {
+		t.authToken = nil
+		t.tokenErr = nil
+	}
+}
+
+// rotatingCredentials is somewhere that credentials are read from which can change them.
+type rotatingCredentials interface {
+	fmt.Stringer
+
+	// read returns the credentials, and a version which changes whenever they do
+	read() (*credentials, string, error)
+}
+
+// credentialsWatcher gives an exporter the credentials from a rotatingCredentials whenever they are
+// rotated.
+type credentialsWatcher struct {
+	mu       sync.Mutex
+	exporter *Exporter
+	others   []*Exporter // which use the same credentials, eg from the other -source-address
+	source   rotatingCredentials
+	version  string // of the credentials that the exporter has
+}
+
+// watch checks the source every interval, forever.
+func (w *credentialsWatcher) watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := w.refresh(); err != nil {
+			fmt.Printf("Unable to check %s for new credentials: %v\n", w.source, err)
+		}
+	}
+}
+
+// refresh reads the credentials from the source, and gives the exporter them if they have changed.
+func (w *credentialsWatcher) refresh() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	c, version, err := w.source.read()
+
+	if err != nil {
+		return err
+	}
+
+	if version == w.version {
+		return nil
+	}
+
+	w.version = version
+
+	if current := w.exporter.currentCredentials(); current == nil || *current != *c {
+		fmt.Printf("Credentials in %s have changed, now using them for %s\n", w.source, c.username)
+		w.exporter.setCredentials(c)
+
+		for _, e := range w.others {
+			e.setCredentials(c)
+		}
+	}
+
+	return nil
+}
+
+// validateCredentials checks that Docker Hub accepts the credentials, by getting a token for each
+// target.
+func (e *Exporter) validateCredentials() error {
+	return e.fetchTokens()
+}
+
+// fetchTokens makes sure that each target has a usable token. The caller mustn't hold e.mu.
+func (e *Exporter) fetchTokens() error {
+	for _, t := range e.targets {
+		// Registry targets are polled anonymously
+		if t.registry != nil {
+			continue
+		}
+
+		polled, credentials := e.pollCopy(t)
+		_, err := e.fetchToken(context.Background(), polled)
+
+		e.lock()
+		e.keepAuth(t, polled, credentials)
+		e.mu.Unlock()
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", t.repository, err)
+		}
+	}
+
+	return nil
+}
+
+// Why the credentials are misconfigured, used as the `reason` label on the misconfiguration gauge.
+const (
+	credentialsMissing = "missing" // none were given
+	credentialsInvalid = "invalid" // Docker Hub rejected them
+)
+
+// enableSoftFailCredentials makes e poll anonymously when its credentials are missing or rejected,
+// rather than failing, so that the exporter can be rolled out before its secrets are. The problem
+// is reported by the misconfiguration gauge instead.
+func (e *Exporter) enableSoftFailCredentials() {
+	e.softFailCredentials = true
+
+	e.credentialsMisconfigured.WithLabelValues(credentialsInvalid).Set(0)
+	e.credentialsMisconfigured.WithLabelValues(credentialsMissing).Set(0)
+
+	if e.credentials == nil {
+		fmt.Println("Warning: no credentials were given, polling anonymously")
+		e.credentialsMisconfigured.WithLabelValues(credentialsMissing).Set(1)
+	}
+}
+
+// resolveSecret reads the secret named by ref, which is either "env:<variable>" or "file:<path>".
+func resolveSecret(ref string) (string, error) {
+	parts := strings.SplitN(ref, ":", 2)
+
+	if len(parts) != 2 {
+		return "", fmt.Errorf("secret reference %q should be env:<variable> or file:<path>", ref)
+	}
+
+	switch parts[0] {
+	case "env":
+		value, ok := os.LookupEnv(parts[1])
+
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", parts[1])
+		}
+
+		return value, nil
+	case "file":
+		b, err := ioutil.ReadFile(parts[1])
+
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimRight(string(b), "\r\n"), nil
+	default:
+		return "", fmt.Errorf("unknown secret store %q in %q", parts[0], ref)
+	}
+}
+
+// credsVerify implements the creds-verify subcommand. It checks that the running exporter at
+// -exporter-url is using the credentials from the -secret reference, returning the exit code.
+func credsVerify(args []string) int {
+	var (
+		exporterURL    string
+		username       string
+		secret         string
+		fingerprintKey string
+		auth           webAuth
+		authPass       string
+		authToken      string
+	)
+
+	fs := flag.NewFlagSet("creds-verify", flag.ExitOnError)
+	fs.StringVar(&exporterURL, "exporter-url", "http://localhost:9090", "URL of the running exporter")
+	fs.StringVar(&username, "user", "", "Username the exporter should be using")
+	fs.StringVar(&secret, "secret", "", "Where to read the passphrase the exporter should be using, as env:<variable> or file:<path>")
+	fs.StringVar(&fingerprintKey, "fingerprint-key", "", "Where to read the exporter's -fingerprint-key, as env:<variable> or file:<path>")
+	fs.StringVar(&auth.username, "web.auth-user", "", "Username for the exporter's basic auth, if it has -web.auth-user")
+	fs.StringVar(&authPass, "web.auth-pass", "", "Where to read the password for -web.auth-user, as env:<variable> or file:<path>")
+	fs.StringVar(&authToken, "web.auth-bearer-token", "", "Where to read the exporter's -web.auth-bearer-token, if it has one, as env:<variable> or file:<path>")
+	_ = fs.Parse(args)
+
+	if username == "" || secret == "" || fingerprintKey == "" {
+		fmt.Println("creds-verify needs -user, -secret and -fingerprint-key")
+		fs.PrintDefaults()
+		return 2
+	}
+
+	passphrase, err := resolveSecret(secret)
+
+	if err != nil {
+		fmt.Printf("Unable to read expected credentials: %v\n", err)
+		return 2
+	}
+
+	key, err := resolveSecret(fingerprintKey)
+
+	if err != nil {
+		fmt.Printf("Unable to read the fingerprint key: %v\n", err)
+		return 2
+	}
+
+	if auth.username != "" && authToken != "" {
+		fmt.Println("Only one of -web.auth-user and -web.auth-bearer-token can be given")
+		return 2
+	}
+
+	if (auth.username == "") != (authPass == "") {
+		fmt.Println("-web.auth-user and -web.auth-pass must be given together")
+		return 2
+	}
+
+	if auth.username != "" {
+		if auth.password, err = resolveSecret(authPass); err != nil {
+			fmt.Printf("Unable to read the password for the exporter: %v\n", err)
+			return 2
+		}
+	}
+
+	if authToken != "" {
+		if auth.token, err = resolveSecret(authToken); err != nil {
+			fmt.Printf("Unable to read the bearer token for the exporter: %v\n", err)
+			return 2
+		}
+	}
+
+	expected := (&credentials{username: username, passphrase: passphrase}).info(key)
+
+	actual, err := fetchCredentialsInfo(exporterURL, auth)
+
+	if err != nil {
+		fmt.Printf("Unable to fetch credentials from the exporter: %v\n", err)
+		return 2
+	}
+
+	if !actual.Anonymous && actual.Fingerprint == "" {
+		fmt.Println("The exporter has no -fingerprint-key, so its credentials can't be compared")
+		return 2
+	}
+
+	if *actual != expected {
+		fmt.Printf("Credentials have drifted: exporter is using %+v, expected %+v\n", *actual, expected)
+		return 1
+	}
+
+	fmt.Printf("Exporter is using the expected credentials for %s (%s)\n", expected.Username, expected.Fingerprint)
+
+	return 0
+}
+
+// fetchCredentialsInfo gets the credentialsInfo from the exporter at exporterURL, with auth if its
+// endpoints need it.
+func fetchCredentialsInfo(exporterURL string, auth webAuth) (*credentialsInfo, error) {
+	req, err := http.NewRequest("GET", strings.TrimRight(exporterURL, "/")+"/api/v1/credentials", nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	auth.authorize(req)
+
+	res, err := fetchHTTP(context.Background(), &http.Client{Timeout: defaultRequestTimeout}, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeResponse(res.Body)
+
+	var info credentialsInfo
+
+	if err := json.NewDecoder(res.Body).Decode(&info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const testFingerprintKey = "fingerprint-key"
+
+func exporterWithCredentials(c *credentials) *httptest.Server {
+	return httptest.NewServer(credentialsHandler(NewExporter("http://localhost:0", "http://localhost:0", []string{defaultRepository}, c), testFingerprintKey))
+}
+
+func TestCredentialsAreNotRevealed(t *testing.T) {
+	c := &credentials{username: "username", passphrase: "password"}
+	info := c.info(testFingerprintKey)
+
+	if info.Username != "username" || info.Fingerprint == "" || strings.Contains(info.Fingerprint, c.passphrase) ||
+		strings.Contains(info.Fingerprint, strings.TrimPrefix(c.fingerprint(), "sha256:")) {
+		t.Fatalf("Unexpected credentials info %+v", info)
+	}
+
+	if other := (&credentials{username: "username", passphrase: "passw0rd"}).info(testFingerprintKey); other == info {
+		t.Fatal("Expected different passphrases to have different fingerprints")
+	}
+
+	if other := c.info("another-key"); other == info {
+		t.Fatal("Expected different keys to give different fingerprints")
+	}
+
+	if unkeyed := c.info(""); unkeyed.Fingerprint != "" {
+		t.Fatalf("Expected no fingerprint without a key, got %+v", unkeyed)
+	}
+}
+
+func TestCredsVerifyPassesWhenCredentialsMatch(t *testing.T) {
+	exporter := exporterWithCredentials(&credentials{username: "username", passphrase: "password"})
+	defer exporter.Close()
+
+	os.Setenv("TEST_DOCKERHUB_PASS", "password")
+	defer os.Unsetenv("TEST_DOCKERHUB_PASS")
+
+	os.Setenv("TEST_FINGERPRINT_KEY", testFingerprintKey)
+	defer os.Unsetenv("TEST_FINGERPRINT_KEY")
+
+	if code := credsVerify([]string{"-exporter-url", exporter.URL, "-user", "username", "-secret", "env:TEST_DOCKERHUB_PASS", "-fingerprint-key", "env:TEST_FINGERPRINT_KEY"}); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+
+	os.Setenv("TEST_FINGERPRINT_KEY", "another-key")
+
+	if code := credsVerify([]string{"-exporter-url", exporter.URL, "-user", "username", "-secret", "env:TEST_DOCKERHUB_PASS", "-fingerprint-key", "env:TEST_FINGERPRINT_KEY"}); code != 1 {
+		t.Fatalf("Expected exit code 1 with another fingerprint key, got %d", code)
+	}
+}
+
+func TestCredsVerifyAuthenticatesToTheExporter(t *testing.T) {
+	e := NewExporter("http://localhost:0", "http://localhost:0", []string{defaultRepository}, &credentials{username: "username", passphrase: "password"})
+
+	os.Setenv("TEST_DOCKERHUB_PASS", "password")
+	defer os.Unsetenv("TEST_DOCKERHUB_PASS")
+
+	os.Setenv("TEST_FINGERPRINT_KEY", testFingerprintKey)
+	defer os.Unsetenv("TEST_FINGERPRINT_KEY")
+
+	os.Setenv("TEST_WEB_SECRET", "web-secret")
+	defer os.Unsetenv("TEST_WEB_SECRET")
+
+	verify := []string{"-user", "username", "-secret", "env:TEST_DOCKERHUB_PASS", "-fingerprint-key", "env:TEST_FINGERPRINT_KEY"}
+
+	for _, test := range []struct {
+		auth webAuth
+		args []string
+	}{
+		{webAuth{username: "prometheus", password: "web-secret"}, []string{"-web.auth-user", "prometheus", "-web.auth-pass", "env:TEST_WEB_SECRET"}},
+		{webAuth{token: "web-secret"}, []string{"-web.auth-bearer-token", "env:TEST_WEB_SECRET"}},
+	} {
+		exporter := httptest.NewServer(test.auth.wrap(credentialsHandler(e, testFingerprintKey)))
+
+		if code := credsVerify(append([]string{"-exporter-url", exporter.URL}, verify...)); code != 2 {
+			t.Errorf("Expected exit code 2 without authenticating to the exporter, got %d", code)
+		}
+
+		if code := credsVerify(append(append([]string{"-exporter-url", exporter.URL}, verify...), test.args...)); code != 0 {
+			t.Errorf("Expected exit code 0 with %v, got %d", test.args, code)
+		}
+
+		exporter.Close()
+	}
+}
+
+func TestCredsVerifyNeedsTheExporterToHaveAFingerprintKey(t *testing.T) {
+	exporter := httptest.NewServer(credentialsHandler(NewExporter("http://localhost:0", "http://localhost:0", []string{defaultRepository},
+		&credentials{username: "username", passphrase: "password"}), ""))
+	defer exporter.Close()
+
+	os.Setenv("TEST_DOCKERHUB_PASS", "password")
+	defer os.Unsetenv("TEST_DOCKERHUB_PASS")
+
+	os.Setenv("TEST_FINGERPRINT_KEY", testFingerprintKey)
+	defer os.Unsetenv("TEST_FINGERPRINT_KEY")
+
+	if code := credsVerify([]string{"-exporter-url", exporter.URL, "-user", "username", "-secret", "env:TEST_DOCKERHUB_PASS", "-fingerprint-key", "env:TEST_FINGERPRINT_KEY"}); code != 2 {
+		t.Fatalf("Expected exit code 2, got %d", code)
+	}
+}
+
+func TestCredsVerifyFailsWhenCredentialsHaveDrifted(t *testing.T) {
+	exporter := exporterWithCredentials(&credentials{username: "username", passphrase: "old-password"})
+	defer exporter.Close()
+
+	dir, err := ioutil.TempDir("", "creds-verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	secret := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(secret, []byte("password\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	key := filepath.Join(dir, "fingerprint-key")
+	if err := ioutil.WriteFile(key, []byte(testFingerprintKey+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := credsVerify([]string{"-exporter-url", exporter.URL, "-user", "username", "-secret", "file:" + secret, "-fingerprint-key", "file:" + key}); code != 1 {
+		t.Fatalf("Expected exit code 1, got %d", code)
+	}
+}
+
+func TestCredsVerifyFailsWhenExporterIsAnonymous(t *testing.T) {
+	exporter := exporterWithCredentials(nil)
+	defer exporter.Close()
+
+	os.Setenv("TEST_DOCKERHUB_PASS", "password")
+	defer os.Unsetenv("TEST_DOCKERHUB_PASS")
+
+	if code := credsVerify([]string{"-exporter-url", exporter.URL, "-user", "username", "-secret", "env:TEST_DOCKERHUB_PASS", "-fingerprint-key", "env:TEST_DOCKERHUB_PASS"}); code != 1 {
+		t.Fatalf("Expected exit code 1, got %d", code)
+	}
+}
+
+func TestResolveSecretRejectsUnknownStores(t *testing.T) {
+	for _, ref := range []string{"password", "vault:secret/dockerhub", "env:TEST_DOCKERHUB_UNSET"} {
+		if _, err := resolveSecret(ref); err == nil {
+			t.Errorf("Expected an error resolving %q", ref)
+		}
+	}
+}
+
+func TestValidateCredentialsReportsRejectedCredentials(t *testing.T) {
+	authServer := httptest.NewServer(basicAuth(handler(&mockResponse{
+		response: authResponseBody(),
+	})))
+	defer authServer.Close()
+
+	valid := NewExporter(authServer.URL, "http://localhost:0", []string{defaultRepository}, &credentials{username: "username", passphrase: "password"})
+
+	if err := valid.validateCredentials(); err != nil {
+		t.Fatalf("Expected credentials to be valid: %v", err)
+	}
+
+	invalid := NewExporter(authServer.URL, "http://localhost:0", []string{defaultRepository}, &credentials{username: "username", passphrase: "typo"})
+
+	if reason := failureReason(invalid.validateCredentials()); reason != failureReasonAuth {
+		t.Fatalf("Expected an auth failure, got %q", reason)
+	}
+}
+
+func TestSoftFailPollsAnonymouslyWhenCredentialsAreRejected(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := r.BasicAuth(); ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Write(authResponseBody())
+	}))
+	defer authServer.Close()
+
+	rateLimitServer := httptest.NewServer(handler(&mockResponse{
+		headers: map[string][]string{
+			"RateLimit-Limit":     {"100;w=21600"},
+			"RateLimit-Remaining": {"76;w=21600"},
+		},
+	}))
+	defer rateLimitServer.Close()
+
+	e := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository}, &credentials{username: "username", passphrase: "wrong"})
+	e.enableSoftFailCredentials()
+	e.scrape(context.Background(), e.targets[0], time.Now())
+
+	if remaining := testutil.ToFloat64(e.remaining.WithLabelValues(defaultRepository)); remaining != 76 {
+		t.Errorf("Expected the anonymous rate limit to be exported, got %v remaining", remaining)
+	}
+
+	if invalid := testutil.ToFloat64(e.credentialsMisconfigured.WithLabelValues(credentialsInvalid)); invalid != 1 {
+		t.Errorf("Expected the credentials to be reported as invalid, got %v", invalid)
+	}
+
+	if failures := testutil.ToFloat64(e.scrapeFailures.WithLabelValues(failureReasonAuth)); failures != 0 {
+		t.Errorf("Expected no auth failures, got %v", failures)
+	}
+}
+
+func TestSoftFailReportsMissingCredentials(t *testing.T) {
+	e := NewExporter("http://localhost:0", "http://localhost:0", []string{defaultRepository}, nil)
+	e.enableSoftFailCredentials()
+
+	if missing := testutil.ToFloat64(e.credentialsMisconfigured.WithLabelValues(credentialsMissing)); missing != 1 {
+		t.Errorf("Expected the credentials to be reported as missing, got %v", missing)
+	}
+}
+
+func TestRejectedCredentialsFailWithoutSoftFail(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer authServer.Close()
+
+	e := NewExporter(authServer.URL, "http://localhost:0", []string{defaultRepository}, &credentials{username: "username", passphrase: "wrong"})
+
+	if err := e.validateCredentials(); failureReason(err) != failureReasonAuth {
+		t.Errorf("Expected an auth failure, got %v", err)
+	}
+}
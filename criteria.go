@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// successCriteria decide whether a poll of a target succeeded, from which of the rate limit headers
+// were on the response and their values, eg for gateways which legitimately leave one of them out.
+// They are conditions joined by &&, each either has(limit), has(remaining), or a comparison of limit
+// or remaining with a number, eg `has(remaining) && limit >= 100`. Without any, both headers are
+// needed.
+type successCriteria struct {
+	expr       string
+	conditions []criterion
+}
+
+type criterion struct {
+	text   string
+	header string // limit or remaining
+	op     string // has, or a comparison operator
+	value  float64
+}
+
+var comparisonRE = regexp.MustCompile(`^(limit|remaining)\s*(>=|<=|==|!=|>|<)\s*([0-9]+(?:\.[0-9]+)?)$`)
+
+// parseSuccessCriteria parses a -success-criteria flag, which is <repository>:<criteria>.
+func parseSuccessCriteria(flag string) (string, *successCriteria, error) {
+	parts := strings.SplitN(flag, ":", 2)
+
+	if len(parts) != 2 || parts[0] == "" {
+		return "", nil, fmt.Errorf("success criteria %q should be <repository>:<criteria>", flag)
+	}
+
+	criteria := &successCriteria{expr: strings.TrimSpace(parts[1])}
+
+	for _, text := range strings.Split(parts[1], "&&") {
+		text = strings.TrimSpace(text)
+
+		if text == "has(limit)" || text == "has(remaining)" {
+			criteria.conditions = append(criteria.conditions, criterion{text: text, header: text[4 : len(text)-1], op: "has"})
+			continue
+		}
+
+		match := comparisonRE.FindStringSubmatch(text)
+
+		if match == nil {
+			return "", nil, fmt.Errorf("success criteria %q has an invalid condition %q", flag, text)
+		}
+
+		value, _ := strconv.ParseFloat(match[3], 64)
+		criteria.conditions = append(criteria.conditions, criterion{text: text, header: match[1], op: match[2], value: value})
+	}
+
+	return parts[0], criteria, nil
+}
+
+// parse reads the rate limit headers, and checks them against the criteria. A header which is
+// missing is returned as NaN.
+func (c *successCriteria) parse(header http.Header, headers headerMapping) (limit float64, remaining float64, err error) {
+	values := map[string]float64{}
+
+	for name, h := range map[string]string{"limit": headers.limit, "remaining": headers.remaining} {
+		values[name] = math.NaN()
+
+		if v := header.Get(h); v != "" {
+			if values[name], err = parseFloat(v); err != nil {
+				return 0, 0, &scrapeError{reason: failureReasonParse, err: err}
+			}
+		}
+	}
+
+	for _, cond := range c.conditions {
+		if !cond.isMet(values[cond.header]) {
+			return 0, 0, &scrapeError{reason: failureReasonCriteria, err: fmt.Errorf("success criteria %s not met by %s", c.expr, cond.text)}
+		}
+	}
+
+	// The criteria might allow both to be missing, but then there's nothing to export
+	if math.IsNaN(values["limit"]) && math.IsNaN(values["remaining"]) {
+		return 0, 0, &scrapeError{reason: failureReasonParse, err: fmt.Errorf("no rate limit headers")}
+	}
+
+	return values["limit"], values["remaining"], nil
+}
+
+// isMet returns whether the header, which is NaN if it's missing, meets the condition. Comparisons
+// with a missing header aren't met.
+func (c criterion) isMet(v float64) bool {
+	switch c.op {
+	case "has":
+		return !math.IsNaN(v)
+	case ">=":
+		return v >= c.value
+	case "<=":
+		return v <= c.value
+	case "==":
+		return v == c.value
+	case "!=":
+		return !math.IsNaN(v) && v != c.value
+	case ">":
+		return v > c.value
+	default:
+		return v < c.value
+	}
+}
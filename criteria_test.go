@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSuccessCriteriaAreParsed(t *testing.T) {
+	repository, criteria, err := parseSuccessCriteria("library/alpine:has(remaining) && limit >= 100")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if repository != "library/alpine" || len(criteria.conditions) != 2 {
+		t.Fatalf("Unexpected criteria for %s: %+v", repository, criteria)
+	}
+
+	expected := criterion{text: "limit >= 100", header: "limit", op: ">=", value: 100}
+
+	if criteria.conditions[1] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, criteria.conditions[1])
+	}
+
+	for _, invalid := range []string{
+		"has(remaining)",
+		":has(remaining)",
+		"library/alpine:",
+		"library/alpine:has(reset)",
+		"library/alpine:limit => 100",
+		"library/alpine:has(limit) || has(remaining)",
+	} {
+		if _, _, err := parseSuccessCriteria(invalid); err == nil {
+			t.Errorf("Expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestSuccessCriteriaCanAllowAMissingHeader(t *testing.T) {
+	authServer := httptest.NewServer(handler(&mockResponse{
+		response: authResponseBody(),
+	}))
+	defer authServer.Close()
+
+	rateLimitServer := httptest.NewServer(handler(&mockResponse{
+		headers: map[string][]string{
+			"RateLimit-Remaining": {"76;w=21600"},
+		},
+	}))
+	defer rateLimitServer.Close()
+
+	_, criteria, _ := parseSuccessCriteria(defaultRepository + ":has(remaining)")
+
+	exporter := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository}, nil)
+	exporter.targets[0].criteria = criteria
+	exporter.scrape(context.Background(), exporter.targets[0], time.Now())
+
+	if remaining := testutil.ToFloat64(exporter.remaining.WithLabelValues(defaultRepository)); remaining != 76 {
+		t.Errorf("Expected 76 remaining, got %v", remaining)
+	}
+
+	if success := testutil.ToFloat64(exporter.lastScrapeSuccess.WithLabelValues(defaultRepository)); success != 1 {
+		t.Errorf("Expected the poll to succeed without the limit header")
+	}
+
+	if failures := testutil.ToFloat64(exporter.scrapeFailures.WithLabelValues(failureReasonParse)); failures != 0 {
+		t.Errorf("Expected no parse failures, got %v", failures)
+	}
+}
+
+func TestUnmetSuccessCriteriaAreCategorisedSeparately(t *testing.T) {
+	authServer := httptest.NewServer(handler(&mockResponse{
+		response: authResponseBody(),
+	}))
+	defer authServer.Close()
+
+	rateLimitServer := httptest.NewServer(handler(&mockResponse{
+		headers: map[string][]string{
+			"RateLimit-Limit":     {"100;w=21600"},
+			"RateLimit-Remaining": {"76;w=21600"},
+		},
+	}))
+	defer rateLimitServer.Close()
+
+	_, criteria, _ := parseSuccessCriteria(defaultRepository + ":has(remaining) && limit >= 200")
+
+	exporter := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository}, nil)
+	exporter.targets[0].criteria = criteria
+	exporter.scrape(context.Background(), exporter.targets[0], time.Now())
+
+	if failures := testutil.ToFloat64(exporter.scrapeFailures.WithLabelValues(failureReasonCriteria)); failures != 1 {
+		t.Errorf("Expected 1 criteria failure, got %v", failures)
+	}
+
+	if failures := testutil.ToFloat64(exporter.scrapeFailures.WithLabelValues(failureReasonParse)); failures != 0 {
+		t.Errorf("Expected no parse failures, got %v", failures)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The Grafana dashboard that the dashboard subcommand writes, with just enough of Grafana's
+// dashboard model for the panels to import and render.
+type grafanaDashboard struct {
+	Inputs        []grafanaInput `json:"__inputs"`
+	Title         string         `json:"title"`
+	UID           string         `json:"uid"`
+	Tags          []string       `json:"tags"`
+	SchemaVersion int            `json:"schemaVersion"`
+	Refresh       string         `json:"refresh"`
+	Time          grafanaRange   `json:"time"`
+	Templating    struct {
+		List []grafanaVariable `json:"list"`
+	} `json:"templating"`
+	Panels []grafanaPanel `json:"panels"`
+}
+
+type grafanaInput struct {
+	Name     string `json:"name"`
+	Label    string `json:"label"`
+	Type     string `json:"type"`
+	PluginID string `json:"pluginId"`
+}
+
+type grafanaRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type grafanaVariable struct {
+	Name       string `json:"name"`
+	Label      string `json:"label"`
+	Type       string `json:"type"`
+	Datasource string `json:"datasource,omitempty"`
+	Query      string `json:"query"`
+	Multi      bool   `json:"multi,omitempty"`
+	IncludeAll bool   `json:"includeAll,omitempty"`
+	Refresh    int    `json:"refresh,omitempty"`
+}
+
+type grafanaPanel struct {
+	ID          int             `json:"id"`
+	Title       string          `json:"title"`
+	Description string          `json:"description,omitempty"`
+	Type        string          `json:"type"`
+	Datasource  string          `json:"datasource"`
+	GridPos     grafanaGridPos  `json:"gridPos"`
+	Targets     []grafanaTarget `json:"targets"`
+	FieldConfig struct {
+		Defaults struct {
+			Unit string   `json:"unit,omitempty"`
+			Min  *float64 `json:"min,omitempty"`
+			Max  *float64 `json:"max,omitempty"`
+		} `json:"defaults"`
+	} `json:"fieldConfig"`
+}
+
+type grafanaGridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type grafanaTarget struct {
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat"`
+	RefID        string `json:"refId"`
+}
+
+// dashboardDatasource is the Prometheus data source that's picked when the dashboard is imported.
+const dashboardDatasource = "${DS_PROMETHEUS}"
+
+// newDashboard returns a dashboard of the rate limit, wired to the metric names that the exporter
+// exports with args: in the -namespace, with the v2 names with -metrics.compat=v2 or both, and
+// without the repository label in aggregation mode.
+func newDashboard(args *arguments) *grafanaDashboard {
+	name := func(legacy string) string {
+		if v2, ok := v2MetricNames[legacy]; ok && args.compat != compatLegacy && args.compat != "" {
+			legacy = v2
+		}
+
+		return inNamespace(legacy, args.metricsNamespace)
+	}
+
+	selector, legend := `{repository=~"$repository"}`, "{{repository}}"
+	if args.aggregate {
+		selector, legend = "", "{{instance}}"
+	}
+
+	remaining := name(namespace+"_limit_remaining_requests_total") + selector
+	limit := name(namespace+"_limit_max_requests_total") + selector
+
+	d := &grafanaDashboard{
+		Inputs:        []grafanaInput{{Name: "DS_PROMETHEUS", Label: "Prometheus", Type: "datasource", PluginID: "prometheus"}},
+		Title:         "Docker Hub rate limit",
+		UID:           "dockerhub-exporter",
+		Tags:          []string{"dockerhub"},
+		SchemaVersion: 27,
+		Refresh:       "1m",
+		Time:          grafanaRange{From: "now-24h", To: "now"},
+	}
+
+	// So that the dashboards for exporters in different namespaces can be imported side by side
+	if ns := args.metricsNamespace; ns != "" && ns != namespace {
+		d.Title += " (" + ns + ")"
+		d.UID = strings.Replace(ns, "_", "-", -1) + "-exporter"
+	}
+
+	if !args.aggregate {
+		d.Templating.List = append(d.Templating.List, grafanaVariable{
+			Name:       "repository",
+			Label:      "Repository",
+			Type:       "query",
+			Datasource: dashboardDatasource,
+			Query:      fmt.Sprintf("label_values(%s, repository)", name(namespace+"_limit_remaining_requests_total")),
+			Multi:      true,
+			IncludeAll: true,
+			Refresh:    2,
+		})
+	}
+
+	zero, hundred := 0.0, 100.0
+
+	panels := []struct {
+		title, description, kind, unit string
+		min, max                       *float64
+		targets                        []grafanaTarget
+	}{
+		{"Remaining requests", "The pulls left in the current window.", "timeseries", "short", &zero, nil,
+			[]grafanaTarget{{Expr: remaining, LegendFormat: legend}}},
+		{"Rate limit", "The pulls allowed in each window.", "timeseries", "short", &zero, nil,
+			[]grafanaTarget{{Expr: limit, LegendFormat: legend}}},
+		{"Remaining", "The remaining requests as a percentage of the rate limit.", "gauge", "percent", &zero, &hundred,
+			[]grafanaTarget{{Expr: "100 * " + remaining + " / " + limit, LegendFormat: legend}}},
+		{"Consumption rate", "The estimated pulls consumed per minute.", "timeseries", "short", &zero, nil,
+			[]grafanaTarget{{Expr: "60 * " + name(namespace+"_limit_consumed_requests_per_second") + selector, LegendFormat: legend}}},
+		{"Time to exhaustion", "How long until the remaining requests run out at the estimated consumption rate.", "stat", "s", nil, nil,
+			[]grafanaTarget{{Expr: name(namespace+"_limit_estimated_exhaustion_timestamp_seconds") + selector + " - time()", LegendFormat: legend}}},
+		{"Polls succeeding", "Whether the last poll of Docker Hub succeeded.", "stat", "bool_yes_no", nil, nil,
+			[]grafanaTarget{{Expr: name(namespace+"_exporter_last_scrape_success") + selector, LegendFormat: legend}}},
+	}
+
+	for i, p := range panels {
+		panel := grafanaPanel{
+			ID:          i + 1,
+			Title:       p.title,
+			Description: p.description,
+			Type:        p.kind,
+			Datasource:  dashboardDatasource,
+			GridPos:     grafanaGridPos{H: 8, W: 12, X: 12 * (i % 2), Y: 8 * (i / 2)},
+		}
+
+		for j, t := range p.targets {
+			t.RefID = string(rune('A' + j))
+			panel.Targets = append(panel.Targets, t)
+		}
+
+		panel.FieldConfig.Defaults.Unit = p.unit
+		panel.FieldConfig.Defaults.Min = p.min
+		panel.FieldConfig.Defaults.Max = p.max
+
+		d.Panels = append(d.Panels, panel)
+	}
+
+	return d
+}
+
+// writeDashboard is the dashboard subcommand, which writes the dashboard for the exporter's flags
+// to w, ready to import into Grafana, and returns the exit code.
+func writeDashboard(args *arguments, w io.Writer) int {
+	b, err := json.MarshalIndent(newDashboard(args), "", "  ")
+
+	if err != nil {
+		fmt.Printf("Unable to write the dashboard: %v\n", err)
+		return 1
+	}
+
+	_, _ = w.Write(append(b, '\n'))
+
+	return 0
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDashboardUsesTheExportedMetricNames(t *testing.T) {
+	for _, tc := range []struct {
+		args            arguments
+		expected, never string
+		variables       int
+	}{
+		{arguments{compat: compatLegacy}, `dockerhub_limit_remaining_requests_total{repository=~"$repository"}`, "dockerhub_limit_max_requests{", 1},
+		{arguments{compat: compatV2}, `dockerhub_limit_remaining_requests{repository=~"$repository"}`, "_requests_total", 1},
+		{arguments{compat: compatBoth, aggregate: true}, "100 * dockerhub_limit_remaining_requests / dockerhub_limit_max_requests", "$repository", 0},
+		{arguments{compat: compatV2, metricsNamespace: "edge"}, "60 * edge_limit_consumed_requests_per_second{", "dockerhub_", 1},
+	} {
+		var out bytes.Buffer
+
+		if code := writeDashboard(&tc.args, &out); code != 0 {
+			t.Fatalf("Expected to exit 0, got %d", code)
+		}
+
+		var d grafanaDashboard
+
+		if err := json.Unmarshal(out.Bytes(), &d); err != nil {
+			t.Fatalf("Expected the dashboard to be JSON: %v", err)
+		}
+
+		var exprs []string
+		for _, p := range d.Panels {
+			for _, target := range p.Targets {
+				exprs = append(exprs, target.Expr)
+			}
+		}
+
+		all := strings.Join(exprs, "\n")
+
+		if !strings.Contains(all, tc.expected) {
+			t.Errorf("With %+v, expected a query with %s, got:\n%s", tc.args, tc.expected, all)
+		}
+
+		if strings.Contains(all, tc.never) {
+			t.Errorf("With %+v, expected no query with %s, got:\n%s", tc.args, tc.never, all)
+		}
+
+		if len(d.Templating.List) != tc.variables {
+			t.Errorf("With %+v, expected %d variables, got %d", tc.args, tc.variables, len(d.Templating.List))
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+)
+
+// The keys which Docker Hub credentials can be under in a Docker config, from the most to least
+// likely.
+var dockerHubConfigKeys = []string{
+	"https://index.docker.io/v1/",
+	"index.docker.io",
+	"docker.io",
+	"https://registry-1.docker.io",
+	"registry-1.docker.io",
+}
+
+// credentialHelper gets the credentials for serverURL from the docker-credential-<name> helper.
+type credentialHelper func(name string, serverURL string) (*credentials, error)
+
+// readDockerConfig returns the Docker Hub credentials from the Docker config.json at path, so that
+// the exporter uses the same account as the Docker daemon.
+func readDockerConfig(path string, helper credentialHelper) (*credentials, error) {
+	config, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := parseDockerConfig(config, helper)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// parseDockerConfig returns the Docker Hub credentials from a Docker config.json. Like Docker, it
+// prefers a credential helper for Docker Hub, then the default credentials store, then the
+// credentials in the config itself. Helpers are ignored if helper is nil.
+func parseDockerConfig(config []byte, helper credentialHelper) (*credentials, error) {
+	var parsed struct {
+		Auths map[string]struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Auth     string `json:"auth"`
+		} `json:"auths"`
+		CredsStore  string            `json:"credsStore"`
+		CredHelpers map[string]string `json:"credHelpers"`
+	}
+
+	if err := json.Unmarshal(config, &parsed); err != nil {
+		return nil, err
+	}
+
+	if helper != nil {
+		for _, key := range dockerHubConfigKeys {
+			if name, ok := parsed.CredHelpers[key]; ok {
+				return helper(name, key)
+			}
+		}
+
+		if parsed.CredsStore != "" {
+			return helper(parsed.CredsStore, dockerHubConfigKeys[0])
+		}
+	}
+
+	for _, key := range dockerHubConfigKeys {
+		entry, ok := parsed.Auths[key]
+
+		if !ok {
+			continue
+		}
+
+		if entry.Username != "" && entry.Password != "" {
+			return &credentials{username: entry.Username, passphrase: entry.Password}, nil
+		}
+
+		// auth is base64 encoded username:password
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+
+		if err != nil {
+			return nil, fmt.Errorf("auth for %s isn't valid base64: %w", key, err)
+		}
+
+		parts := strings.SplitN(string(decoded), ":", 2)
+
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("auth for %s should be username:password", key)
+		}
+
+		return &credentials{username: parts[0], passphrase: parts[1]}, nil
+	}
+
+	return nil, fmt.Errorf("no credentials for Docker Hub in the Docker config")
+}
+
+// runCredentialHelper is a credentialHelper which runs docker-credential-<name> from the PATH, as
+// Docker does.
+func runCredentialHelper(name string, serverURL string) (*credentials, error) {
+	cmd := exec.Command("docker-credential-"+name, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+
+	if err != nil {
+		// Helpers explain themselves on stdout or stderr, eg that there are no credentials
+		return nil, fmt.Errorf("docker-credential-%s: %v: %s", name, err, strings.TrimSpace(string(out)+stderr.String()))
+	}
+
+	return parseCredentialHelperOutput(name, out)
+}
+
+func parseCredentialHelperOutput(name string, out []byte) (*credentials, error) {
+	var res struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+
+	if err := json.Unmarshal(out, &res); err != nil {
+		return nil, fmt.Errorf("docker-credential-%s: %w", name, err)
+	}
+
+	// Identity tokens are for OAuth, which Docker Hub's token endpoint doesn't take as a passphrase
+	if res.Username == "<token>" {
+		return nil, fmt.Errorf("docker-credential-%s returned an identity token rather than a username and password", name)
+	}
+
+	if res.Username == "" || res.Secret == "" {
+		return nil, fmt.Errorf("docker-credential-%s returned no credentials", name)
+	}
+
+	return &credentials{username: res.Username, passphrase: res.Secret}, nil
+}
+
+// dockerConfigFile is a Docker config.json to read the credentials from, which is read again when
+// the exporter is told to reload.
+type dockerConfigFile struct {
+	path   string
+	helper credentialHelper
+}
+
+func (f *dockerConfigFile) String() string {
+	return f.path
+}
+
+func (f *dockerConfigFile) read() (*credentials, string, error) {
+	c, err := readDockerConfig(f.path, f.helper)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Docker configs aren't versioned, so changes are spotted from the credentials themselves
+	return c, c.fingerprint(), nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// fakeHelper is a credentialHelper which knows the credentials for Docker Hub in the desktop helper.
+func fakeHelper(name string, serverURL string) (*credentials, error) {
+	if name != "desktop" {
+		return nil, fmt.Errorf("docker-credential-%s: executable file not found in $PATH", name)
+	}
+
+	return &credentials{username: "helper", passphrase: serverURL}, nil
+}
+
+func TestCredentialsAreReadFromADockerConfig(t *testing.T) {
+	for config, expected := range map[string]credentials{
+		`{"auths":{"https://index.docker.io/v1/":{"auth":"` + base64.StdEncoding.EncodeToString([]byte("username:password")) + `"}}}`: {username: "username", passphrase: "password"},
+		`{"auths":{"https://index.docker.io/v1/":{}},"credsStore":"desktop"}`:                                                         {username: "helper", passphrase: "https://index.docker.io/v1/"},
+		`{"credsStore":"osxkeychain","credHelpers":{"docker.io":"desktop"}}`:                                                          {username: "helper", passphrase: "docker.io"},
+	} {
+		f, err := ioutil.TempFile("", "config.json")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+
+		_, _ = f.WriteString(config)
+		f.Close()
+
+		c, err := readDockerConfig(f.Name(), fakeHelper)
+
+		if err != nil {
+			t.Errorf("%s: %v", config, err)
+		} else if *c != expected {
+			t.Errorf("%s: expected %+v, got %+v", config, expected, *c)
+		}
+	}
+}
+
+func TestCredentialHelpersAreIgnoredWithoutAHelper(t *testing.T) {
+	if _, err := parseDockerConfig([]byte(`{"credsStore":"desktop"}`), nil); err == nil {
+		t.Error("Expected the credentials store to be ignored")
+	}
+}
+
+func TestCredentialHelperOutputIsParsed(t *testing.T) {
+	c, err := parseCredentialHelperOutput("desktop", []byte(`{"ServerURL":"https://index.docker.io/v1/","Username":"username","Secret":"password"}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *c != (credentials{username: "username", passphrase: "password"}) {
+		t.Errorf("Unexpected credentials %+v", *c)
+	}
+
+	for _, out := range []string{
+		`{"ServerURL":"https://index.docker.io/v1/","Username":"<token>","Secret":"identity-token"}`,
+		`{"ServerURL":"https://index.docker.io/v1/","Username":"username"}`,
+		`credentials not found in native keychain`,
+	} {
+		if _, err := parseCredentialHelperOutput("desktop", []byte(out)); err == nil {
+			t.Errorf("Expected %s to be rejected", out)
+		}
+	}
+}
+
+func TestDockerConfigsWithoutDockerHubAreRejected(t *testing.T) {
+	for _, config := range []string{
+		`{"auths":{"ghcr.io":{"username":"username","password":"password"}}}`,
+		`{"auths":{"docker.io":{"auth":"not base64!"}}}`,
+		`{"auths":{"docker.io":{"auth":"` + base64.StdEncoding.EncodeToString([]byte("username")) + `"}}}`,
+		`not json`,
+	} {
+		if _, err := parseDockerConfig([]byte(config), nil); err == nil {
+			t.Errorf("Expected %s to be rejected", config)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	ecrPublicNamespace = "ecr_public"
+	defaultECRPublic   = "https://public.ecr.aws"
+	ecrPublicService   = "public.ecr.aws"
+
+	// ECR Public's API is only in us-east-1, wherever the registry is pulled from
+	defaultECRPublicAPI = "https://api.ecr-public.us-east-1.amazonaws.com"
+	ecrPublicAPIRegion  = "us-east-1"
+)
+
+// ecrPublicCollector monitors the pull quotas of Amazon ECR Public, which workloads that fall back
+// from Docker Hub hit the anonymous limits of too. Each -ecr-public-repository is polled like
+// Docker Hub, with a token from the registry's token endpoint and a HEAD of its latest manifest,
+// whenever the collector is collected. ECR Public throttles with HTTP 429 rather than reporting
+// what's left, so throttled polls are counted, and the rate limit headers are only exported if it
+// reports them.
+//
+// With -ecr-public-authenticated, the registry's token is requested with an authorization token
+// from ECR Public's GetAuthorizationToken, signed with the AWS credentials of the pod or instance,
+// for the authenticated quotas.
+type ecrPublicCollector struct {
+	registryURL  string
+	apiURL       string
+	repositories []string
+	client       *http.Client
+	credentials  *awsCredentialsProvider // nil to poll anonymously
+
+	mu            sync.Mutex // polls one at a time
+	authorization string     // the basic auth from GetAuthorizationToken, base64 encoded
+	expires       time.Time  // when authorization expires
+
+	up, authenticated, limit, remaining *prometheus.Desc
+	throttled                           *prometheus.CounterVec
+}
+
+func newECRPublicCollector(repositories []string, authenticated bool, client *http.Client) *ecrPublicCollector {
+	c := &ecrPublicCollector{
+		registryURL:  defaultECRPublic,
+		apiURL:       defaultECRPublicAPI,
+		repositories: repositories,
+		client:       client,
+
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(ecrPublicNamespace, "pull", "up"),
+			"Whether the last poll of the repository on ECR Public succeeded (1) or not (0).",
+			[]string{"repository"}, nil),
+		authenticated: prometheus.NewDesc(
+			prometheus.BuildFQName(ecrPublicNamespace, "", "authenticated"),
+			"Whether ECR Public was last polled with AWS credentials (1), for the authenticated quotas, or anonymously (0).",
+			nil, nil),
+		limit: prometheus.NewDesc(
+			prometheus.BuildFQName(ecrPublicNamespace, "limit", "max_requests"),
+			"ECR Public Rate Limit Maximum Requests, when ECR Public reports one.",
+			[]string{"repository"}, nil),
+		remaining: prometheus.NewDesc(
+			prometheus.BuildFQName(ecrPublicNamespace, "limit", "remaining_requests"),
+			"ECR Public Rate Limit Remaining Requests, when ECR Public reports one.",
+			[]string{"repository"}, nil),
+		throttled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ecrPublicNamespace,
+			Name:      "throttled_polls_total",
+			Help:      "Number of polls of the repository that ECR Public throttled with HTTP 429.",
+		}, []string{"repository"}),
+	}
+
+	if authenticated {
+		c.credentials = newAWSCredentialsProvider()
+	}
+
+	for _, repository := range repositories {
+		c.throttled.WithLabelValues(repository)
+	}
+
+	return c
+}
+
+// Describe describes the ECR Public metrics. It implements prometheus.Collector.
+func (c *ecrPublicCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.up
+	ch <- c.authenticated
+	ch <- c.limit
+	ch <- c.remaining
+	c.throttled.Describe(ch)
+}
+
+// Collect polls ECR Public and delivers its metrics. It implements prometheus.Collector.
+func (c *ecrPublicCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctx := context.Background()
+	authorization := c.authorize(ctx)
+
+	authenticated := 0.0
+	if authorization != "" {
+		authenticated = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.authenticated, prometheus.GaugeValue, authenticated)
+
+	for _, repository := range c.repositories {
+		header, err := c.fetchManifestHeaders(ctx, repository, authorization)
+
+		var statusErr *httpStatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusTooManyRequests {
+			c.throttled.WithLabelValues(repository).Inc()
+		}
+
+		if err != nil {
+			fmt.Printf("Unable to poll %s on ECR Public: %v\n", repository, err)
+			ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0, repository)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 1, repository)
+
+		if limit, remaining, err := parseRateLimitHeaders(header, defaultHeaderMapping); err == nil {
+			ch <- prometheus.MustNewConstMetric(c.limit, prometheus.GaugeValue, limit, repository)
+			ch <- prometheus.MustNewConstMetric(c.remaining, prometheus.GaugeValue, remaining, repository)
+		}
+	}
+
+	c.throttled.Collect(ch)
+}
+
+// authorize returns the authorization to request the registry's tokens with, getting a new one
+// from GetAuthorizationToken if it's about to expire. It's empty to poll anonymously, including
+// when the authorization can't be got, so that the anonymous quotas are still monitored.
+func (c *ecrPublicCollector) authorize(ctx context.Context) string {
+	if c.credentials == nil {
+		return ""
+	}
+
+	if c.authorization != "" && time.Until(c.expires) > time.Minute {
+		return c.authorization
+	}
+
+	authorization, expires, err := c.getAuthorizationToken(ctx)
+
+	if err != nil {
+		fmt.Printf("Warning: unable to authenticate with ECR Public, polling anonymously instead: %v\n", err)
+		return ""
+	}
+
+	c.authorization, c.expires = authorization, expires
+
+	return authorization
+}
+
+// getAuthorizationToken calls ECR Public's GetAuthorizationToken.
+func (c *ecrPublicCollector) getAuthorizationToken(ctx context.Context) (string, time.Time, error) {
+	creds, err := c.credentials.get()
+
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("unable to get AWS credentials: %w", err)
+	}
+
+	payload := []byte("{}")
+	req, err := http.NewRequestWithContext(ctx, "POST", c.apiURL+"/", bytes.NewReader(payload))
+
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "SpencerFrontendService.GetAuthorizationToken")
+	signAWSRequest(req, payload, creds, ecrPublicAPIRegion, "ecr-public", time.Now())
+
+	res, err := fetchHTTP(ctx, c.client, req)
+
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	defer closeResponse(res.Body)
+
+	var parsed struct {
+		AuthorizationData struct {
+			AuthorizationToken string  `json:"authorizationToken"`
+			ExpiresAt          float64 `json:"expiresAt"`
+		} `json:"authorizationData"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&parsed); err != nil || parsed.AuthorizationData.AuthorizationToken == "" {
+		return "", time.Time{}, &scrapeError{reason: failureReasonParse, err: fmt.Errorf("no authorization token in the response: %v", err)}
+	}
+
+	return parsed.AuthorizationData.AuthorizationToken, time.Unix(int64(parsed.AuthorizationData.ExpiresAt), 0), nil
+}
+
+// fetchManifestHeaders gets a token to pull repository from the registry, with authorization if
+// it isn't empty, and returns the headers of a HEAD of its latest manifest.
+func (c *ecrPublicCollector) fetchManifestHeaders(ctx context.Context, repository string, authorization string) (http.Header, error) {
+	query := url.Values{"scope": {"repository:" + repository + ":pull"}, "service": {ecrPublicService}}
+	req, err := http.NewRequestWithContext(ctx, "GET", c.registryURL+"/token?"+query.Encode(), nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if authorization != "" {
+		req.Header.Set("Authorization", "Basic "+authorization)
+	}
+
+	res, err := fetchHTTP(ctx, c.client, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var token AuthTokenResponse
+	err = json.NewDecoder(res.Body).Decode(&token)
+	closeResponse(res.Body)
+
+	if err != nil {
+		return nil, &scrapeError{reason: failureReasonParse, err: err}
+	}
+
+	req, err = http.NewRequestWithContext(ctx, "HEAD", c.registryURL+"/v2/"+repository+"/manifests/latest", nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	req.Header.Set("Accept", "application/vnd.oci.image.index.v1+json, application/vnd.docker.distribution.manifest.list.v2+json")
+
+	res, err = fetchHTTP(ctx, c.client, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	closeResponse(res.Body)
+
+	return res.Header, nil
+}
@@ -0,0 +1,72 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestECRPublicQuotasAreMonitored(t *testing.T) {
+	var authorization string
+
+	ecr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			if r.Header.Get("X-Amz-Target") != "SpencerFrontendService.GetAuthorizationToken" || !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			fmt.Fprintf(w, `{"authorizationData": {"authorizationToken": "QVdTOnBhc3N3b3Jk", "expiresAt": %d}}`, time.Now().Add(time.Hour).Unix())
+		case "/token":
+			authorization = r.Header.Get("Authorization")
+			fmt.Fprint(w, `{"token": "ecr-token"}`)
+		case "/v2/docker/library/alpine/manifests/latest":
+			w.Header().Set("RateLimit-Limit", "10")
+			w.Header().Set("RateLimit-Remaining", "9")
+		case "/v2/docker/library/busybox/manifests/latest":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ecr.Close()
+
+	c := newECRPublicCollector([]string{"docker/library/alpine", "docker/library/busybox"}, true, nil)
+	c.registryURL = ecr.URL
+	c.apiURL = ecr.URL
+	c.credentials = &awsCredentialsProvider{cached: &awsCredentials{accessKeyID: "AKIDEXAMPLE", secretAccessKey: "secret"}}
+
+	expected := `
+# HELP ecr_public_authenticated Whether ECR Public was last polled with AWS credentials (1), for the authenticated quotas, or anonymously (0).
+# TYPE ecr_public_authenticated gauge
+ecr_public_authenticated 1
+# HELP ecr_public_limit_remaining_requests ECR Public Rate Limit Remaining Requests, when ECR Public reports one.
+# TYPE ecr_public_limit_remaining_requests gauge
+ecr_public_limit_remaining_requests{repository="docker/library/alpine"} 9
+# HELP ecr_public_pull_up Whether the last poll of the repository on ECR Public succeeded (1) or not (0).
+# TYPE ecr_public_pull_up gauge
+ecr_public_pull_up{repository="docker/library/alpine"} 1
+ecr_public_pull_up{repository="docker/library/busybox"} 0
+# HELP ecr_public_throttled_polls_total Number of polls of the repository that ECR Public throttled with HTTP 429.
+# TYPE ecr_public_throttled_polls_total counter
+ecr_public_throttled_polls_total{repository="docker/library/alpine"} 0
+ecr_public_throttled_polls_total{repository="docker/library/busybox"} 1
+`
+
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "ecr_public_authenticated", "ecr_public_limit_remaining_requests", "ecr_public_pull_up", "ecr_public_throttled_polls_total"); err != nil {
+		t.Fatal(err)
+	}
+
+	if authorization != "Basic QVdTOnBhc3N3b3Jk" {
+		t.Errorf("Expected the registry token to be requested with the authorization token, got %q", authorization)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+)
+
+// drain returns the messages queued on b, without publishing them.
+func drain(b *eventBus) []busMessage {
+	var messages []busMessage
+
+	for {
+		select {
+		case m := <-b.queue:
+			messages = append(messages, m)
+		default:
+			return messages
+		}
+	}
+}
+
+func TestSamplesAndAlertTransitionsArePublished(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+	e.bus = newEventBus(nil, defaultSamplesTopic, defaultAlertsTopic)
+	e.alerter = newAlerter("", alertFormatJSON, 10, nil)
+	e.alerter.bus = e.bus
+
+	for _, remaining := range []int{50, 5, 0, 60} {
+		hub.SetRateLimit(100, remaining)
+		e.scrape(context.Background(), e.targets[0], time.Now())
+	}
+
+	var transitions []string
+	samples := 0
+
+	for _, m := range drain(e.bus) {
+		switch payload := m.payload.(type) {
+		case sampleMessage:
+			samples++
+		case alertTransitionMessage:
+			transitions = append(transitions, payload.PreviousLevel+"->"+payload.Level)
+		}
+	}
+
+	if samples != 4 {
+		t.Errorf("Expected a sample for each poll, got %d", samples)
+	}
+
+	if got, expected := strings.Join(transitions, ","), "ok->low,low->exhausted,exhausted->ok"; got != expected {
+		t.Errorf("Expected transitions %s, got %s", expected, got)
+	}
+}
+
+func TestFullQueueDropsMessages(t *testing.T) {
+	b := newEventBus(nil, defaultSamplesTopic, defaultAlertsTopic)
+	target := newTarget("http://localhost:0", "http://localhost:0", defaultRepository)
+
+	for i := 0; i < maxQueuedMessages+3; i++ {
+		b.publishSample(target, time.Now())
+	}
+
+	if got := len(drain(b)); got != maxQueuedMessages {
+		t.Errorf("Expected %d queued messages, got %d", maxQueuedMessages, got)
+	}
+}
+
+func TestNATSPublishing(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	received := make(chan []string, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_, _ = conn.Write([]byte("INFO {\"server_id\":\"test\"}\r\n"))
+
+		r := bufio.NewReader(conn)
+		var lines []string
+
+		for i := 0; i < 3; i++ {
+			line, _ := r.ReadString('\n')
+			lines = append(lines, strings.TrimSpace(line))
+		}
+
+		received <- lines
+	}()
+
+	p, err := newNATSPublisher("nats://s3cret@" + listener.Addr().String())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.publish("dockerhub.ratelimit.samples", defaultRepository, []byte(`{"remaining":12}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case lines := <-received:
+		if !strings.HasPrefix(lines[0], "CONNECT ") || !strings.Contains(lines[0], `"auth_token":"s3cret"`) {
+			t.Errorf("Unexpected CONNECT %q", lines[0])
+		}
+
+		if lines[1] != "PUB dockerhub.ratelimit.samples 16" || lines[2] != `{"remaining":12}` {
+			t.Errorf("Unexpected PUB %q", lines[1:])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the message to be published")
+	}
+}
+
+func TestKafkaRESTPublishing(t *testing.T) {
+	var (
+		path, contentType string
+		body              struct {
+			Records []struct {
+				Key   string          `json:"key"`
+				Value json.RawMessage `json:"value"`
+			} `json:"records"`
+		}
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		contentType = r.Header.Get("Content-Type")
+		b, _ := ioutil.ReadAll(r.Body)
+		_ = json.Unmarshal(b, &body)
+	}))
+	defer server.Close()
+
+	p, err := newKafkaRESTPublisher(server.URL+"/", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.publish(defaultAlertsTopic, defaultRepository, []byte(`{"level":"low"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/topics/dockerhub.ratelimit.alerts" || contentType != "application/vnd.kafka.json.v2+json" {
+		t.Errorf("Unexpected request to %s with %s", path, contentType)
+	}
+
+	if len(body.Records) != 1 || body.Records[0].Key != defaultRepository || string(body.Records[0].Value) != `{"level":"low"}` {
+		t.Errorf("Unexpected records %+v", body.Records)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// burnRateTimeConstant is how quickly the estimated consumption rate follows changes in the actual
+// rate. A longer one smooths out bursts, but is slower to notice a sustained change.
+const burnRateTimeConstant = 10 * time.Minute
+
+// maxExhaustionHorizon is how far ahead an exhaustion is estimated when the window isn't known.
+const maxExhaustionHorizon = 7 * 24 * time.Hour
+
+// observeBurnRate updates the estimated consumption rate for t with a freshly polled remaining, and
+// with it, when the remaining requests will run out at that rate. The estimate is an exponentially
+// weighted moving average, weighted by how long it's been since the last poll, so that it isn't
+// thrown off by scrapes which aren't evenly spaced.
+func (e *Exporter) observeBurnRate(t *target, now time.Time, remaining float64) {
+	previous := t.lastRemainingAt
+	t.lastRemainingAt = now
+
+	if !t.hasRemaining || previous.IsZero() || !now.After(previous) {
+		return
+	}
+
+	elapsed := now.Sub(previous).Seconds()
+
+	// An increase means that earlier requests have dropped out of the window, which doesn't tell us
+	// anything about how many were made since the last poll, so the estimate carries on as it was.
+	if remaining <= t.lastRemaining {
+		rate := (t.lastRemaining - remaining) / elapsed
+		weight := 1 - math.Exp(-elapsed/burnRateTimeConstant.Seconds())
+		t.burnRate += weight * (rate - t.burnRate)
+	}
+
+	e.burnRate.WithLabelValues(t.repository).Set(t.burnRate)
+
+	// The estimate decays towards zero when nothing is being pulled, and once the requests would
+	// last longer than the window, they'll drop out of it before they run out. Comparing before
+	// converting to a time.Duration also keeps it from overflowing.
+	horizon := maxExhaustionHorizon
+	if t.window > 0 {
+		horizon = t.window
+	}
+
+	if t.burnRate <= 0 || remaining/t.burnRate > horizon.Seconds() {
+		e.exhaustion.DeleteLabelValues(t.repository)
+		return
+	}
+
+	exhaustion := now.Add(time.Duration(remaining / t.burnRate * float64(time.Second)))
+	e.exhaustion.WithLabelValues(t.repository).Set(float64(exhaustion.UnixNano()) / 1e9)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestExhaustionIsEstimatedFromTheConsumptionRate(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+	now := time.Date(2020, 11, 16, 10, 0, 0, 0, time.UTC)
+
+	// 1 request a minute for long enough that the estimate has caught up
+	remaining := 200
+	for i := 0; i < 120; i++ {
+		hub.SetRateLimit(200, remaining)
+		e.scrape(context.Background(), e.targets[0], now)
+
+		remaining--
+		now = now.Add(time.Minute)
+	}
+
+	rate := testutil.ToFloat64(e.burnRate.WithLabelValues(defaultRepository))
+	if math.Abs(rate-1.0/60) > 0.0001 {
+		t.Errorf("Expected a rate of 1 request a minute, got %v per second", rate)
+	}
+
+	last := now.Add(-time.Minute)
+	expected := float64(last.Add(time.Duration(remaining+1) * time.Minute).Unix())
+	if exhaustion := testutil.ToFloat64(e.exhaustion.WithLabelValues(defaultRepository)); math.Abs(exhaustion-expected) > 60 {
+		t.Errorf("Expected to run out at %v, got %v", expected, exhaustion)
+	}
+
+	// Requests dropping out of the window don't count as negative consumption
+	hub.SetRateLimit(200, 190)
+	e.scrape(context.Background(), e.targets[0], now)
+
+	if after := testutil.ToFloat64(e.burnRate.WithLabelValues(defaultRepository)); after != rate {
+		t.Errorf("Expected the rate to stay at %v when requests drop out of the window, got %v", rate, after)
+	}
+}
+
+func TestNoExhaustionIsEstimatedWithoutConsumption(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+	now := time.Date(2020, 11, 16, 10, 0, 0, 0, time.UTC)
+
+	e.scrape(context.Background(), e.targets[0], now)
+	e.scrape(context.Background(), e.targets[0], now.Add(time.Minute))
+
+	if count := testutil.CollectAndCount(e.exhaustion); count != 0 {
+		t.Errorf("Expected no exhaustion estimate, got %d", count)
+	}
+}
+
+func TestNoExhaustionIsEstimatedOnceConsumptionHasStopped(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+	now := time.Date(2020, 11, 16, 10, 0, 0, 0, time.UTC)
+
+	remaining := 200
+	for i := 0; i < 30; i++ {
+		hub.SetRateLimit(200, remaining)
+		e.scrape(context.Background(), e.targets[0], now)
+
+		remaining--
+		now = now.Add(time.Minute)
+	}
+
+	if count := testutil.CollectAndCount(e.exhaustion); count != 1 {
+		t.Fatalf("Expected an exhaustion estimate while requests are being consumed, got %d", count)
+	}
+
+	// Hours without any pulls, while the estimated rate decays towards zero
+	for i := 0; i < 30; i++ {
+		e.scrape(context.Background(), e.targets[0], now)
+		now = now.Add(5 * time.Minute)
+
+		if count := testutil.CollectAndCount(e.exhaustion); count != 0 {
+			exhaustion := testutil.ToFloat64(e.exhaustion.WithLabelValues(defaultRepository))
+
+			if exhaustion < float64(now.Unix()) {
+				t.Fatalf("Expected no exhaustion in the past after %d idle polls, got %v", i+1, time.Unix(int64(exhaustion), 0))
+			}
+		}
+	}
+
+	if count := testutil.CollectAndCount(e.exhaustion); count != 0 {
+		t.Errorf("Expected no exhaustion estimate once the requests would outlast the window, got %d", count)
+	}
+}
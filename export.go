@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// writeHistoryCSV writes the history as CSV, a row for each poll, for capacity planning in a
+// spreadsheet or analysis by teams without access to Prometheus.
+func writeHistoryCSV(w io.Writer, histories []repositoryHistory) error {
+	out := csv.NewWriter(w)
+
+	if err := out.Write([]string{"time", "repository", "limit", "remaining"}); err != nil {
+		return err
+	}
+
+	for _, h := range histories {
+		for _, s := range h.Samples {
+			row := []string{
+				s.Time.UTC().Format(time.RFC3339),
+				h.Repository,
+				strconv.FormatFloat(h.Limit, 'f', -1, 64),
+				strconv.FormatFloat(s.Remaining, 'f', -1, 64),
+			}
+
+			if err := out.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	out.Flush()
+
+	return out.Error()
+}
+
+// exportHistory is the export subcommand, which writes the polls in -history-db to w as CSV, and
+// returns the exit code. It only reads the file, so it can be run alongside the exporter.
+func exportHistory(args *arguments, w io.Writer) int {
+	if args.historyDB == "" {
+		fmt.Println("export needs -history-db")
+		return 2
+	}
+
+	var since time.Time
+	if args.exportSince > 0 {
+		since = time.Now().Add(-args.exportSince)
+	}
+
+	e := &Exporter{historyDB: &historyDB{path: args.historyDB}}
+	histories, err := e.storedHistory(since)
+
+	if err != nil {
+		fmt.Printf("Unable to read the history: %v\n", err)
+		return 1
+	}
+
+	if err := writeHistoryCSV(w, histories); err != nil {
+		fmt.Printf("Unable to write the history: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
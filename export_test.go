@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistoryIsExportedAsCSV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "history.jsonl")
+	now := time.Now().UTC().Truncate(time.Second)
+
+	db, err := openHistoryDB(path, defaultHistoryRetention, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range []historyRecord{
+		{Time: now.Add(-48 * time.Hour), Repository: defaultRepository, Limit: 100, Remaining: 10},
+		{Time: now.Add(-time.Hour), Repository: defaultRepository, Limit: 100, Remaining: 90.5},
+		{Time: now.Add(-time.Hour), Repository: "library/alpine", Limit: 200, Remaining: 150},
+	} {
+		if err := db.append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+
+	if code := exportHistory(&arguments{historyDB: path, exportSince: 24 * time.Hour}, &out); code != 0 {
+		t.Fatalf("Expected to exit 0, got %d", code)
+	}
+
+	hourAgo := now.Add(-time.Hour).Format(time.RFC3339)
+	expected := "time,repository,limit,remaining\n" +
+		hourAgo + ",ratelimitpreview/test,100,90.5\n" +
+		hourAgo + ",library/alpine,200,150\n"
+
+	if out.String() != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, out.String())
+	}
+
+	if code := exportHistory(&arguments{}, &out); code != 2 {
+		t.Errorf("Expected export without -history-db to exit 2, got %d", code)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Experimental subsystems, which are off unless they're enabled with -enable-feature. Once one is
+// stable, it's on for everyone, and enabling it is a no-op.
+const (
+	featurePrediction      = "prediction"       // estimating the consumption rate and when the requests will run out
+	featureWindowSummaries = "window-summaries" // summarising each rate limit window when it resets
+)
+
+var knownFeatures = []string{featurePrediction, featureWindowSummaries}
+
+// features are the experimental subsystems which have been enabled.
+type features map[string]bool
+
+// parseFeatures parses -enable-feature flags, each of which can be a comma separated list, as with
+// Prometheus.
+func parseFeatures(flags []string) (features, error) {
+	res := features{}
+
+	for _, flag := range flags {
+		for _, name := range strings.Split(flag, ",") {
+			name = strings.TrimSpace(name)
+
+			if !contains(knownFeatures, name) {
+				return nil, fmt.Errorf("unknown feature %q, should be one of %s", name, strings.Join(knownFeatures, ", "))
+			}
+
+			res[name] = true
+		}
+	}
+
+	return res, nil
+}
+
+func (f features) enabled(name string) bool {
+	return f[name]
+}
+
+// names returns the enabled features, sorted.
+func (f features) names() []string {
+	var names []string
+
+	for name := range f {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// enableFeatures turns on the experimental subsystems in f, and records them in the info metric.
+func (e *Exporter) enableFeatures(f features) {
+	e.features = f
+
+	e.featureInfo.Reset()
+	for _, name := range f.names() {
+		e.featureInfo.WithLabelValues(name).Set(1)
+	}
+}
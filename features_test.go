@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFeaturesAreParsed(t *testing.T) {
+	f, err := parseFeatures([]string{"prediction", " window-summaries,prediction"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{featurePrediction, featureWindowSummaries}; !reflect.DeepEqual(f.names(), expected) {
+		t.Errorf("Expected %v, got %v", expected, f.names())
+	}
+
+	if _, err := parseFeatures([]string{"prediction,time-travel"}); err == nil {
+		t.Error("Expected an unknown feature to be an error")
+	}
+}
+
+func TestExperimentalMetricsAreOnlyExportedWhenEnabled(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+
+	// Estimate a consumption rate, so that there's something to export
+	now := time.Now()
+	hub.SetRateLimit(100, 90)
+	e.scrape(context.Background(), e.targets[0], now.Add(-time.Minute))
+
+	for _, c := range []struct {
+		features features
+		expected int
+	}{
+		{features{}, 0},
+		{features{featureWindowSummaries: true}, 0},
+		{features{featurePrediction: true}, 1},
+	} {
+		e.enableFeatures(c.features)
+
+		if count := testutil.CollectAndCount(e, "dockerhub_limit_consumed_requests_per_second"); count != c.expected {
+			t.Errorf("Expected %d consumption rates with %v, got %d", c.expected, c.features.names(), count)
+		}
+
+		if count := testutil.CollectAndCount(e, "dockerhub_exporter_feature_info"); count != len(c.features) {
+			t.Errorf("Expected %d features in the info metric with %v, got %d", len(c.features), c.features.names(), count)
+		}
+	}
+}
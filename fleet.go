@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fleet pulls the latest rate limits from peer exporters, typically one for each egress IP of a
+// site, from their /api/v1/ratelimit, and exports a view of the whole fleet's alongside this
+// exporter's own. Each exporter in the fleet can pull from all of the others, so that any of them
+// can be scraped for the fleet's view without a central aggregation layer.
+type fleet struct {
+	peers  []string
+	client *http.Client
+	self   *Exporter
+	maxAge time.Duration // how old a peer's poll can be before it's left out of the view
+	clock  func() time.Time
+
+	mu       sync.Mutex
+	statuses map[string][]rateLimitStatus // by peer, as of the last successful pull
+	up       map[string]bool              // by peer, whether the last pull succeeded
+
+	remaining, minRemaining *prometheus.Desc
+	sources, peerUp         *prometheus.Desc
+	failures                prometheus.Counter
+}
+
+func newFleet(peers []string, self *Exporter, client *http.Client, maxAge time.Duration) *fleet {
+	return &fleet{
+		peers:    peers,
+		client:   client,
+		self:     self,
+		maxAge:   maxAge,
+		clock:    time.Now,
+		statuses: map[string][]rateLimitStatus{},
+		up:       map[string]bool{},
+
+		remaining: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "fleet", "remaining_requests"),
+			"Docker Hub Rate Limit Remaining Requests last polled from each egress IP of the fleet.",
+			[]string{"repository", "source_ip"}, nil),
+		minRemaining: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "fleet", "min_remaining_requests"),
+			"The lowest Docker Hub Rate Limit Remaining Requests across the egress IPs of the fleet.",
+			[]string{"repository"}, nil),
+		sources: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "fleet", "source_ips"),
+			"Number of egress IPs of the fleet with a recent poll of Docker Hub.",
+			[]string{"repository"}, nil),
+		peerUp: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "exporter", "fleet_peer_up"),
+			"Whether the last pull from the peer succeeded (1) or not (0).",
+			[]string{"peer"}, nil),
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exporter_fleet_pull_failures_total",
+			Help:      "Number of errors while pulling the rate limits from the -peer exporters.",
+		}),
+	}
+}
+
+// run pulls from the peers straight away, and then every interval, forever.
+func (f *fleet) run(interval time.Duration) {
+	f.pullAll()
+
+	for range time.Tick(interval) {
+		f.pullAll()
+	}
+}
+
+func (f *fleet) pullAll() {
+	for _, peer := range f.peers {
+		statuses, err := f.pull(peer)
+
+		f.mu.Lock()
+		f.up[peer] = err == nil
+		if err == nil {
+			f.statuses[peer] = statuses
+		}
+		f.mu.Unlock()
+
+		if err != nil {
+			fmt.Printf("Unable to pull the rate limits from %s: %v\n", peer, err)
+			f.failures.Inc()
+		}
+	}
+}
+
+// pull reads the rate limits that peer last polled.
+func (f *fleet) pull(peer string) ([]rateLimitStatus, error) {
+	req, err := http.NewRequest("GET", strings.TrimRight(peer, "/")+"/api/v1/ratelimit", nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := fetchHTTP(context.Background(), f.client, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeResponse(res.Body)
+
+	var statuses []rateLimitStatus
+
+	if err := json.NewDecoder(res.Body).Decode(&statuses); err != nil {
+		return nil, err
+	}
+
+	return statuses, nil
+}
+
+// latest returns the most recent successful poll of each repository from each egress IP, of this
+// exporter and its peers, leaving out those older than f.maxAge. Peers behind the same egress IP
+// are counted once.
+func (f *fleet) latest() map[string]map[string]rateLimitStatus {
+	now := f.clock()
+	latest := map[string]map[string]rateLimitStatus{} // by repository, then source IP
+
+	add := func(status rateLimitStatus) {
+		if status.LastSuccess == nil || now.Sub(*status.LastSuccess) > f.maxAge {
+			return
+		}
+
+		if latest[status.Repository] == nil {
+			latest[status.Repository] = map[string]rateLimitStatus{}
+		}
+
+		seen, ok := latest[status.Repository][status.SourceIP]
+
+		if !ok || status.LastSuccess.After(*seen.LastSuccess) {
+			latest[status.Repository][status.SourceIP] = status
+		}
+	}
+
+	for _, status := range f.self.status() {
+		add(status)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, statuses := range f.statuses {
+		for _, status := range statuses {
+			add(status)
+		}
+	}
+
+	return latest
+}
+
+// Collect delivers the fleet's view of the rate limits. It implements prometheus.Collector.
+func (f *fleet) Collect(ch chan<- prometheus.Metric) {
+	for repository, bySource := range f.latest() {
+		lowest := math.Inf(1)
+
+		for source, status := range bySource {
+			ch <- prometheus.MustNewConstMetric(f.remaining, prometheus.GaugeValue, status.Remaining, repository, source)
+			lowest = math.Min(lowest, status.Remaining)
+		}
+
+		ch <- prometheus.MustNewConstMetric(f.minRemaining, prometheus.GaugeValue, lowest, repository)
+		ch <- prometheus.MustNewConstMetric(f.sources, prometheus.GaugeValue, float64(len(bySource)), repository)
+	}
+
+	f.mu.Lock()
+	for _, peer := range f.peers {
+		up := 0.0
+		if f.up[peer] {
+			up = 1
+		}
+
+		ch <- prometheus.MustNewConstMetric(f.peerUp, prometheus.GaugeValue, up, peer)
+	}
+	f.mu.Unlock()
+
+	ch <- f.failures
+}
+
+// Describe describes the fleet's metrics. It implements prometheus.Collector.
+func (f *fleet) Describe(ch chan<- *prometheus.Desc) {
+	ch <- f.remaining
+	ch <- f.minRemaining
+	ch <- f.sources
+	ch <- f.peerUp
+	ch <- f.failures.Desc()
+}
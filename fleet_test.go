@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFleetViewCombinesThePeersRateLimits(t *testing.T) {
+	now := time.Now()
+
+	// An exporter for each of three egress IPs, one of which hasn't polled for a long time
+	newPeer := func(source string, remaining int, polled time.Time) *Exporter {
+		hub := registrytest.NewServer()
+		t.Cleanup(hub.Close)
+
+		hub.SetRateLimit(100, remaining)
+		hub.SetSource(source)
+
+		e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+		e.scrape(context.Background(), e.targets[0], polled)
+
+		return e
+	}
+
+	self := newPeer("192.0.2.1", 76, now)
+	peer := httptest.NewServer(rateLimitHandler(newPeer("192.0.2.2", 12, now)))
+	defer peer.Close()
+	stale := httptest.NewServer(rateLimitHandler(newPeer("192.0.2.3", 3, now.Add(-time.Hour))))
+	defer stale.Close()
+
+	f := newFleet([]string{peer.URL, stale.URL, "http://127.0.0.1:1"}, self, nil, 10*time.Minute)
+	f.pullAll()
+
+	expected := `
+# HELP dockerhub_exporter_fleet_pull_failures_total Number of errors while pulling the rate limits from the -peer exporters.
+# TYPE dockerhub_exporter_fleet_pull_failures_total counter
+dockerhub_exporter_fleet_pull_failures_total 1
+# HELP dockerhub_fleet_min_remaining_requests The lowest Docker Hub Rate Limit Remaining Requests across the egress IPs of the fleet.
+# TYPE dockerhub_fleet_min_remaining_requests gauge
+dockerhub_fleet_min_remaining_requests{repository="ratelimitpreview/test"} 12
+# HELP dockerhub_fleet_remaining_requests Docker Hub Rate Limit Remaining Requests last polled from each egress IP of the fleet.
+# TYPE dockerhub_fleet_remaining_requests gauge
+dockerhub_fleet_remaining_requests{repository="ratelimitpreview/test",source_ip="192.0.2.1"} 76
+dockerhub_fleet_remaining_requests{repository="ratelimitpreview/test",source_ip="192.0.2.2"} 12
+# HELP dockerhub_fleet_source_ips Number of egress IPs of the fleet with a recent poll of Docker Hub.
+# TYPE dockerhub_fleet_source_ips gauge
+dockerhub_fleet_source_ips{repository="ratelimitpreview/test"} 2
+`
+
+	if err := testutil.CollectAndCompare(f, strings.NewReader(expected),
+		"dockerhub_exporter_fleet_pull_failures_total", "dockerhub_fleet_min_remaining_requests",
+		"dockerhub_fleet_remaining_requests", "dockerhub_fleet_source_ips"); err != nil {
+		t.Error(err)
+	}
+
+	for peer, expected := range map[string]bool{peer.URL: true, stale.URL: true, "http://127.0.0.1:1": false} {
+		if f.up[peer] != expected {
+			t.Errorf("Expected %s to be up %v", peer, expected)
+		}
+	}
+}
+
+func TestFleetCountsPeersBehindTheSameEgressIPOnce(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	hub.SetSource("192.0.2.1")
+
+	self := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+	self.scrape(context.Background(), self.targets[0], time.Now().Add(-time.Minute))
+
+	hub.SetRateLimit(100, 50)
+	other := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+	other.scrape(context.Background(), other.targets[0], time.Now())
+
+	peer := httptest.NewServer(rateLimitHandler(other))
+	defer peer.Close()
+
+	f := newFleet([]string{peer.URL}, self, nil, 10*time.Minute)
+	f.pullAll()
+
+	latest := f.latest()[defaultRepository]
+
+	if len(latest) != 1 || latest["192.0.2.1"].Remaining != 50 {
+		t.Errorf("Expected the most recent poll from 192.0.2.1 only, got %+v", latest)
+	}
+}
@@ -0,0 +1,235 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	ghcrNamespace    = "ghcr"
+	defaultGitHubAPI = "https://api.github.com"
+	defaultGHCRURL   = "https://ghcr.io"
+	ghcrService      = "ghcr.io"
+	ghcrUsername     = "token" // sent with -ghcr-token, but GHCR only looks at the token
+)
+
+// ghcrCollector monitors the limits of the GitHub Container Registry alongside Docker Hub's: the
+// GitHub API's, from its rate_limit endpoint, which doesn't count against them, and the pull
+// quota of each -ghcr-repository, from the rate limit headers of a HEAD of its latest manifest
+// with a token from GHCR's token endpoint, as Docker Hub is polled. It polls whenever it's
+// collected, like the Exporter.
+type ghcrCollector struct {
+	apiURL       string
+	registryURL  string
+	token        string // a GitHub token, empty to poll anonymously
+	repositories []string
+	client       *http.Client
+
+	mu sync.Mutex // polls one at a time
+
+	apiUp, apiLimit, apiRemaining, apiUsed, apiReset *prometheus.Desc
+	pullUp, pullLimit, pullRemaining                 *prometheus.Desc
+}
+
+// ghcrRateLimits is the part of the GitHub API's rate_limit response which is exported.
+type ghcrRateLimits struct {
+	Resources map[string]struct {
+		Limit     float64 `json:"limit"`
+		Remaining float64 `json:"remaining"`
+		Used      float64 `json:"used"`
+		Reset     float64 `json:"reset"`
+	} `json:"resources"`
+}
+
+func newGHCRCollector(token string, repositories []string, client *http.Client) *ghcrCollector {
+	return &ghcrCollector{
+		apiURL:       defaultGitHubAPI,
+		registryURL:  defaultGHCRURL,
+		token:        token,
+		repositories: repositories,
+		client:       client,
+
+		apiUp: prometheus.NewDesc(
+			prometheus.BuildFQName(ghcrNamespace, "api", "up"),
+			"Whether the last poll of the GitHub API's rate limits succeeded (1) or not (0).",
+			nil, nil),
+		apiLimit: prometheus.NewDesc(
+			prometheus.BuildFQName(ghcrNamespace, "api", "limit_requests"),
+			"GitHub API Rate Limit Maximum Requests, by resource.",
+			[]string{"resource"}, nil),
+		apiRemaining: prometheus.NewDesc(
+			prometheus.BuildFQName(ghcrNamespace, "api", "remaining_requests"),
+			"GitHub API Rate Limit Remaining Requests, by resource.",
+			[]string{"resource"}, nil),
+		apiUsed: prometheus.NewDesc(
+			prometheus.BuildFQName(ghcrNamespace, "api", "used_requests"),
+			"GitHub API requests used in the current window, by resource.",
+			[]string{"resource"}, nil),
+		apiReset: prometheus.NewDesc(
+			prometheus.BuildFQName(ghcrNamespace, "api", "reset_timestamp_seconds"),
+			"When the GitHub API rate limit of the resource resets, as seconds since the epoch.",
+			[]string{"resource"}, nil),
+		pullUp: prometheus.NewDesc(
+			prometheus.BuildFQName(ghcrNamespace, "pull", "up"),
+			"Whether the last poll of the repository on GHCR succeeded (1) or not (0).",
+			[]string{"repository"}, nil),
+		pullLimit: prometheus.NewDesc(
+			prometheus.BuildFQName(ghcrNamespace, "limit", "max_requests"),
+			"GHCR Rate Limit Maximum Requests, when GHCR reports one.",
+			[]string{"repository"}, nil),
+		pullRemaining: prometheus.NewDesc(
+			prometheus.BuildFQName(ghcrNamespace, "limit", "remaining_requests"),
+			"GHCR Rate Limit Remaining Requests, when GHCR reports one.",
+			[]string{"repository"}, nil),
+	}
+}
+
+// Describe describes the GHCR metrics. It implements prometheus.Collector.
+func (g *ghcrCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- g.apiUp
+	ch <- g.apiLimit
+	ch <- g.apiRemaining
+	ch <- g.apiUsed
+	ch <- g.apiReset
+	ch <- g.pullUp
+	ch <- g.pullLimit
+	ch <- g.pullRemaining
+}
+
+// Collect polls GitHub and delivers the GHCR metrics. It implements prometheus.Collector.
+func (g *ghcrCollector) Collect(ch chan<- prometheus.Metric) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ctx := context.Background()
+	limits, err := g.fetchAPILimits(ctx)
+
+	if err != nil {
+		fmt.Printf("Unable to poll the GitHub API's rate limits: %v\n", err)
+		ch <- prometheus.MustNewConstMetric(g.apiUp, prometheus.GaugeValue, 0)
+	} else {
+		ch <- prometheus.MustNewConstMetric(g.apiUp, prometheus.GaugeValue, 1)
+
+		resources := make([]string, 0, len(limits.Resources))
+		for resource := range limits.Resources {
+			resources = append(resources, resource)
+		}
+
+		sort.Strings(resources)
+
+		for _, resource := range resources {
+			r := limits.Resources[resource]
+			ch <- prometheus.MustNewConstMetric(g.apiLimit, prometheus.GaugeValue, r.Limit, resource)
+			ch <- prometheus.MustNewConstMetric(g.apiRemaining, prometheus.GaugeValue, r.Remaining, resource)
+			ch <- prometheus.MustNewConstMetric(g.apiUsed, prometheus.GaugeValue, r.Used, resource)
+			ch <- prometheus.MustNewConstMetric(g.apiReset, prometheus.GaugeValue, r.Reset, resource)
+		}
+	}
+
+	for _, repository := range g.repositories {
+		header, err := g.fetchManifestHeaders(ctx, repository)
+
+		if err != nil {
+			fmt.Printf("Unable to poll %s on GHCR: %v\n", repository, err)
+			ch <- prometheus.MustNewConstMetric(g.pullUp, prometheus.GaugeValue, 0, repository)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(g.pullUp, prometheus.GaugeValue, 1, repository)
+
+		// GHCR doesn't always report a quota, so these are only exported when it does
+		if limit, remaining, err := parseRateLimitHeaders(header, defaultHeaderMapping); err == nil {
+			ch <- prometheus.MustNewConstMetric(g.pullLimit, prometheus.GaugeValue, limit, repository)
+			ch <- prometheus.MustNewConstMetric(g.pullRemaining, prometheus.GaugeValue, remaining, repository)
+		}
+	}
+}
+
+// fetchAPILimits reads the GitHub API's rate limits.
+func (g *ghcrCollector) fetchAPILimits(ctx context.Context) (*ghcrRateLimits, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", g.apiURL+"/rate_limit", nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	if g.token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.token)
+	}
+
+	res, err := fetchHTTP(ctx, g.client, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeResponse(res.Body)
+
+	var limits ghcrRateLimits
+
+	if err := json.NewDecoder(res.Body).Decode(&limits); err != nil {
+		return nil, &scrapeError{reason: failureReasonParse, err: err}
+	}
+
+	return &limits, nil
+}
+
+// fetchManifestHeaders gets a token to pull repository from GHCR, and returns the headers of a
+// HEAD of its latest manifest.
+func (g *ghcrCollector) fetchManifestHeaders(ctx context.Context, repository string) (http.Header, error) {
+	query := url.Values{"scope": {"repository:" + repository + ":pull"}, "service": {ghcrService}}
+	req, err := http.NewRequestWithContext(ctx, "GET", g.registryURL+"/token?"+query.Encode(), nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if g.token != "" {
+		req.SetBasicAuth(ghcrUsername, g.token)
+	}
+
+	res, err := fetchHTTP(ctx, g.client, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var token AuthTokenResponse
+	err = json.NewDecoder(res.Body).Decode(&token)
+	closeResponse(res.Body)
+
+	if err != nil {
+		return nil, &scrapeError{reason: failureReasonParse, err: err}
+	}
+
+	req, err = http.NewRequestWithContext(ctx, "HEAD", g.registryURL+"/v2/"+repository+"/manifests/latest", nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	req.Header.Set("Accept", "application/vnd.oci.image.index.v1+json, application/vnd.docker.distribution.manifest.list.v2+json")
+
+	res, err = fetchHTTP(ctx, g.client, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	closeResponse(res.Body)
+
+	return res.Header, nil
+}
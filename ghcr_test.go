@@ -0,0 +1,67 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestGHCRLimitsAreExported(t *testing.T) {
+	var username string
+
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rate_limit":
+			fmt.Fprint(w, `{"resources": {"core": {"limit": 5000, "remaining": 4990, "used": 10, "reset": 1605520800}}}`)
+		case "/token":
+			username, _, _ = r.BasicAuth()
+			fmt.Fprint(w, `{"token": "ghcr-token"}`)
+		case "/v2/myorg/myimage/manifests/latest":
+			if r.Header.Get("Authorization") != "Bearer ghcr-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", "1000;w=3600")
+			w.Header().Set("RateLimit-Remaining", "999;w=3600")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer github.Close()
+
+	g := newGHCRCollector("github-token", []string{"myorg/myimage", "myorg/missing"}, nil)
+	g.apiURL = github.URL
+	g.registryURL = github.URL
+
+	expected := `
+# HELP ghcr_api_remaining_requests GitHub API Rate Limit Remaining Requests, by resource.
+# TYPE ghcr_api_remaining_requests gauge
+ghcr_api_remaining_requests{resource="core"} 4990
+# HELP ghcr_api_up Whether the last poll of the GitHub API's rate limits succeeded (1) or not (0).
+# TYPE ghcr_api_up gauge
+ghcr_api_up 1
+# HELP ghcr_limit_remaining_requests GHCR Rate Limit Remaining Requests, when GHCR reports one.
+# TYPE ghcr_limit_remaining_requests gauge
+ghcr_limit_remaining_requests{repository="myorg/myimage"} 999
+# HELP ghcr_pull_up Whether the last poll of the repository on GHCR succeeded (1) or not (0).
+# TYPE ghcr_pull_up gauge
+ghcr_pull_up{repository="myorg/missing"} 0
+ghcr_pull_up{repository="myorg/myimage"} 1
+`
+
+	if err := testutil.CollectAndCompare(g, strings.NewReader(expected), "ghcr_api_up", "ghcr_api_remaining_requests", "ghcr_pull_up", "ghcr_limit_remaining_requests"); err != nil {
+		t.Fatal(err)
+	}
+
+	if username != ghcrUsername {
+		t.Errorf("Expected the GitHub token to be sent to GHCR, got username %q", username)
+	}
+}
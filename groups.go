@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var groupLabelRE = regexp.MustCompile(`^\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*=\s*"([^"]*)"\s*(,|$)`)
+
+// parseRepository parses a -repository flag, which is a repository, optionally followed by group
+// labels in the same form as a Prometheus selector, eg library/alpine{team="platform",env="prod"}.
+func parseRepository(flag string) (string, prometheus.Labels, error) {
+	open := strings.Index(flag, "{")
+
+	if open < 0 {
+		return flag, nil, nil
+	}
+
+	if !strings.HasSuffix(flag, "}") || open == 0 {
+		return "", nil, fmt.Errorf("repository %q should be <repository>{<label>=\"<value>\",...}", flag)
+	}
+
+	repository, rest := flag[:open], flag[open+1:len(flag)-1]
+	labels := prometheus.Labels{}
+
+	for strings.TrimSpace(rest) != "" {
+		match := groupLabelRE.FindStringSubmatch(rest)
+
+		if match == nil || strings.HasPrefix(match[1], "__") {
+			return "", nil, fmt.Errorf("repository %q has invalid labels at %q", flag, rest)
+		}
+
+		if _, ok := labels[match[1]]; ok {
+			return "", nil, fmt.Errorf("repository %q has label %q more than once", flag, match[1])
+		}
+
+		labels[match[1]] = match[2]
+		rest = rest[len(match[0]):]
+	}
+
+	return repository, labels, nil
+}
+
+// groupLabelsGatherer gathers from g, and adds the group labels for each repository to the series
+// about it, ie those with its repository label, so that teams and environments can be told apart
+// without relabelling rules. In aggregation mode they are added before aggregating, so that the
+// repositories are rolled up by group. A series which already has one of the labels keeps its own
+// value.
+func groupLabelsGatherer(g prometheus.Gatherer, groups map[string]prometheus.Labels) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+
+		for _, mf := range families {
+			for _, m := range mf.Metric {
+				for _, l := range m.Label {
+					if l.GetName() == "repository" {
+						m.Label = withConstLabels(m.Label, groups[l.GetValue()])
+						break
+					}
+				}
+			}
+
+			sortMetrics(mf.Metric)
+		}
+
+		return families, err
+	})
+}
+
+// sortMetrics sorts the series in a family as the Prometheus client does, by their number of labels
+// and then their values, since adding labels to some of them can leave them out of order.
+func sortMetrics(metrics []*dto.Metric) {
+	sort.SliceStable(metrics, func(i, j int) bool {
+		a, b := metrics[i].Label, metrics[j].Label
+
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+
+		for n := range a {
+			if a[n].GetValue() != b[n].GetValue() {
+				return a[n].GetValue() < b[n].GetValue()
+			}
+		}
+
+		return false
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRepositoriesCanHaveGroupLabels(t *testing.T) {
+	for flag, expected := range map[string]prometheus.Labels{
+		"library/alpine":                                          nil,
+		`library/alpine{team="platform"}`:                         {"team": "platform"},
+		`library/alpine{ team = "platform", env="prod" }`:         {"team": "platform", "env": "prod"},
+		`library/alpine{team="platform",cluster="eu-west-1",}`:    {"team": "platform", "cluster": "eu-west-1"},
+		`library/alpine{team="",environment="staging, not prod"}`: {"team": "", "environment": "staging, not prod"},
+	} {
+		repository, labels, err := parseRepository(flag)
+
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", flag, err)
+			continue
+		}
+
+		if repository != "library/alpine" || !reflect.DeepEqual(labels, expected) {
+			t.Errorf("Expected %v for %q, got %q %v", expected, flag, repository, labels)
+		}
+	}
+
+	for _, flag := range []string{
+		`library/alpine{team="platform"`,
+		`library/alpine{team=platform}`,
+		`library/alpine{team="a",team="b"}`,
+		`library/alpine{__name__="up"}`,
+		`{team="platform"}`,
+	} {
+		if _, _, err := parseRepository(flag); err == nil {
+			t.Errorf("Expected %q to be rejected", flag)
+		}
+	}
+}
+
+func TestGroupLabelsAreStampedOnTheSeriesForEachRepository(t *testing.T) {
+	e := NewExporter("http://localhost:0", "http://localhost:0", nil, nil)
+	e.remaining.WithLabelValues("library/alpine").Set(76)
+	e.remaining.WithLabelValues("library/redis").Set(70)
+	e.remaining.WithLabelValues("library/nginx").Set(60)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(e)
+
+	groups := map[string]prometheus.Labels{
+		"library/alpine": {"team": "platform", "env": "prod"},
+		"library/redis":  {"team": "data"},
+	}
+
+	expected := `
+# HELP dockerhub_exporter_expected_failures_total Number of errors while polling Docker Hub during a known maintenance window.
+# TYPE dockerhub_exporter_expected_failures_total counter
+dockerhub_exporter_expected_failures_total 0
+# HELP dockerhub_limit_remaining_requests_total Docker Hub Rate Limit Remaining Requests
+# TYPE dockerhub_limit_remaining_requests_total gauge
+dockerhub_limit_remaining_requests_total{env="prod",repository="library/alpine",team="platform"} 76
+dockerhub_limit_remaining_requests_total{repository="library/nginx"} 60
+dockerhub_limit_remaining_requests_total{repository="library/redis",team="data"} 70
+`
+
+	if err := testutil.GatherAndCompare(groupLabelsGatherer(registry, groups), strings.NewReader(expected),
+		"dockerhub_exporter_expected_failures_total", "dockerhub_limit_remaining_requests_total"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Aggregating afterwards rolls the repositories up by group
+	expected = `
+# HELP dockerhub_limit_remaining_requests_total Docker Hub Rate Limit Remaining Requests
+# TYPE dockerhub_limit_remaining_requests_total gauge
+dockerhub_limit_remaining_requests_total 60
+dockerhub_limit_remaining_requests_total{env="prod",team="platform"} 76
+dockerhub_limit_remaining_requests_total{team="data"} 70
+`
+
+	if err := testutil.GatherAndCompare(aggregatingGatherer(groupLabelsGatherer(registry, groups)), strings.NewReader(expected),
+		"dockerhub_limit_remaining_requests_total"); err != nil {
+		t.Fatal(err)
+	}
+}
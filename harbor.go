@@ -0,0 +1,286 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	harborNamespace = "harbor"
+	harborService   = "harbor-registry"
+)
+
+// harborCollector monitors Harbor proxy-cache projects in front of Docker Hub, from Harbor's API:
+// their storage quota and usage, how many pulls Harbor has served from them, and whether Harbor
+// can reach the upstream registry. Alongside the exporter's own metrics, that shows how much the
+// cache saves of Docker Hub's rate limit. Harbor checks each manifest by tag with the upstream, so
+// a HEAD of -harbor-probe-repository through each project also shows Docker Hub's rate limit as
+// Harbor sees it, when Harbor passes on the headers. It polls whenever it's collected, like the
+// Exporter.
+type harborCollector struct {
+	url      string
+	username string
+	password string
+	projects []string
+	probe    string // the repository to HEAD through each project, empty not to
+	client   *http.Client
+
+	mu sync.Mutex // polls one at a time
+
+	up, proxyCache, quota, used, repositories, pulls *prometheus.Desc
+	upstreamUp, upstreamLimit, upstreamRemaining     *prometheus.Desc
+}
+
+// harborProject is the part of Harbor's project API which is exported.
+type harborProject struct {
+	ProjectID  int64 `json:"project_id"`
+	RegistryID int64 `json:"registry_id"` // the upstream registry of a proxy-cache project, 0 otherwise
+	RepoCount  int64 `json:"repo_count"`
+}
+
+func newHarborCollector(harborURL, username, password string, projects []string, probe string, client *http.Client) *harborCollector {
+	desc := func(subsystem, name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(harborNamespace, subsystem, name), help, labels, nil)
+	}
+
+	return &harborCollector{
+		url:      strings.TrimRight(harborURL, "/"),
+		username: username,
+		password: password,
+		projects: projects,
+		probe:    probe,
+		client:   client,
+
+		up:           desc("project", "up", "Whether the last poll of the project from Harbor's API succeeded (1) or not (0).", "project"),
+		proxyCache:   desc("project", "proxy_cache", "Whether the project is a proxy cache (1) or not (0).", "project"),
+		quota:        desc("project", "quota_storage_bytes", "The project's storage quota, -1 for unlimited.", "project"),
+		used:         desc("project", "used_storage_bytes", "The storage that the project uses.", "project"),
+		repositories: desc("project", "repositories", "Number of repositories in the project.", "project"),
+		pulls:        desc("project", "pulls_total", "Number of pulls of the project's repositories which Harbor has served.", "project"),
+
+		upstreamUp:        desc("upstream", "up", "Whether Harbor reports the project's upstream registry as healthy (1) or not (0).", "project", "upstream"),
+		upstreamLimit:     desc("upstream", "limit_max_requests", "Docker Hub Rate Limit Maximum Requests as Harbor sees it, when it passes on the headers.", "project"),
+		upstreamRemaining: desc("upstream", "limit_remaining_requests", "Docker Hub Rate Limit Remaining Requests as Harbor sees it, when it passes on the headers.", "project"),
+	}
+}
+
+// Describe describes the Harbor metrics. It implements prometheus.Collector.
+func (h *harborCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- h.up
+	ch <- h.proxyCache
+	ch <- h.quota
+	ch <- h.used
+	ch <- h.repositories
+	ch <- h.pulls
+	ch <- h.upstreamUp
+	ch <- h.upstreamLimit
+	ch <- h.upstreamRemaining
+}
+
+// Collect polls Harbor and delivers its metrics. It implements prometheus.Collector.
+func (h *harborCollector) Collect(ch chan<- prometheus.Metric) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ctx := context.Background()
+
+	for _, project := range h.projects {
+		if err := h.collectProject(ctx, project, ch); err != nil {
+			fmt.Printf("Unable to poll the Harbor project %s: %v\n", project, err)
+			ch <- prometheus.MustNewConstMetric(h.up, prometheus.GaugeValue, 0, project)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(h.up, prometheus.GaugeValue, 1, project)
+	}
+}
+
+// collectProject delivers the metrics about project, but not whether it could be polled.
+func (h *harborCollector) collectProject(ctx context.Context, project string, ch chan<- prometheus.Metric) error {
+	var p harborProject
+
+	if err := h.get(ctx, "/projects/"+url.PathEscape(project), &p); err != nil {
+		return err
+	}
+
+	var quotas []struct {
+		Hard map[string]float64 `json:"hard"`
+		Used map[string]float64 `json:"used"`
+	}
+
+	if err := h.get(ctx, "/quotas?reference=project&reference_id="+strconv.FormatInt(p.ProjectID, 10), &quotas); err != nil {
+		return err
+	}
+
+	pulls, err := h.countPulls(ctx, project)
+
+	if err != nil {
+		return err
+	}
+
+	proxyCache := 0.0
+	if p.RegistryID != 0 {
+		proxyCache = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(h.proxyCache, prometheus.GaugeValue, proxyCache, project)
+	ch <- prometheus.MustNewConstMetric(h.repositories, prometheus.GaugeValue, float64(p.RepoCount), project)
+	ch <- prometheus.MustNewConstMetric(h.pulls, prometheus.CounterValue, pulls, project)
+
+	if len(quotas) > 0 {
+		ch <- prometheus.MustNewConstMetric(h.quota, prometheus.GaugeValue, quotas[0].Hard["storage"], project)
+		ch <- prometheus.MustNewConstMetric(h.used, prometheus.GaugeValue, quotas[0].Used["storage"], project)
+	}
+
+	if p.RegistryID == 0 {
+		return nil
+	}
+
+	var registry struct {
+		URL    string `json:"url"`
+		Status string `json:"status"`
+	}
+
+	if err := h.get(ctx, "/registries/"+strconv.FormatInt(p.RegistryID, 10), &registry); err != nil {
+		return err
+	}
+
+	healthy := 0.0
+	if registry.Status == "healthy" {
+		healthy = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(h.upstreamUp, prometheus.GaugeValue, healthy, project, registry.URL)
+
+	if h.probe == "" {
+		return nil
+	}
+
+	header, err := h.probeUpstream(ctx, project)
+
+	if err != nil {
+		// The project's own metrics are still good, so this doesn't fail the poll
+		fmt.Printf("Unable to probe %s through the Harbor project %s: %v\n", h.probe, project, err)
+		return nil
+	}
+
+	if limit, remaining, err := parseRateLimitHeaders(header, defaultHeaderMapping); err == nil {
+		ch <- prometheus.MustNewConstMetric(h.upstreamLimit, prometheus.GaugeValue, limit, project)
+		ch <- prometheus.MustNewConstMetric(h.upstreamRemaining, prometheus.GaugeValue, remaining, project)
+	}
+
+	return nil
+}
+
+// countPulls adds up the pulls of each of project's repositories, a page at a time.
+func (h *harborCollector) countPulls(ctx context.Context, project string) (float64, error) {
+	const pageSize = 100
+	var pulls float64
+
+	for page := 1; ; page++ {
+		var repositories []struct {
+			PullCount float64 `json:"pull_count"`
+		}
+
+		path := fmt.Sprintf("/projects/%s/repositories?page=%d&page_size=%d", url.PathEscape(project), page, pageSize)
+
+		if err := h.get(ctx, path, &repositories); err != nil {
+			return 0, err
+		}
+
+		for _, r := range repositories {
+			pulls += r.PullCount
+		}
+
+		if len(repositories) < pageSize {
+			return pulls, nil
+		}
+	}
+}
+
+// get reads the JSON response of one of Harbor's v2.0 API endpoints into v.
+func (h *harborCollector) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", h.url+"/api/v2.0"+path, nil)
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	if h.username != "" {
+		req.SetBasicAuth(h.username, h.password)
+	}
+
+	res, err := fetchHTTP(ctx, h.client, req)
+
+	if err != nil {
+		return err
+	}
+
+	defer closeResponse(res.Body)
+
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return &scrapeError{reason: failureReasonParse, err: err}
+	}
+
+	return nil
+}
+
+// probeUpstream returns the headers of a HEAD of the latest manifest of h.probe through project.
+func (h *harborCollector) probeUpstream(ctx context.Context, project string) (http.Header, error) {
+	repository := project + "/" + h.probe
+	query := url.Values{"scope": {"repository:" + repository + ":pull"}, "service": {harborService}}
+	req, err := http.NewRequestWithContext(ctx, "GET", h.url+"/service/token?"+query.Encode(), nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if h.username != "" {
+		req.SetBasicAuth(h.username, h.password)
+	}
+
+	res, err := fetchHTTP(ctx, h.client, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var token AuthTokenResponse
+	err = json.NewDecoder(res.Body).Decode(&token)
+	closeResponse(res.Body)
+
+	if err != nil {
+		return nil, &scrapeError{reason: failureReasonParse, err: err}
+	}
+
+	req, err = http.NewRequestWithContext(ctx, "HEAD", h.url+"/v2/"+repository+"/manifests/latest", nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+
+	res, err = fetchHTTP(ctx, h.client, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	closeResponse(res.Body)
+
+	return res.Header, nil
+}
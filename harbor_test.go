@@ -0,0 +1,74 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHarborProxyCachesAreMonitored(t *testing.T) {
+	harbor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); r.URL.Path != "/v2/dockerhub/ratelimitpreview/test/manifests/latest" && (!ok || user != "robot" || pass != "secret") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/api/v2.0/projects/dockerhub":
+			fmt.Fprint(w, `{"project_id": 3, "registry_id": 1, "repo_count": 2}`)
+		case "/api/v2.0/quotas":
+			if r.URL.Query().Get("reference_id") != "3" {
+				http.NotFound(w, r)
+				return
+			}
+
+			fmt.Fprint(w, `[{"hard": {"storage": 10737418240}, "used": {"storage": 1073741824}}]`)
+		case "/api/v2.0/projects/dockerhub/repositories":
+			fmt.Fprint(w, `[{"pull_count": 40}, {"pull_count": 2}]`)
+		case "/api/v2.0/registries/1":
+			fmt.Fprint(w, `{"url": "https://hub.docker.com", "status": "healthy"}`)
+		case "/service/token":
+			fmt.Fprint(w, `{"token": "harbor-token"}`)
+		case "/v2/dockerhub/ratelimitpreview/test/manifests/latest":
+			w.Header().Set("RateLimit-Limit", "200;w=21600")
+			w.Header().Set("RateLimit-Remaining", "150;w=21600")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer harbor.Close()
+
+	h := newHarborCollector(harbor.URL, "robot", "secret", []string{"dockerhub", "missing"}, defaultRepository, nil)
+
+	expected := `
+# HELP harbor_project_pulls_total Number of pulls of the project's repositories which Harbor has served.
+# TYPE harbor_project_pulls_total counter
+harbor_project_pulls_total{project="dockerhub"} 42
+# HELP harbor_project_up Whether the last poll of the project from Harbor's API succeeded (1) or not (0).
+# TYPE harbor_project_up gauge
+harbor_project_up{project="dockerhub"} 1
+harbor_project_up{project="missing"} 0
+# HELP harbor_project_used_storage_bytes The storage that the project uses.
+# TYPE harbor_project_used_storage_bytes gauge
+harbor_project_used_storage_bytes{project="dockerhub"} 1.073741824e+09
+# HELP harbor_upstream_limit_remaining_requests Docker Hub Rate Limit Remaining Requests as Harbor sees it, when it passes on the headers.
+# TYPE harbor_upstream_limit_remaining_requests gauge
+harbor_upstream_limit_remaining_requests{project="dockerhub"} 150
+# HELP harbor_upstream_up Whether Harbor reports the project's upstream registry as healthy (1) or not (0).
+# TYPE harbor_upstream_up gauge
+harbor_upstream_up{project="dockerhub",upstream="https://hub.docker.com"} 1
+`
+
+	if err := testutil.CollectAndCompare(h, strings.NewReader(expected),
+		"harbor_project_pulls_total", "harbor_project_up", "harbor_project_used_storage_bytes",
+		"harbor_upstream_limit_remaining_requests", "harbor_upstream_up"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// healthzHandler reports that the process is alive and serving HTTP.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte("OK\n"))
+}
+
+// readyzHandler reports whether e has valid credentials and has been able to poll Docker Hub
+// recently, so that a broken exporter can be taken out of service. It only looks at what the polls
+// recorded, so that probes don't use up any of the rate limit, or wait for a poll in progress.
+func readyzHandler(e *Exporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := e.ready(); err != nil {
+			http.Error(w, fmt.Sprintf("Not ready: %v", err), http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = w.Write([]byte("OK\n"))
+	}
+}
+
+// ready returns an error unless each target has been polled successfully, Docker Hub accepted the
+// credentials the last time a token was requested with them, and polling hasn't been failing for
+// longer than readyMaxAge.
+func (e *Exporter) ready() error {
+	e.rlock()
+	defer e.mu.RUnlock()
+
+	now := e.clock()
+
+	for _, t := range e.targets {
+		if t.tokenErr != nil {
+			return fmt.Errorf("unable to validate credentials for %s: %v", t.repository, t.tokenErr)
+		}
+
+		if t.lastSuccess.IsZero() {
+			return fmt.Errorf("no successful poll of Docker Hub for %s yet", t.repository)
+		}
+
+		if !t.failingSince.IsZero() {
+			if age := now.Sub(t.lastSuccess); age > e.readyMaxAge {
+				return fmt.Errorf("no successful poll of Docker Hub for %s for %v", t.repository, age.Round(time.Second))
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func readyzStatus(e *Exporter) int {
+	rec := httptest.NewRecorder()
+	readyzHandler(e).ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+
+	return rec.Code
+}
+
+func TestHealthzIsAlwaysOK(t *testing.T) {
+	rec := httptest.NewRecorder()
+	healthzHandler(rec, httptest.NewRequest("GET", "/healthz", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+}
+
+func TestReadyOnceDockerHubHasBeenPolled(t *testing.T) {
+	var tokenRequests int32
+
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&tokenRequests, 1)
+		writeResponse(w, r, &mockResponse{response: authResponseBody()})
+	}))
+	defer authServer.Close()
+
+	rateLimitServer := httptest.NewServer(handler(&mockResponse{
+		headers: map[string][]string{
+			"RateLimit-Limit":     {"100;w=21600"},
+			"RateLimit-Remaining": {"76;w=21600"},
+		},
+	}))
+	defer rateLimitServer.Close()
+
+	exporter := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository}, nil)
+
+	if status := readyzStatus(exporter); status != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 before the first poll, got %d", status)
+	}
+
+	exporter.scrape(context.Background(), exporter.targets[0], time.Now())
+
+	for i := 0; i < 3; i++ {
+		if status := readyzStatus(exporter); status != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", status)
+		}
+	}
+
+	if n := atomic.LoadInt32(&tokenRequests); n != 1 {
+		t.Errorf("Expected probes not to request tokens, got %d token requests", n)
+	}
+}
+
+func TestNotReadyWhenCredentialsAreRejected(t *testing.T) {
+	authServer := httptest.NewServer(basicAuth(handler(&mockResponse{
+		response: authResponseBody(),
+	})))
+	defer authServer.Close()
+
+	exporter := NewExporter(authServer.URL, "http://localhost:0", []string{defaultRepository},
+		&credentials{
+			username:   "username",
+			passphrase: "not-the-correct-password",
+		})
+
+	// Even after a successful poll, eg from the state file
+	exporter.targets[0].lastSuccess = time.Now()
+	exporter.scrape(context.Background(), exporter.targets[0], time.Now())
+
+	if status := readyzStatus(exporter); status != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503, got %d", status)
+	}
+}
+
+func TestNotReadyWhenPollingHasFailedForTooLong(t *testing.T) {
+	authServer := httptest.NewServer(handler(&mockResponse{
+		response: authResponseBody(),
+	}))
+	defer authServer.Close()
+
+	rateLimitServer := httptest.NewServer(subsequentRequestsFailHandler(&mockResponse{
+		headers: map[string][]string{
+			"RateLimit-Limit":     {"100;w=21600"},
+			"RateLimit-Remaining": {"76;w=21600"},
+		},
+	}))
+	defer rateLimitServer.Close()
+
+	now := time.Now()
+	exporter := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository}, nil)
+	exporter.clock = func() time.Time { return now }
+	exporter.scrape(context.Background(), exporter.targets[0], now)
+
+	now = now.Add(time.Minute)
+	exporter.scrape(context.Background(), exporter.targets[0], now)
+
+	if status := readyzStatus(exporter); status != http.StatusOK {
+		t.Fatalf("Expected a recent failure to still be ready, got %d", status)
+	}
+
+	now = now.Add(defaultReadyMaxAge)
+
+	if status := readyzStatus(exporter); status != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503, got %d", status)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// defaultHistorySize is how many polls of each repository /history keeps, 6 hours' worth at the
+// usual scrape interval of a minute.
+const defaultHistorySize = 360
+
+// historySample is the remaining requests from a successful poll.
+type historySample struct {
+	Time      time.Time `json:"time"`
+	Remaining float64   `json:"remaining"`
+}
+
+// sampleRing keeps the latest samples, up to a fixed number, so that the memory it uses is bounded
+// however long the exporter runs.
+type sampleRing struct {
+	samples []historySample
+	next    int  // where the next sample goes
+	full    bool // whether next has wrapped around, so the oldest sample is at next
+}
+
+func newSampleRing(size int) *sampleRing {
+	return &sampleRing{samples: make([]historySample, size)}
+}
+
+func (r *sampleRing) add(t time.Time, remaining float64) {
+	r.samples[r.next] = historySample{Time: t, Remaining: remaining}
+	r.next = (r.next + 1) % len(r.samples)
+
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// all returns the samples, oldest first.
+func (r *sampleRing) all() []historySample {
+	if !r.full {
+		return append([]historySample{}, r.samples[:r.next]...)
+	}
+
+	return append(append([]historySample{}, r.samples[r.next:]...), r.samples[:r.next]...)
+}
+
+// repositoryHistory is the recent history of a repository's remaining requests.
+type repositoryHistory struct {
+	Repository string          `json:"repository"`
+	Limit      float64         `json:"limit"`
+	Samples    []historySample `json:"samples"`
+}
+
+func (e *Exporter) recentHistory() []repositoryHistory {
+	e.rlock()
+	defer e.mu.RUnlock()
+
+	histories := []repositoryHistory{}
+
+	for _, t := range e.targets {
+		if t.history != nil {
+			histories = append(histories, repositoryHistory{Repository: t.repository, Limit: t.lastLimit, Samples: t.history.all()})
+		}
+	}
+
+	return histories
+}
+
+// recentHistoryHandler serves the recent history of the remaining requests of each repository, as
+// JSON, as a page of sparklines with ?format=html, for a quick look on a host which nothing
+// scrapes yet, or as CSV with ?format=csv. With -history-db, ?since=<duration> serves the history
+// from that instead.
+func recentHistoryHandler(e *Exporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		histories := e.recentHistory()
+
+		// Further back than is kept in memory, from -history-db
+		if since := r.URL.Query().Get("since"); since != "" {
+			d, err := time.ParseDuration(since)
+
+			if err != nil || d <= 0 {
+				http.Error(w, "since must be a positive duration, eg 168h", http.StatusBadRequest)
+				return
+			}
+
+			if e.historyDB == nil {
+				http.Error(w, "since needs -history-db", http.StatusBadRequest)
+				return
+			}
+
+			if histories, err = e.storedHistory(e.clock().Add(-d)); err != nil {
+				http.Error(w, "Unable to read the history: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if r.URL.Query().Get("format") == "csv" {
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", `attachment; filename="dockerhub_exporter_history.csv"`)
+			_ = writeHistoryCSV(w, histories)
+			return
+		}
+
+		if r.URL.Query().Get("format") != "html" {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(histories)
+			return
+		}
+
+		serveHistoryHTML(w, histories)
+	}
+}
@@ -0,0 +1,72 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// serveHistoryHTML serves the histories as a page of sparklines.
+func serveHistoryHTML(w http.ResponseWriter, histories []repositoryHistory) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = historyPage.Execute(w, histories)
+}
+
+const (
+	sparklineWidth  = 360
+	sparklineHeight = 40
+)
+
+// sparkline returns the SVG polyline points of the samples, scaled to the limit, or to the most
+// remaining if the limit isn't known.
+func sparkline(h repositoryHistory) string {
+	if len(h.Samples) == 0 {
+		return ""
+	}
+
+	top := h.Limit
+	for _, s := range h.Samples {
+		if s.Remaining > top {
+			top = s.Remaining
+		}
+	}
+
+	if top <= 0 {
+		top = 1
+	}
+
+	step := float64(sparklineWidth)
+	if len(h.Samples) > 1 {
+		step = float64(sparklineWidth) / float64(len(h.Samples)-1)
+	}
+
+	points := make([]string, len(h.Samples))
+	for i, s := range h.Samples {
+		points[i] = fmt.Sprintf("%.1f,%.1f", float64(i)*step, sparklineHeight*(1-s.Remaining/top))
+	}
+
+	return strings.Join(points, " ")
+}
+
+var historyPage = template.Must(template.New("history").Funcs(template.FuncMap{
+	"sparkline": sparkline,
+	"last": func(samples []historySample) historySample {
+		return samples[len(samples)-1]
+	},
+}).Parse(`<html>
+<head><title>Docker Hub Exporter history</title></head>
+<body>
+<h1>Remaining requests</h1>
+{{range .}}<h2>{{.Repository}}</h2>
+{{if .Samples}}<svg width="` + fmt.Sprint(sparklineWidth) + `" height="` + fmt.Sprint(sparklineHeight) + `" style="overflow: visible">
+<polyline fill="none" stroke="steelblue" stroke-width="1.5" points="{{sparkline .}}"/>
+</svg>
+<p>{{(last .Samples).Remaining}} of {{.Limit}} at {{(last .Samples).Time.Format "2006-01-02 15:04:05 MST"}}, {{len .Samples}} polls</p>
+{{else}}<p>No polls yet</p>
+{{end}}{{end}}</body>
+</html>
+`))
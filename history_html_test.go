@@ -0,0 +1,36 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryIsServedAsSparklines(t *testing.T) {
+	now := time.Date(2020, 11, 16, 10, 0, 0, 0, time.UTC)
+	histories := []repositoryHistory{
+		{Repository: defaultRepository, Limit: 100, Samples: []historySample{
+			{Time: now, Remaining: 100},
+			{Time: now.Add(time.Minute), Remaining: 90},
+			{Time: now.Add(2 * time.Minute), Remaining: 75},
+		}},
+		{Repository: "library/alpine"},
+	}
+
+	w := httptest.NewRecorder()
+	serveHistoryHTML(w, histories)
+
+	for _, expected := range []string{
+		`<polyline fill="none" stroke="steelblue" stroke-width="1.5" points="0.0,0.0 180.0,4.0 360.0,10.0"/>`,
+		"75 of 100 at 2020-11-16 10:02:00 UTC, 3 polls",
+		"<h2>library/alpine</h2>\n<p>No polls yet</p>",
+	} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("Expected %q in the page, got %s", expected, w.Body)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+)
+
+func TestSampleRingKeepsTheLatestSamples(t *testing.T) {
+	ring := newSampleRing(3)
+	start := time.Date(2020, 11, 16, 10, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 5; i++ {
+		ring.add(start.Add(time.Duration(i)*time.Minute), float64(100-i))
+	}
+
+	samples := ring.all()
+
+	if len(samples) != 3 || samples[0].Remaining != 98 || samples[2].Remaining != 96 {
+		t.Errorf("Expected the last 3 samples, oldest first, got %+v", samples)
+	}
+}
+
+func TestHistoryIsServedAsJSON(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	now := time.Date(2020, 11, 16, 10, 0, 0, 0, time.UTC)
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository, "library/alpine"}, nil)
+	e.targets[0].history = newSampleRing(defaultHistorySize)
+	e.targets[1].history = newSampleRing(defaultHistorySize)
+
+	for i, remaining := range []int{100, 90, 75} {
+		hub.SetRateLimit(100, remaining)
+		e.scrape(context.Background(), e.targets[0], now.Add(time.Duration(i)*time.Minute))
+	}
+
+	w := httptest.NewRecorder()
+	recentHistoryHandler(e)(w, httptest.NewRequest("GET", "/history", nil))
+
+	var histories []repositoryHistory
+	if err := json.NewDecoder(w.Body).Decode(&histories); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(histories) != 2 || histories[0].Limit != 100 || len(histories[0].Samples) != 3 || histories[0].Samples[2].Remaining != 75 || len(histories[1].Samples) != 0 {
+		t.Errorf("Unexpected history %+v", histories)
+	}
+
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultHistoryRetention is how long -history-db keeps the polls for.
+const defaultHistoryRetention = 30 * 24 * time.Hour
+
+// historyCompactionInterval is how often -history-db drops the polls older than its retention.
+const historyCompactionInterval = 24 * time.Hour
+
+// historyIndexInterval is how far apart in time the polls that historyDB keeps the offset of are.
+const historyIndexInterval = time.Hour
+
+// historyIndexSlack allows for polls of different repositories being appended slightly out of
+// order, as they're polled concurrently.
+const historyIndexSlack = time.Minute
+
+// historyRecord is a poll of a repository, as -history-db keeps it.
+type historyRecord struct {
+	Time       time.Time `json:"time"`
+	Repository string    `json:"repository"`
+	Limit      float64   `json:"limit"`
+	Remaining  float64   `json:"remaining"`
+}
+
+// historyDB keeps each successful poll on disk, for hosts where there's no Prometheus and the
+// exporter is the only record of consumption, so that /history carries on across restarts. It's a
+// file of JSON lines, which is only ever appended to apart from dropping the polls older than the
+// retention once a day, rather than an embedded database, which would be another dependency for
+// not much more. A line torn by a crash is skipped when the file is read.
+//
+// So that /history doesn't read all of the retention each time, it keeps the offset in the file of
+// a poll every historyIndexInterval, and reads from the last one before the time asked for.
+type historyDB struct {
+	path      string
+	retention time.Duration
+
+	mu    sync.Mutex
+	file  *os.File
+	size  int64
+	marks []historyMark
+}
+
+// historyMark is where in the file a poll starts.
+type historyMark struct {
+	time   time.Time
+	offset int64
+}
+
+// openHistoryDB opens the history at path, creating it if there isn't one yet, and drops the polls
+// older than retention.
+func openHistoryDB(path string, retention time.Duration, now time.Time) (*historyDB, error) {
+	db := &historyDB{path: path, retention: retention}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if err := db.compact(now); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// read returns the polls since the given time, oldest first.
+func (db *historyDB) read(since time.Time) ([]historyRecord, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.readLocked(since)
+}
+
+func (db *historyDB) readLocked(since time.Time) ([]historyRecord, error) {
+	f, err := os.Open(db.path)
+
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	if offset := db.offset(since); offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	var records []historyRecord
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		var r historyRecord
+
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+
+		if !r.Time.Before(since) {
+			records = append(records, r)
+		}
+	}
+
+	return records, scanner.Err()
+}
+
+// offset returns where in the file to start reading the polls since the given time from. The
+// caller must hold db.mu.
+func (db *historyDB) offset(since time.Time) int64 {
+	since = since.Add(-historyIndexSlack)
+	i := sort.Search(len(db.marks), func(i int) bool { return db.marks[i].time.After(since) })
+
+	if i == 0 {
+		return 0
+	}
+
+	return db.marks[i-1].offset
+}
+
+// addMark adds that r starts at offset to marks, if it's historyIndexInterval since the last one.
+func addMark(marks []historyMark, r historyRecord, offset int64) []historyMark {
+	if n := len(marks); n > 0 && r.Time.Sub(marks[n-1].time) < historyIndexInterval {
+		return marks
+	}
+
+	return append(marks, historyMark{time: r.Time, offset: offset})
+}
+
+// append adds a poll to the history.
+func (db *historyDB) append(r historyRecord) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	b, err := json.Marshal(r)
+
+	if err != nil {
+		return err
+	}
+
+	db.marks = addMark(db.marks, r, db.size)
+	n, err := db.file.Write(append(b, '\n'))
+	db.size += int64(n)
+
+	return err
+}
+
+// run drops the polls older than the retention every interval, forever, away from the polls.
+func (db *historyDB) run(interval time.Duration) {
+	for range time.Tick(interval) {
+		db.mu.Lock()
+		err := db.compact(time.Now())
+		db.mu.Unlock()
+
+		if err != nil {
+			fmt.Printf("Unable to compact the history: %v\n", err)
+		}
+	}
+}
+
+// compact replaces the file with one without the polls older than the retention, like saveState
+// does, so that a crash can't lose the history, and reopens it for appending. The caller must
+// hold db.mu.
+func (db *historyDB) compact(now time.Time) error {
+	records, err := db.readLocked(now.Add(-db.retention))
+
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(db.path), filepath.Base(db.path))
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(f.Name())
+
+	w := bufio.NewWriter(f)
+	var size int64
+	var marks []historyMark
+
+	for _, r := range records {
+		b, err := json.Marshal(r)
+
+		if err != nil {
+			_ = f.Close()
+			return err
+		}
+
+		marks = addMark(marks, r, size)
+
+		if _, err := w.Write(append(b, '\n')); err != nil {
+			_ = f.Close()
+			return err
+		}
+
+		size += int64(len(b) + 1)
+	}
+
+	if err := w.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if db.file != nil {
+		_ = db.file.Close()
+	}
+
+	if err := os.Rename(f.Name(), db.path); err != nil {
+		return err
+	}
+
+	db.file, err = os.OpenFile(db.path, os.O_APPEND|os.O_WRONLY, 0600)
+	db.size = size
+	db.marks = marks
+
+	return err
+}
+
+// loadHistory fills the targets' recent history from db, and keeps each poll in it from then on.
+func (e *Exporter) loadHistory(db *historyDB) error {
+	records, err := db.read(time.Time{})
+
+	if err != nil {
+		return err
+	}
+
+	e.lock()
+	defer e.mu.Unlock()
+
+	e.historyDB = db
+
+	targets := map[string]*target{}
+	for _, t := range e.targets {
+		targets[t.repository] = t
+	}
+
+	for _, r := range records {
+		if t, ok := targets[r.Repository]; ok && t.history != nil {
+			t.history.add(r.Time, r.Remaining)
+		}
+	}
+
+	return nil
+}
+
+// storedHistory returns the history of each repository from the polls in e.historyDB since the
+// given time.
+func (e *Exporter) storedHistory(since time.Time) ([]repositoryHistory, error) {
+	records, err := e.historyDB.read(since)
+
+	if err != nil {
+		return nil, err
+	}
+
+	histories := []repositoryHistory{}
+	index := map[string]int{}
+
+	for _, r := range records {
+		i, ok := index[r.Repository]
+
+		if !ok {
+			i = len(histories)
+			index[r.Repository] = i
+			histories = append(histories, repositoryHistory{Repository: r.Repository, Samples: []historySample{}})
+		}
+
+		histories[i].Limit = r.Limit
+		histories[i].Samples = append(histories[i].Samples, historySample{Time: r.Time, Remaining: r.Remaining})
+	}
+
+	return histories, nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+)
+
+func TestHistoryDBSurvivesRestarts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "historydb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "history.jsonl")
+	now := time.Date(2020, 11, 16, 10, 0, 0, 0, time.UTC)
+
+	db, err := openHistoryDB(path, 24*time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range []historyRecord{
+		{Time: now.Add(-48 * time.Hour), Repository: defaultRepository, Limit: 100, Remaining: 10},
+		{Time: now.Add(-time.Hour), Repository: defaultRepository, Limit: 100, Remaining: 90},
+		{Time: now.Add(-time.Hour), Repository: "library/gone", Limit: 100, Remaining: 50},
+	} {
+		if err := db.append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// As if the exporter crashed part way through writing a poll
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	f.WriteString(`{"time": "2020-11-16T09:`)
+	f.Close()
+
+	// Restarting drops the polls older than the retention
+	db, err = openHistoryDB(path, 24*time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	hub.SetRateLimit(100, 76)
+
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+	e.clock = func() time.Time { return now }
+	e.targets[0].history = newSampleRing(defaultHistorySize)
+
+	if err := e.loadHistory(db); err != nil {
+		t.Fatal(err)
+	}
+
+	e.scrape(context.Background(), e.targets[0], now)
+
+	samples := e.targets[0].history.all()
+	if len(samples) != 2 || samples[0].Remaining != 90 || samples[1].Remaining != 76 {
+		t.Errorf("Expected the recent history to carry on from the stored polls, got %+v", samples)
+	}
+
+	w := httptest.NewRecorder()
+	recentHistoryHandler(e)(w, httptest.NewRequest("GET", "/history?since=72h", nil))
+
+	var histories []repositoryHistory
+	if err := json.NewDecoder(w.Body).Decode(&histories); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(histories) != 2 || histories[0].Repository != defaultRepository || len(histories[0].Samples) != 2 || histories[1].Repository != "library/gone" {
+		t.Errorf("Unexpected stored history %+v", histories)
+	}
+}
+
+func TestHistoryDBOnlyReadsFromAroundTheTimeAskedFor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "historydb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "history.jsonl")
+	now := time.Date(2020, 11, 16, 10, 0, 0, 0, time.UTC)
+
+	db, err := openHistoryDB(path, 7*24*time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := now.Add(-6 * 24 * time.Hour)
+	for ts := start; !ts.After(now); ts = ts.Add(10 * time.Minute) {
+		if err := db.append(historyRecord{Time: ts, Repository: defaultRepository, Limit: 100, Remaining: 50}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(db.marks) != 6*24+1 {
+		t.Errorf("Expected a mark each hour, got %d", len(db.marks))
+	}
+
+	if offset := db.offset(now.Add(-time.Hour)); offset == 0 {
+		t.Errorf("Expected to skip the polls before the last hour or so")
+	}
+
+	since := now.Add(-90 * time.Minute)
+	records, err := db.read(since)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 10 || !records[0].Time.Equal(since) {
+		t.Errorf("Expected the 10 polls since %s, got %d from %+v", since, len(records), records[0])
+	}
+
+	// The marks made when compacting match those made when appending
+	reopened, err := openHistoryDB(path, 7*24*time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reopened.marks) != len(db.marks) || reopened.marks[100] != db.marks[100] || reopened.size != db.size {
+		t.Errorf("Expected the same marks after reopening, got %d marks, %d bytes rather than %d, %d", len(reopened.marks), reopened.size, len(db.marks), db.size)
+	}
+}
+
+func TestHistoryIsWrittenWithoutHoldingUpTheExporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "historydb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2020, 11, 16, 10, 0, 0, 0, time.UTC)
+
+	db, err := openHistoryDB(filepath.Join(dir, "history.jsonl"), 24*time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+	if err := e.loadHistory(db); err != nil {
+		t.Fatal(err)
+	}
+
+	// As if the disk were slow
+	db.mu.Lock()
+
+	done := make(chan struct{})
+	go func() {
+		e.scrape(context.Background(), e.targets[0], now)
+		close(done)
+	}()
+
+	recorded := make(chan struct{})
+	go func() {
+		for {
+			e.rlock()
+			scraped := e.lastScrapeInfo != nil
+			e.mu.RUnlock()
+
+			if scraped {
+				close(recorded)
+				return
+			}
+
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	select {
+	case <-recorded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the exporter not to be locked while the history is written")
+	}
+
+	db.mu.Unlock()
+	<-done
+
+	if records, err := db.read(time.Time{}); err != nil || len(records) != 1 {
+		t.Errorf("Expected the poll to be kept, got %+v, %v", records, err)
+	}
+}
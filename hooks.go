@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+)
+
+// scrapeHookHandler lets CI pipelines poll Docker Hub about each target straight away, eg right
+// before a stage which pulls a lot of images, rather than waiting for the next scrape. The metrics
+// are updated, and the response is the same as /api/v1/ratelimit. Callers must give token as a
+// bearer token.
+func scrapeHookHandler(e *Exporter, token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "Only POST is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="dockerhub_exporter"`)
+			http.Error(w, "Not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		statuses, ok := e.refresh(r.Context())
+
+		w.Header().Set("Content-Type", "application/json")
+
+		// Let the pipeline know that it's looking at stale numbers
+		if !ok {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+
+		_ = json.NewEncoder(w).Encode(statuses)
+	}
+}
+
+// refresh polls Docker Hub about each target, within ctx, and returns their status afterwards, and whether
+// every poll succeeded.
+func (e *Exporter) refresh(ctx context.Context) ([]rateLimitStatus, bool) {
+	now := e.clock()
+	ok := true
+
+	for _, t := range e.targets {
+		e.scrape(ctx, t, now)
+
+		e.rlock()
+		if !t.lastSuccess.Equal(now) {
+			ok = false
+		}
+		e.mu.RUnlock()
+	}
+
+	return e.status(), ok
+}
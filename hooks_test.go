@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestScrapeHookPollsStraightAway(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	hub.SetRateLimit(100, 42)
+
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+	handler := scrapeHookHandler(e, "s3cret")
+
+	req := httptest.NewRequest("POST", "/hooks/scrape", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	var statuses []rateLimitStatus
+	if err := json.NewDecoder(w.Body).Decode(&statuses); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(statuses) != 1 || statuses[0].Remaining != 42 {
+		t.Errorf("Expected 42 remaining, got %+v", statuses)
+	}
+
+	if remaining := testutil.ToFloat64(e.remaining.WithLabelValues(defaultRepository)); remaining != 42 {
+		t.Errorf("Expected the metrics to be updated, got %v remaining", remaining)
+	}
+}
+
+func TestScrapeHookReportsFailedPolls(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	hub.SetRegistryStatus(http.StatusServiceUnavailable)
+
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+
+	req := httptest.NewRequest("POST", "/hooks/scrape", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	w := httptest.NewRecorder()
+	scrapeHookHandler(e, "s3cret")(w, req)
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502, got %d", w.Code)
+	}
+}
+
+func TestScrapeHookNeedsTheTokenAndPOST(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+	handler := scrapeHookHandler(e, "s3cret")
+
+	for _, tc := range []struct {
+		method, authorization string
+		expected              int
+	}{
+		{"POST", "", http.StatusUnauthorized},
+		{"POST", "Bearer wrong", http.StatusUnauthorized},
+		{"GET", "Bearer s3cret", http.StatusMethodNotAllowed},
+	} {
+		req := httptest.NewRequest(tc.method, "/hooks/scrape", nil)
+		if tc.authorization != "" {
+			req.Header.Set("Authorization", tc.authorization)
+		}
+
+		w := httptest.NewRecorder()
+		handler(w, req)
+
+		if w.Code != tc.expected {
+			t.Errorf("Expected %d for %s with %q, got %d", tc.expected, tc.method, tc.authorization, w.Code)
+		}
+	}
+
+	if hub.ManifestRequests() != 0 {
+		t.Errorf("Expected Docker Hub not to be polled, got %d requests", hub.ManifestRequests())
+	}
+}
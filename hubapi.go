@@ -0,0 +1,104 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// hubAPI reads from Docker Hub's API, as opposed to the registry, logging in with the credentials
+// if there are any. Those should be a personal access token.
+type hubAPI struct {
+	url         string
+	credentials *credentials // nil to read anonymously
+	client      *http.Client
+
+	token string // from logging in with credentials, empty until then
+}
+
+func newHubAPI(url string, c *credentials, client *http.Client) *hubAPI {
+	return &hubAPI{url: url, credentials: c, client: client}
+}
+
+// get reads the JSON response from the Hub API at url into v, logging in first if there are
+// credentials, and again if the token has expired.
+func (h *hubAPI) get(url string, v interface{}) error {
+	res, err := h.fetch(url)
+
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusUnauthorized && h.token != "" {
+		h.token = ""
+		res, err = h.fetch(url)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer closeResponse(res.Body)
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func (h *hubAPI) fetch(url string) (*http.Response, error) {
+	if h.credentials != nil && h.token == "" {
+		if err := h.login(); err != nil {
+			return nil, fmt.Errorf("unable to log in to the Docker Hub API: %w", err)
+		}
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+
+	return fetchHTTP(context.Background(), h.client, req)
+}
+
+// login exchanges the credentials for a token for the Hub API.
+func (h *hubAPI) login() error {
+	body, err := json.Marshal(map[string]string{"username": h.credentials.username, "password": h.credentials.passphrase})
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", h.url+"/users/login", bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := fetchHTTP(context.Background(), h.client, req)
+
+	if err != nil {
+		return err
+	}
+
+	defer closeResponse(res.Body)
+
+	var login struct {
+		Token string `json:"token"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&login); err != nil {
+		return err
+	}
+
+	h.token = login.Token
+
+	return nil
+}
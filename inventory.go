@@ -0,0 +1,211 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// InventoryCollector exports the popularity stats of a configured list of Docker Hub repositories,
+// and of every repository of some organizations, so that they can be put alongside the rate limit
+// data this exporter already provides. With credentials, which should be a personal access token,
+// the stats of private repositories are exported too.
+type InventoryCollector struct {
+	mu sync.Mutex
+
+	api           *hubAPI
+	repositories  []string
+	organizations []string
+
+	pulls, stars, lastUpdated *prometheus.Desc
+	failures                  prometheus.Counter
+}
+
+// NewInventoryCollector returns an initialized InventoryCollector for the given image references
+// and organizations.
+func NewInventoryCollector(hubURL string, images []string, organizations []string, c *credentials, client *http.Client) (*InventoryCollector, error) {
+	repositories := make([]string, 0, len(images))
+
+	for _, image := range images {
+		repository, err := parseImageReference(image)
+
+		if err != nil {
+			return nil, err
+		}
+
+		repositories = append(repositories, repository)
+	}
+
+	return &InventoryCollector{
+		api:           newHubAPI(hubURL, c, client),
+		repositories:  repositories,
+		organizations: organizations,
+
+		pulls: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "repository", "pulls_total"),
+			"Docker Hub public pull count for the repository",
+			[]string{"repository"}, nil),
+		stars: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "repository", "stars"),
+			"Docker Hub star count for the repository",
+			[]string{"repository"}, nil),
+		lastUpdated: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "repository", "last_updated_timestamp_seconds"),
+			"When the repository was last pushed to, as seconds since the epoch",
+			[]string{"repository"}, nil),
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exporter_inventory_failures_total",
+			Help:      "Number of errors while fetching Docker Hub repository stats.",
+		}),
+	}, nil
+}
+
+// Collect fetches the stats for each configured repository, and those of the organizations, and
+// delivers them as Prometheus metrics. It implements prometheus.Collector.
+func (c *InventoryCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	seen := map[string]bool{}
+
+	for _, repository := range c.repositories {
+		stats, err := c.fetchRepositoryStats(repository)
+
+		if err != nil {
+			fmt.Printf("%+v\n", err)
+			c.failures.Inc()
+			continue
+		}
+
+		c.collectStats(ch, repository, stats)
+		seen[repository] = true
+	}
+
+	for _, organization := range c.organizations {
+		stats, err := c.fetchOrganizationStats(organization)
+
+		if err != nil {
+			fmt.Printf("%+v\n", err)
+			c.failures.Inc()
+			continue
+		}
+
+		for _, s := range stats {
+			// A repository can be both configured and in an organization
+			if repository := s.Namespace + "/" + s.Name; !seen[repository] {
+				c.collectStats(ch, repository, s)
+				seen[repository] = true
+			}
+		}
+	}
+
+	ch <- c.failures
+}
+
+func (c *InventoryCollector) collectStats(ch chan<- prometheus.Metric, repository string, stats *repositoryStats) {
+	ch <- prometheus.MustNewConstMetric(c.pulls, prometheus.CounterValue, stats.PullCount, repository)
+	ch <- prometheus.MustNewConstMetric(c.stars, prometheus.GaugeValue, stats.StarCount, repository)
+
+	if stats.LastUpdated != nil {
+		ch <- prometheus.MustNewConstMetric(c.lastUpdated, prometheus.GaugeValue, float64(stats.LastUpdated.Unix()), repository)
+	}
+}
+
+// Describe describes all the metrics exported by the inventory collector. It implements
+// prometheus.Collector.
+func (c *InventoryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.pulls
+	ch <- c.stars
+	ch <- c.lastUpdated
+	ch <- c.failures.Desc()
+}
+
+// repositoryStats is used for parsing the JSON response coming back from the Docker Hub API
+type repositoryStats struct {
+	Name        string     `json:"name"`
+	Namespace   string     `json:"namespace"`
+	PullCount   float64    `json:"pull_count"`
+	StarCount   float64    `json:"star_count"`
+	LastUpdated *time.Time `json:"last_updated"`
+}
+
+func (c *InventoryCollector) fetchRepositoryStats(repository string) (*repositoryStats, error) {
+	var stats repositoryStats
+
+	if err := c.api.get(c.api.url+"/repositories/"+repository+"/", &stats); err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// fetchOrganizationStats fetches the stats of every repository of organization, a page at a time.
+func (c *InventoryCollector) fetchOrganizationStats(organization string) ([]*repositoryStats, error) {
+	var all []*repositoryStats
+	next := c.api.url + "/repositories/" + organization + "/?page_size=100"
+
+	for next != "" {
+		var page struct {
+			Next    string             `json:"next"`
+			Results []*repositoryStats `json:"results"`
+		}
+
+		if err := c.api.get(next, &page); err != nil {
+			return nil, err
+		}
+
+		for _, stats := range page.Results {
+			if stats.Namespace == "" {
+				stats.Namespace = organization
+			}
+		}
+
+		all = append(all, page.Results...)
+		next = page.Next
+	}
+
+	return all, nil
+}
+
+// parseImageReference turns an image reference like "nginx:1.19", "prom/prometheus" or
+// "docker.io/library/redis@sha256:..." into the Docker Hub repository name, eg "library/nginx".
+func parseImageReference(ref string) (string, error) {
+	name := strings.TrimSpace(ref)
+
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+
+	parts := strings.Split(name, "/")
+
+	if len(parts) > 1 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		switch parts[0] {
+		case "docker.io", "index.docker.io", "registry-1.docker.io":
+			parts = parts[1:]
+		default:
+			return "", fmt.Errorf("image %q is not hosted on Docker Hub", ref)
+		}
+	}
+
+	if len(parts) == 1 {
+		parts = append([]string{"library"}, parts...)
+	}
+
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("invalid image reference %q", ref)
+	}
+
+	return strings.Join(parts, "/"), nil
+}
@@ -0,0 +1,124 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInventoryExportsRepositoryStats(t *testing.T) {
+	hubServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repositories/library/nginx/":
+			w.Write([]byte(`{"name": "nginx", "pull_count": 1000000, "star_count": 15000, "last_updated": "2020-11-16T10:00:00.000000Z"}`))
+		case "/repositories/prom/prometheus/":
+			w.Write([]byte(`{"name": "prometheus", "pull_count": 500000, "star_count": 800}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer hubServer.Close()
+
+	inventory, err := NewInventoryCollector(hubServer.URL, []string{"nginx:1.19", "prom/prometheus", "jabley/missing"}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectMetrics(t, inventory, "inventory.metrics")
+}
+
+func TestInventoryExportsOrganizationsWithPAT(t *testing.T) {
+	logins := 0
+
+	var hubServer *httptest.Server
+	hubServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/users/login" {
+			var login map[string]string
+			json.NewDecoder(r.Body).Decode(&login)
+
+			if login["username"] != "jabley" || login["password"] != "dckr_pat_secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			logins++
+			w.Write([]byte(`{"token": "hub-jwt"}`))
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer hub-jwt" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.URL.Path == "/repositories/jabley/" && r.URL.Query().Get("page") == "":
+			w.Write([]byte(`{"next": "` + hubServer.URL + `/repositories/jabley/?page=2&page_size=100", "results": [{"name": "dockerhub_exporter", "namespace": "jabley", "pull_count": 1200, "star_count": 3}]}`))
+		case r.URL.Path == "/repositories/jabley/":
+			w.Write([]byte(`{"next": null, "results": [{"name": "private", "namespace": "jabley", "pull_count": 7, "star_count": 0, "last_updated": "2020-11-16T10:00:00Z"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer hubServer.Close()
+
+	inventory, err := NewInventoryCollector(hubServer.URL, nil, []string{"jabley"}, &credentials{"jabley", "dckr_pat_secret"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `
+# HELP dockerhub_repository_last_updated_timestamp_seconds When the repository was last pushed to, as seconds since the epoch
+# TYPE dockerhub_repository_last_updated_timestamp_seconds gauge
+dockerhub_repository_last_updated_timestamp_seconds{repository="jabley/private"} 1.6055208e+09
+# HELP dockerhub_repository_pulls_total Docker Hub public pull count for the repository
+# TYPE dockerhub_repository_pulls_total counter
+dockerhub_repository_pulls_total{repository="jabley/dockerhub_exporter"} 1200
+dockerhub_repository_pulls_total{repository="jabley/private"} 7
+`
+
+	if err := testutil.CollectAndCompare(inventory, strings.NewReader(expected),
+		"dockerhub_repository_last_updated_timestamp_seconds", "dockerhub_repository_pulls_total"); err != nil {
+		t.Fatal(err)
+	}
+
+	if logins != 1 {
+		t.Errorf("Expected to log in to the Hub API once, got %d", logins)
+	}
+}
+
+func TestParseImageReference(t *testing.T) {
+	for ref, expected := range map[string]string{
+		"nginx":                   "library/nginx",
+		"nginx:1.19":              "library/nginx",
+		"prom/prometheus:v2.22.0": "prom/prometheus",
+		"docker.io/library/redis": "library/redis",
+		"index.docker.io/jabley/dockerhub_exporter": "jabley/dockerhub_exporter",
+		"redis@sha256:0123456789abcdef":             "library/redis",
+	} {
+		repository, err := parseImageReference(ref)
+
+		if err != nil {
+			t.Fatalf("Unexpected error parsing %q: %v", ref, err)
+		}
+
+		if repository != expected {
+			t.Errorf("Expected %q to be %q, got %q", ref, expected, repository)
+		}
+	}
+}
+
+func TestParseImageReferenceRejectsOtherRegistries(t *testing.T) {
+	for _, ref := range []string{"quay.io/jabley/dockerhub_exporter", "localhost:5000/foo", "a/b/c", ""} {
+		if _, err := parseImageReference(ref); err == nil {
+			t.Errorf("Expected an error parsing %q", ref)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The values of -ip-protocol. Docker Hub counts requests over IPv4 and IPv6 against different
+// source IPs, so a dual-stack host has a rate limit for each.
+const (
+	ipProtocolAuto = "auto" // whichever the resolver and dialer prefer
+	ipProtocol4    = "4"
+	ipProtocol6    = "6"
+	ipProtocolBoth = "both" // poll over each, labelling the metrics with ip_version
+)
+
+// ipFamily returns the network to dial Docker Hub over for -ip-protocol, empty for either.
+func ipFamily(protocol string) (string, error) {
+	switch protocol {
+	case ipProtocolAuto:
+		return "", nil
+	case ipProtocol4, ipProtocolBoth:
+		return "tcp4", nil
+	case ipProtocol6:
+		return "tcp6", nil
+	}
+
+	return "", fmt.Errorf("-ip-protocol must be 4, 6, both or auto, not %q", protocol)
+}
+
+// checkSourceFamily returns an error if the source address can't be used to connect over family.
+func checkSourceFamily(source, family string) error {
+	if source == "" || family == "" {
+		return nil
+	}
+
+	isIPv4 := net.ParseIP(source).To4() != nil
+
+	if (family == "tcp4") != isIPv4 {
+		return fmt.Errorf("-source-address %s can't be used to connect over %s", source, family)
+	}
+
+	return nil
+}
+
+// registerIPVersions registers the exporters which poll Docker Hub over IPv4 and IPv6 with reg,
+// with their series labelled ip_version="4" or "6".
+func registerIPVersions(reg prometheus.Registerer, ipv4, ipv6 *Exporter) error {
+	if err := prometheus.WrapRegistererWith(prometheus.Labels{"ip_version": ipProtocol4}, reg).Register(ipv4); err != nil {
+		return err
+	}
+
+	return prometheus.WrapRegistererWith(prometheus.Labels{"ip_version": ipProtocol6}, reg).Register(ipv6)
+}
+
+// newIPv6Exporter returns an exporter like the main one, which polls over IPv4 for
+// -ip-protocol=both, but which connects to Docker Hub over IPv6.
+func (args *arguments) newIPv6Exporter() *Exporter {
+	options := args.socketOptions
+	options.family = "tcp6"
+
+	ipv6 := *args
+	ipv6.client = &http.Client{Timeout: args.requestTimeout, Transport: args.phaseTimeouts.transport(options)}
+
+	e := ipv6.newExporter(args.credentials)
+
+	if args.softFailCredentials {
+		e.enableSoftFailCredentials()
+	}
+
+	return e
+}
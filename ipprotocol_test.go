@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestIPProtocolChoosesTheFamily(t *testing.T) {
+	for protocol, expected := range map[string]string{
+		ipProtocolAuto: "",
+		ipProtocol4:    "tcp4",
+		ipProtocol6:    "tcp6",
+		ipProtocolBoth: "tcp4",
+	} {
+		family, err := ipFamily(protocol)
+
+		if err != nil || family != expected {
+			t.Errorf("Expected -ip-protocol=%s to connect over %q, got %q (%v)", protocol, expected, family, err)
+		}
+	}
+
+	if _, err := ipFamily("5"); err == nil {
+		t.Error("Expected -ip-protocol=5 to be rejected")
+	}
+
+	if err := checkSourceFamily("192.0.2.1", "tcp6"); err == nil {
+		t.Error("Expected an IPv4 source address to be rejected for IPv6")
+	}
+
+	if err := checkSourceFamily("2001:db8::1", "tcp6"); err != nil {
+		t.Errorf("Expected an IPv6 source address to be allowed for IPv6, got %v", err)
+	}
+}
+
+func TestIPProtocolOnlyConnectsOverTheFamily(t *testing.T) {
+	server := httptest.NewServer(handler(&mockResponse{}))
+	defer server.Close()
+
+	for family, ok := range map[string]bool{"tcp4": true, "tcp6": false} {
+		client := &http.Client{Transport: phaseTimeouts{}.transport(socketOptions{family: family})}
+		res, err := client.Get(server.URL)
+
+		if err == nil {
+			closeResponse(res.Body)
+		}
+
+		if (err == nil) != ok {
+			t.Errorf("Expected connecting to %s over %s to succeed: %v, got %v", server.URL, family, ok, err)
+		}
+	}
+}
+
+func TestBothIPVersionsAreLabelled(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	registry := prometheus.NewRegistry()
+	ipv4 := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+	ipv6 := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+
+	if err := registerIPVersions(registry, ipv4, ipv6); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `
+# HELP dockerhub_exporter_scrapes_total Current total Docker Hub scrapes.
+# TYPE dockerhub_exporter_scrapes_total counter
+dockerhub_exporter_scrapes_total{ip_version="4"} 1
+dockerhub_exporter_scrapes_total{ip_version="6"} 1
+`
+
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "dockerhub_exporter_scrapes_total"); err != nil {
+		t.Fatal(err)
+	}
+}
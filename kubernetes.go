@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// serviceAccountDir is where Kubernetes mounts the pod's service account credentials.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubernetesSecret reads Docker Hub credentials from a kubernetes.io/dockerconfigjson Secret, the
+// same one that pods use as an imagePullSecret, so that they only need managing in one place. The
+// Kubernetes API is simple enough to call directly, which saves taking on client-go.
+type kubernetesSecret struct {
+	url       string
+	tokenFile string
+	client    *http.Client
+
+	namespace, name string
+}
+
+// newInClusterKubernetesSecret returns a kubernetesSecret for ref, which is namespace/name, using
+// the pod's service account to talk to the Kubernetes API.
+func newInClusterKubernetesSecret(ref string) (*kubernetesSecret, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes cluster, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT aren't set")
+	}
+
+	ca, err := ioutil.ReadFile(serviceAccountDir + "/ca.crt")
+
+	if err != nil {
+		return nil, err
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates found in %s/ca.crt", serviceAccountDir)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+
+	client := &http.Client{Transport: transport, Timeout: 10 * time.Second}
+
+	return newKubernetesSecret("https://"+net.JoinHostPort(host, port), serviceAccountDir+"/token", client, ref)
+}
+
+func newKubernetesSecret(apiURL string, tokenFile string, client *http.Client, ref string) (*kubernetesSecret, error) {
+	parts := strings.SplitN(ref, "/", 2)
+
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("Kubernetes secret %q should be namespace/name", ref)
+	}
+
+	return &kubernetesSecret{
+		url:       apiURL + "/api/v1/namespaces/" + parts[0] + "/secrets/" + parts[1],
+		tokenFile: tokenFile,
+		client:    client,
+		namespace: parts[0],
+		name:      parts[1],
+	}, nil
+}
+
+func (k *kubernetesSecret) String() string {
+	return k.namespace + "/" + k.name
+}
+
+// read fetches the Secret, and returns the Docker Hub credentials in it, and its resource version,
+// which changes whenever it does.
+func (k *kubernetesSecret) read() (*credentials, string, error) {
+	// Service account tokens are rotated, so they are read afresh each time
+	token, err := ioutil.ReadFile(k.tokenFile)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	req, err := http.NewRequest("GET", k.url, nil)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+
+	res, err := k.client.Do(req)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer closeResponse(res.Body)
+
+	if res.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unable to read secret %s: %w", k, &httpStatusError{StatusCode: res.StatusCode})
+	}
+
+	var secret struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+		Type string            `json:"type"`
+		Data map[string][]byte `json:"data"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&secret); err != nil {
+		return nil, "", err
+	}
+
+	if secret.Type != "kubernetes.io/dockerconfigjson" {
+		return nil, "", fmt.Errorf("secret %s is a %s, not a kubernetes.io/dockerconfigjson", k, secret.Type)
+	}
+
+	c, err := parseDockerConfig(secret.Data[".dockerconfigjson"], nil)
+
+	if err != nil {
+		return nil, "", fmt.Errorf("secret %s: %w", k, err)
+	}
+
+	return c, secret.Metadata.ResourceVersion, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+)
+
+// fakeKubernetes serves a kubernetes.io/dockerconfigjson Secret called ci/dockerhub, with config as
+// its Docker config and version as its resource version.
+func fakeKubernetes(t *testing.T, config *string, version *string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/ci/secrets/dockerhub" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer service-account-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"metadata": map[string]string{"resourceVersion": *version},
+			"type":     "kubernetes.io/dockerconfigjson",
+			"data":     map[string][]byte{".dockerconfigjson": []byte(*config)},
+		})
+	}))
+}
+
+func tokenFile(t *testing.T) string {
+	f, err := ioutil.TempFile("", "token")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _ = f.WriteString("service-account-token\n")
+	f.Close()
+
+	return f.Name()
+}
+
+func TestCredentialsAreReadFromAKubernetesSecretAndRotated(t *testing.T) {
+	config := `{"auths":{"https://index.docker.io/v1/":{"username":"username","password":"password"}}}`
+	resourceVersion := "1"
+
+	api := fakeKubernetes(t, &config, &resourceVersion)
+	defer api.Close()
+
+	token := tokenFile(t)
+	defer os.Remove(token)
+
+	secret, err := newKubernetesSecret(api.URL, token, api.Client(), "ci/dockerhub")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, version, err := secret.read()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *c != (credentials{username: "username", passphrase: "password"}) || version != "1" {
+		t.Fatalf("Unexpected credentials %+v at version %s", *c, version)
+	}
+
+	hub := registrytest.NewServer()
+	defer hub.Close()
+	hub.SetCredentials("username", "password")
+
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, c)
+	watcher := &credentialsWatcher{exporter: e, source: secret, version: version}
+
+	if err := e.validateCredentials(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The secret is rotated, with the credentials as an auth string this time
+	hub.SetCredentials("username", "rotated")
+	config = `{"auths":{"docker.io":{"auth":"` + base64.StdEncoding.EncodeToString([]byte("username:rotated")) + `"}}}`
+	resourceVersion = "2"
+
+	if err := watcher.refresh(); err != nil || watcher.version != "2" {
+		t.Fatalf("Expected to be at version 2, got %s: %v", watcher.version, err)
+	}
+
+	if err := e.validateCredentials(); err != nil {
+		t.Errorf("Expected the rotated credentials to be used straight away, got %v", err)
+	}
+}
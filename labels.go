@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var labelNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// parseConstLabels parses -label flags, each of which is key=value.
+func parseConstLabels(flags []string) (prometheus.Labels, error) {
+	labels := prometheus.Labels{}
+
+	for _, f := range flags {
+		parts := strings.SplitN(f, "=", 2)
+
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("label %q should be key=value", f)
+		}
+
+		if !labelNameRE.MatchString(parts[0]) || strings.HasPrefix(parts[0], "__") {
+			return nil, fmt.Errorf("label %q doesn't have a valid Prometheus label name", f)
+		}
+
+		if _, ok := labels[parts[0]]; ok {
+			return nil, fmt.Errorf("label %q is given more than once", parts[0])
+		}
+
+		labels[parts[0]] = parts[1]
+	}
+
+	return labels, nil
+}
+
+// constLabelsGatherer gathers from g, and adds labels to every series, so that the metrics from
+// many exporters can be told apart without relabelling in the scrape config. This covers the
+// metrics which client_golang registers itself, as well as our own. A series which already has one
+// of the labels keeps its own value.
+func constLabelsGatherer(g prometheus.Gatherer, labels prometheus.Labels) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+
+		for _, mf := range families {
+			for _, m := range mf.Metric {
+				m.Label = withConstLabels(m.Label, labels)
+			}
+		}
+
+		return families, err
+	})
+}
+
+func withConstLabels(pairs []*dto.LabelPair, labels prometheus.Labels) []*dto.LabelPair {
+	has := map[string]bool{}
+	for _, l := range pairs {
+		has[l.GetName()] = true
+	}
+
+	for name, value := range labels {
+		if !has[name] {
+			name, value := name, value
+			pairs = append(pairs, &dto.LabelPair{Name: &name, Value: &value})
+		}
+	}
+
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].GetName() < pairs[j].GetName() })
+
+	return pairs
+}
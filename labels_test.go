@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestConstLabelsAreAddedToEverySeries(t *testing.T) {
+	e := NewExporter("http://localhost:0", "http://localhost:0", nil, nil)
+	e.remaining.WithLabelValues("library/alpine").Set(76)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(e)
+
+	labels, err := parseConstLabels([]string{"environment=prod", "cluster=eu-west-1", "repository=ignored"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `
+# HELP dockerhub_exporter_expected_failures_total Number of errors while polling Docker Hub during a known maintenance window.
+# TYPE dockerhub_exporter_expected_failures_total counter
+dockerhub_exporter_expected_failures_total{cluster="eu-west-1",environment="prod",repository="ignored"} 0
+# HELP dockerhub_limit_remaining_requests_total Docker Hub Rate Limit Remaining Requests
+# TYPE dockerhub_limit_remaining_requests_total gauge
+dockerhub_limit_remaining_requests_total{cluster="eu-west-1",environment="prod",repository="library/alpine"} 76
+`
+
+	if err := testutil.GatherAndCompare(constLabelsGatherer(registry, labels), strings.NewReader(expected),
+		"dockerhub_exporter_expected_failures_total", "dockerhub_limit_remaining_requests_total"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInvalidConstLabelsAreRejected(t *testing.T) {
+	for _, flags := range [][]string{
+		{"environment"},
+		{"1st=prod"},
+		{"__name__=up"},
+		{"environment=prod", "environment=dev"},
+	} {
+		if _, err := parseConstLabels(flags); err == nil {
+			t.Errorf("Expected %q to be rejected", flags)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Docker Hub's token responses are a few kilobytes, and only a couple of levels deep.
+const (
+	defaultMaxTokenResponseBytes = 1 << 20
+	defaultMaxTokenResponseDepth = 16
+)
+
+// Which limit a response broke, used as the `limit` label on the oversized responses counter.
+const (
+	responseLimitBytes = "bytes"
+	responseLimitDepth = "depth"
+)
+
+// responseLimits bounds how much of a token response is read, so that a misrouted request which
+// gets something huge back, like a web page or a file download, can't balloon the memory.
+type responseLimits struct {
+	maxBytes int64
+	maxDepth int
+}
+
+// responseLimitError is returned when a response is larger or more deeply nested than allowed.
+type responseLimitError struct {
+	limit string
+	max   int64
+}
+
+func (e *responseLimitError) Error() string {
+	if e.limit == responseLimitDepth {
+		return fmt.Sprintf("response is nested more than %d deep", e.max)
+	}
+
+	return fmt.Sprintf("response is larger than %d bytes", e.max)
+}
+
+// read returns the body, unless it breaks the limits.
+func (l responseLimits) read(body io.Reader) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(body, l.maxBytes+1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > l.maxBytes {
+		return nil, &responseLimitError{limit: responseLimitBytes, max: l.maxBytes}
+	}
+
+	if err := checkJSONDepth(data, l.maxDepth); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// checkJSONDepth returns an error if the JSON in data has objects or arrays nested more than max
+// deep. It doesn't check that the JSON is valid, which is left to decoding it.
+func checkJSONDepth(data []byte, max int) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	depth := 0
+
+	for {
+		token, err := dec.Token()
+
+		if err != nil {
+			return nil
+		}
+
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+
+			if depth > max {
+				return &responseLimitError{limit: responseLimitDepth, max: int64(max)}
+			}
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestOversizedTokenResponsesAreRejected(t *testing.T) {
+	for name, body := range map[string][]byte{
+		responseLimitBytes: bytes.Repeat([]byte("<html>"), 1000),
+		responseLimitDepth: []byte(strings.Repeat("[", 20) + strings.Repeat("]", 20)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			authServer := httptest.NewServer(handler(&mockResponse{response: body}))
+			defer authServer.Close()
+
+			exporter := NewExporter(authServer.URL, authServer.URL, []string{defaultRepository}, nil)
+			exporter.tokenLimits = responseLimits{maxBytes: 1024, maxDepth: 10}
+
+			if _, err := exporter.fetchToken(context.Background(), exporter.targets[0]); failureReason(err) != failureReasonParse {
+				t.Fatalf("Expected a parse failure, got %v", err)
+			}
+
+			if n := testutil.ToFloat64(exporter.oversizedResponses.WithLabelValues(name)); n != 1 {
+				t.Errorf("Expected 1 oversized response, got %v", n)
+			}
+		})
+	}
+}
+
+func TestTokenResponsesWithinTheLimitsAreAccepted(t *testing.T) {
+	authServer := httptest.NewServer(handler(&mockResponse{response: authResponseBody()}))
+	defer authServer.Close()
+
+	exporter := NewExporter(authServer.URL, authServer.URL, []string{defaultRepository}, nil)
+	exporter.tokenLimits = responseLimits{maxBytes: 4096, maxDepth: 1}
+
+	if _, err := exporter.fetchToken(context.Background(), exporter.targets[0]); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// metricsLint implements the metrics-lint subcommand. It prints the name, label names and type of
+// every series that the exporter would export about Docker Hub with args, so that changes which
+// would break dashboards can be reviewed before upgrading or reconfiguring it. With -previous, it
+// prints the differences from an earlier dump instead, and returns 1 if there are any. Collisions
+// between the metrics are always an error.
+func metricsLint(args *arguments, out io.Writer) int {
+	lines, err := lintMetrics(args)
+
+	if err != nil {
+		fmt.Fprintf(out, "Metric collision: %v\n", err)
+		return 1
+	}
+
+	if args.lintPrevious == "" {
+		for _, l := range lines {
+			fmt.Fprintln(out, l)
+		}
+
+		return 0
+	}
+
+	previous, err := readLintDump(args.lintPrevious)
+
+	if err != nil {
+		fmt.Fprintf(out, "Unable to read %s: %v\n", args.lintPrevious, err)
+		return 2
+	}
+
+	removed, added := diffLines(previous, lines)
+
+	for _, l := range removed {
+		fmt.Fprintf(out, "- %s\n", l)
+	}
+
+	for _, l := range added {
+		fmt.Fprintf(out, "+ %s\n", l)
+	}
+
+	if len(removed) > 0 || len(added) > 0 {
+		return 1
+	}
+
+	fmt.Fprintln(out, "No changes")
+
+	return 0
+}
+
+// lintMetrics returns a sorted line for each distinct name, set of label names and type that the
+// exporter configured by args exports.
+func lintMetrics(args *arguments) ([]string, error) {
+	families, err := gatherFromFakeHub(args)
+
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var lines []string
+
+	for _, mf := range families {
+		series := map[string]bool{}
+
+		for _, m := range mf.Metric {
+			var names, pairs []string
+
+			for _, l := range m.Label {
+				names = append(names, l.GetName())
+				pairs = append(pairs, l.GetName()+"="+l.GetValue())
+			}
+
+			// The wrapping gatherers could, in principle, make two series the same
+			key := strings.Join(pairs, ",")
+			if series[key] {
+				return nil, fmt.Errorf("%s{%s} is exported more than once", mf.GetName(), key)
+			}
+			series[key] = true
+
+			line := fmt.Sprintf("%s{%s} %s", mf.GetName(), strings.Join(names, ","), strings.ToLower(mf.GetType().String()))
+			if !seen[line] {
+				seen[line] = true
+				lines = append(lines, line)
+			}
+		}
+	}
+
+	sort.Strings(lines)
+
+	return lines, nil
+}
+
+// gatherFromFakeHub polls a fake Docker Hub with the exporter configured by args, so that nothing is
+// used up from the real rate limit, and returns what it exports about Docker Hub. The exporters
+// share nothing with the real ones: they have made up credentials, if any, and their own tokens,
+// scrape deadlines and no client metrics, so the fake polls don't show up in the real ones.
+func gatherFromFakeHub(args *arguments) ([]*dto.MetricFamily, error) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	hub.SetSource("192.0.2.1")
+
+	fake := *args
+	fake.authServerURL = hub.Auth.URL
+	fake.registryURL = hub.Registry.URL
+	fake.proxies = nil // the fake Docker Hub is local, so the socket options mustn't apply either
+	fake.client = args.plainClient
+	fake.clientMetrics = nil
+	fake.tokens = newTokenGroup()
+	fake.scrapeDeadlines = &scrapeDeadlines{}
+
+	var fakeCredentials *credentials
+	if args.credentials != nil {
+		fakeCredentials = &credentials{username: "fake", passphrase: "fake"}
+	}
+
+	exporter := fake.newExporter(fakeCredentials)
+
+	// These change what the exporter exports, so they need to be set up as main does
+	if args.softFailCredentials {
+		exporter.enableSoftFailCredentials()
+	}
+
+	if args.canaryHeaders != args.headers {
+		exporter.canary = newCanary(args.canaryHeaders, time.Now().Add(args.canaryDuration))
+	}
+
+	if args.alertWebhookURL != "" || args.syslogAddress != "" || args.natsURL != "" || args.kafkaRESTURL != "" {
+		exporter.alerter = newAlerter("", args.alertFormat, args.alertThreshold, nil)
+	}
+
+	registry := prometheus.NewRegistry()
+
+	if args.compareAnonymous {
+		if err := registerComparison(registry, exporter, fake.newExporter(nil)); err != nil {
+			return nil, err
+		}
+	} else if len(args.sourceAddresses) > 1 {
+		labels := prometheus.Labels{"source_address": args.sourceAddresses[0]}
+
+		if err := prometheus.WrapRegistererWith(labels, registry).Register(exporter); err != nil {
+			return nil, err
+		}
+	} else if args.bothIPVersions {
+		if err := registerIPVersions(registry, exporter, fake.newExporter(fakeCredentials)); err != nil {
+			return nil, err
+		}
+	} else if err := registry.Register(exporter); err != nil {
+		return nil, err
+	}
+
+	var gathered prometheus.Gatherer = registry
+
+	if len(args.sourceAddresses) > 1 {
+		sources, err := newSourcePool(args.sourceAddresses[1:], func(string) *Exporter { return fake.newExporter(fakeCredentials) })
+
+		if err != nil {
+			return nil, err
+		}
+
+		sources.all = true
+		gathered = prometheus.Gatherers{gathered, sources}
+	}
+
+	if len(args.anonymousSources) > 0 {
+		// The fake Docker Hub can't be reached from the source addresses
+		pool, err := newSourcePool(args.anonymousSources, func(string) *Exporter { return fake.newExporter(nil) })
+
+		if err != nil {
+			return nil, err
+		}
+
+		gathered = prometheus.Gatherers{gathered, pool}
+	}
+
+	return args.wrapGatherer(gathered).Gather()
+}
+
+func readLintDump(path string) ([]string, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
+// diffLines returns the lines which are only in previous, and those which are only in current.
+func diffLines(previous []string, current []string) (removed []string, added []string) {
+	in := func(lines []string) map[string]bool {
+		set := map[string]bool{}
+		for _, l := range lines {
+			set[l] = true
+		}
+		return set
+	}
+
+	was, is := in(previous), in(current)
+
+	for _, l := range previous {
+		if !is[l] {
+			removed = append(removed, l)
+		}
+	}
+
+	for _, l := range current {
+		if !was[l] {
+			added = append(added, l)
+		}
+	}
+
+	return removed, added
+}
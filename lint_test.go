@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func lintArgs() *arguments {
+	return &arguments{
+		repositories:  stringsFlag{defaultRepository},
+		headers:       defaultHeaderMapping,
+		canaryHeaders: defaultHeaderMapping,
+		alertFormat:   alertFormatJSON,
+		tokenLimits:   responseLimits{maxBytes: defaultMaxTokenResponseBytes, maxDepth: defaultMaxTokenResponseDepth},
+		groupLabels:   map[string]prometheus.Labels{},
+	}
+}
+
+func TestMetricsLintListsWhatTheConfigurationExports(t *testing.T) {
+	args := lintArgs()
+	args.groupLabels[defaultRepository] = prometheus.Labels{"team": "platform"}
+
+	var out bytes.Buffer
+	if code := metricsLint(args, &out); code != 0 {
+		t.Fatalf("Expected success, got %d: %s", code, out.String())
+	}
+
+	for _, expected := range []string{
+		"dockerhub_limit_remaining_requests_total{repository,team} gauge\n",
+		"dockerhub_exporter_poll_failures_total{reason} counter\n",
+		"dockerhub_ratelimit_source_info{repository,source_ip,team} gauge\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected %q in:\n%s", expected, out.String())
+		}
+	}
+
+	if strings.Contains(out.String(), "credentials_misconfigured") {
+		t.Errorf("Didn't expect soft-fail metrics without -credentials-soft-fail:\n%s", out.String())
+	}
+}
+
+func TestMetricsLintDiffsAgainstAPreviousDump(t *testing.T) {
+	var previous bytes.Buffer
+	if code := metricsLint(lintArgs(), &previous); code != 0 {
+		t.Fatalf("Expected success, got %d: %s", code, previous.String())
+	}
+
+	f, err := ioutil.TempFile("", "metrics-lint")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	_, _ = f.Write(previous.Bytes())
+	f.Close()
+
+	args := lintArgs()
+	args.lintPrevious = f.Name()
+
+	var out bytes.Buffer
+	if code := metricsLint(args, &out); code != 0 || out.String() != "No changes\n" {
+		t.Errorf("Expected no changes, got %d: %s", code, out.String())
+	}
+
+	args.aggregate = true
+	out.Reset()
+
+	if code := metricsLint(args, &out); code != 1 {
+		t.Errorf("Expected differences to fail, got %d", code)
+	}
+
+	for _, expected := range []string{
+		"- dockerhub_limit_remaining_requests_total{repository} gauge\n",
+		"+ dockerhub_limit_remaining_requests_total{} gauge\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected %q in:\n%s", expected, out.String())
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// systemdFirstFD is the first file descriptor that systemd passes sockets to a service as.
+const systemdFirstFD = 3
+
+// listen opens a listener on each of addresses, before anything is served, so that an address which
+// is in use or can't be bound stops the exporter from starting rather than being half served. An
+// address is either host:port, or unix:// followed by the path of a Unix domain socket.
+func listen(addresses []string) ([]net.Listener, error) {
+	var listeners []net.Listener
+
+	for _, address := range addresses {
+		l, err := listenOn(address)
+
+		if err != nil {
+			for _, opened := range listeners {
+				_ = opened.Close()
+			}
+
+			return nil, fmt.Errorf("unable to listen on %s: %w", address, err)
+		}
+
+		listeners = append(listeners, l)
+	}
+
+	return listeners, nil
+}
+
+func listenOn(address string) (net.Listener, error) {
+	if !strings.HasPrefix(address, "unix://") {
+		return net.Listen("tcp", address)
+	}
+
+	path := strings.TrimPrefix(address, "unix://")
+
+	if path == "" {
+		return nil, fmt.Errorf("no path for the Unix domain socket")
+	}
+
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	return net.Listen("unix", path)
+}
+
+// removeStaleSocket removes the socket at path if it was left behind by an exporter which didn't
+// shut down cleanly, so that listening on it again doesn't fail. A socket which something is still
+// listening on, or a file which isn't a socket, is left alone.
+func removeStaleSocket(path string) error {
+	info, err := os.Stat(path)
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and isn't a socket", path)
+	}
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("%s is already in use", path)
+	}
+
+	return os.Remove(path)
+}
+
+// systemdListeners returns the sockets which systemd passed to the exporter when it was started by
+// socket activation, as sd_listen_fds does. systemd keeps listening on them while the exporter
+// restarts, so that connections wait for it rather than being refused.
+func systemdListeners() ([]net.Listener, error) {
+	return inheritedListeners(systemdFirstFD)
+}
+
+func inheritedListeners(firstFD int) ([]net.Listener, error) {
+	// The variables are only meant for this process, rather than any it starts
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, fmt.Errorf("no sockets were passed by systemd, is the service socket activated?")
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("no sockets were passed by systemd, LISTEN_FDS is %q", os.Getenv("LISTEN_FDS"))
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	var listeners []net.Listener
+
+	for i := 0; i < n; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(firstFD+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		f := os.NewFile(uintptr(firstFD+i), name)
+		l, err := net.FileListener(f)
+
+		// The listener has its own copy of the file descriptor
+		_ = f.Close()
+
+		if err != nil {
+			for _, opened := range listeners {
+				_ = opened.Close()
+			}
+
+			return nil, fmt.Errorf("socket %s from systemd isn't a listening socket: %w", name, err)
+		}
+
+		listeners = append(listeners, l)
+	}
+
+	return listeners, nil
+}
+
+// listenTLS wraps each of listeners to serve HTTPS with the certificate and key in certFile and
+// keyFile, which are read straight away so that a bad pair stops the exporter from starting.
+func listenTLS(listeners []net.Listener, certFile string, keyFile string) ([]net.Listener, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the TLS certificate: %w", err)
+	}
+
+	config := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+
+	wrapped := make([]net.Listener, len(listeners))
+	for i, l := range listeners {
+		wrapped[i] = tls.NewListener(l, config)
+	}
+
+	return wrapped, nil
+}
+
+// serve serves with server on each of listeners, until serving on any of them fails.
+func serve(server *http.Server, listeners []net.Listener) error {
+	errs := make(chan error, len(listeners))
+
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			errs <- server.Serve(l)
+		}(l)
+	}
+
+	return <-errs
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEachListenAddressIsServed(t *testing.T) {
+	listeners, err := listen([]string{"127.0.0.1:0", "127.0.0.1:0"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	go func() { _ = serve(&http.Server{Handler: mux}, listeners) }()
+
+	for _, l := range listeners {
+		res, err := http.Get("http://" + l.Addr().String() + "/metrics")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+
+		if string(body) != "ok" {
+			t.Errorf("Expected the handler to be served on %s, got %q", l.Addr(), body)
+		}
+
+		_ = l.Close()
+	}
+}
+
+func TestListeningFailsIfAnyAddressIsUnavailable(t *testing.T) {
+	listeners, err := listen([]string{"127.0.0.1:0"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listeners[0].Close()
+
+	if _, err := listen([]string{"127.0.0.1:0", listeners[0].Addr().String()}); err == nil {
+		t.Error("Expected an error for an address which is already in use")
+	}
+}
+
+func TestUnixDomainSocketsAreServed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dockerhub_exporter")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "exporter.sock")
+
+	// Left behind by an exporter which didn't shut down cleanly
+	stale, err := net.Listen("unix", socket)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listeners, err := listen([]string{"unix://" + socket})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listeners[0].Close()
+
+	go func() {
+		_ = serve(&http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("ok"))
+		})}, listeners)
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+
+	res, err := client.Get("http://exporter/metrics")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	if string(body) != "ok" {
+		t.Errorf("Expected the handler to be served on the socket, got %q", body)
+	}
+
+	if _, err := listen([]string{"unix://" + socket}); err == nil {
+		t.Error("Expected an error for a socket which is already in use")
+	}
+}
+
+func TestSocketsArePassedBySystemd(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+
+	f, err := l.(*net.TCPListener).File()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	for name, value := range map[string]string{
+		"LISTEN_PID":     strconv.Itoa(os.Getpid()),
+		"LISTEN_FDS":     "1",
+		"LISTEN_FDNAMES": "dockerhub-exporter.socket",
+	} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, value)
+	}
+
+	listeners, err := inheritedListeners(int(f.Fd()))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listeners[0].Close()
+
+	if len(listeners) != 1 || listeners[0].Addr().String() != l.Addr().String() {
+		t.Errorf("Expected a listener on %s, got %v", l.Addr(), listeners)
+	}
+
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Error("Expected the variables to be unset, so that they aren't passed on")
+	}
+
+	// Without the variables, the exporter wasn't socket activated
+	if _, err := inheritedListeners(int(f.Fd())); err == nil {
+		t.Error("Expected an error without LISTEN_PID")
+	}
+}
+
+func TestListenersServeHTTPSWithACertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "listen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "dockerhub_exporter"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	_ = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	_ = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+
+	if _, err := listenTLS(nil, keyFile, certFile); err == nil {
+		t.Error("Expected an error for a certificate and key the wrong way round")
+	}
+
+	listeners, err := listen([]string{"127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listeners[0].Close()
+
+	if listeners, err = listenTLS(listeners, certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	go func() { _ = serve(&http.Server{Handler: mux}, listeners) }()
+
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	res, err := client.Get("https://" + listeners[0].Addr().String() + "/metrics")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	if string(body) != "ok" {
+		t.Errorf("Expected the handler to be served over HTTPS, got %q", body)
+	}
+}
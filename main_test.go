@@ -1,22 +1,25 @@
 package main
 
 import (
-	"encoding/base64"
+	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/jabley/dockerhub_exporter/registrytest"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func authResponseBody() []byte {
-	return []byte(fmt.Sprintf(`{"token": "access_token_here", "access_token": "access_token_here", "expires_in": 300, "issued_at": "%s" }`, time.Now().Format(time.RFC3339)))
+	return registrytest.TokenResponse("access_token_here", time.Now())
 }
 
 type mockResponse struct {
@@ -40,35 +43,7 @@ func subsequentRequestsFailHandler(firstResponse *mockResponse) http.HandlerFunc
 }
 
 func basicAuth(h http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-
-		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-
-		s := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
-		if len(s) != 2 {
-			http.Error(w, "Not authorized", 401)
-			return
-		}
-
-		b, err := base64.StdEncoding.DecodeString(s[1])
-		if err != nil {
-			http.Error(w, err.Error(), 401)
-			return
-		}
-
-		pair := strings.SplitN(string(b), ":", 2)
-		if len(pair) != 2 {
-			http.Error(w, "Not authorized", 401)
-			return
-		}
-
-		if pair[0] != "username" || pair[1] != "password" {
-			http.Error(w, "Not authorized", 401)
-			return
-		}
-
-		h.ServeHTTP(w, r)
-	}
+	return registrytest.BasicAuth("username", "password", h).ServeHTTP
 }
 
 func handler(response *mockResponse) http.HandlerFunc {
@@ -115,7 +90,7 @@ func TestHappyPath(t *testing.T) {
 	}))
 	defer rateLimitServer.Close()
 
-	exporter := NewExporter(authServer.URL, rateLimitServer.URL, nil)
+	exporter := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository}, nil)
 	expectMetrics(t, exporter, "success.metrics")
 }
 
@@ -133,7 +108,7 @@ func TestHappyPathWithBasicAuth(t *testing.T) {
 	}))
 	defer rateLimitServer.Close()
 
-	exporter := NewExporter(authServer.URL, rateLimitServer.URL,
+	exporter := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository},
 		&credentials{
 			username:   "username",
 			passphrase: "password",
@@ -156,7 +131,7 @@ func TestAuthTokenIsReusedWhenStillValid(t *testing.T) {
 	}))
 	defer rateLimitServer.Close()
 
-	exporter := NewExporter(authServer.URL, rateLimitServer.URL, nil)
+	exporter := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository}, nil)
 	expectMetrics(t, exporter, "success.metrics")
 
 	expectMetrics(t, exporter, "2nd-poll.metrics")
@@ -177,8 +152,8 @@ func TestUnableToAnonymouslyAuth(t *testing.T) {
 	}))
 	defer rateLimitServer.Close()
 
-	exporter := NewExporter(authServer.URL, rateLimitServer.URL, nil)
-	expectMetrics(t, exporter, "failure.metrics")
+	exporter := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository}, nil)
+	expectMetrics(t, exporter, "failure-auth.metrics")
 }
 
 func TestUnableToBasicAuth(t *testing.T) {
@@ -195,12 +170,12 @@ func TestUnableToBasicAuth(t *testing.T) {
 	}))
 	defer rateLimitServer.Close()
 
-	exporter := NewExporter(authServer.URL, rateLimitServer.URL,
+	exporter := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository},
 		&credentials{
 			username:   "username",
 			passphrase: "not-the-correct-password",
 		})
-	expectMetrics(t, exporter, "failure.metrics")
+	expectMetrics(t, exporter, "failure-auth.metrics")
 }
 
 func TestUnableToRetrieveRateLimit(t *testing.T) {
@@ -214,8 +189,8 @@ func TestUnableToRetrieveRateLimit(t *testing.T) {
 	}))
 	defer rateLimitServer.Close()
 
-	exporter := NewExporter(authServer.URL, rateLimitServer.URL, nil)
-	expectMetrics(t, exporter, "failure.metrics")
+	exporter := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository}, nil)
+	expectMetrics(t, exporter, "failure-http-status.metrics")
 }
 
 func TestMissingRateLimitHeadersIsTreatedAsAFailure(t *testing.T) {
@@ -229,8 +204,8 @@ func TestMissingRateLimitHeadersIsTreatedAsAFailure(t *testing.T) {
 	}))
 	defer rateLimitServer.Close()
 
-	exporter := NewExporter(authServer.URL, rateLimitServer.URL, nil)
-	expectMetrics(t, exporter, "failure.metrics")
+	exporter := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository}, nil)
+	expectMetrics(t, exporter, "failure-parse.metrics")
 }
 
 func TestBadAuthURLFails(t *testing.T) {
@@ -239,8 +214,8 @@ func TestBadAuthURLFails(t *testing.T) {
 	}))
 	defer rateLimitServer.Close()
 
-	exporter := NewExporter("oh dear", rateLimitServer.URL, nil)
-	expectMetrics(t, exporter, "failure.metrics")
+	exporter := NewExporter("oh dear", rateLimitServer.URL, []string{defaultRepository}, nil)
+	expectMetrics(t, exporter, "failure-network-token.metrics")
 }
 
 func TestBadRateLimitServerURLFails(t *testing.T) {
@@ -249,8 +224,8 @@ func TestBadRateLimitServerURLFails(t *testing.T) {
 	}))
 	defer authServer.Close()
 
-	exporter := NewExporter(authServer.URL, "oh dear", nil)
-	expectMetrics(t, exporter, "failure.metrics")
+	exporter := NewExporter(authServer.URL, "oh dear", []string{defaultRepository}, nil)
+	expectMetrics(t, exporter, "failure-network.metrics")
 }
 
 func TestBadJsonIsIgnored(t *testing.T) {
@@ -267,8 +242,8 @@ func TestBadJsonIsIgnored(t *testing.T) {
 	}))
 	defer rateLimitServer.Close()
 
-	exporter := NewExporter(authServer.URL, rateLimitServer.URL, nil)
-	expectMetrics(t, exporter, "failure.metrics")
+	exporter := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository}, nil)
+	expectMetrics(t, exporter, "failure-parse-token.metrics")
 }
 
 func TestTokenThatExpiresFarEnoughInTheFutureIsStillUsable(t *testing.T) {
@@ -292,3 +267,187 @@ func TestTokenThatExpiresRealSoonIsNotUsable(t *testing.T) {
 		t.Fatalf("Auth Token should still not be usable. %v", token.roughExpiry())
 	}
 }
+
+func TestTokenRequestsAreCountedSeparatelyFromReuse(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+	e.scrape(context.Background(), e.targets[0], time.Now())
+	e.scrape(context.Background(), e.targets[0], time.Now())
+
+	// Let the token expire, as if the next poll was an hour later
+	e.targets[0].authToken.IssuedAt = time.Now().Add(-time.Hour)
+	e.scrape(context.Background(), e.targets[0], time.Now())
+
+	for name, c := range map[string]struct {
+		counter  prometheus.Counter
+		expected float64
+	}{
+		"requests":  {e.tokenRequests, 2},
+		"refreshes": {e.tokenRefreshes, 1},
+		"failures":  {e.tokenRequestFailures, 0},
+	} {
+		if n := testutil.ToFloat64(c.counter); n != c.expected {
+			t.Errorf("Expected %v token %s, got %v", c.expected, name, n)
+		}
+	}
+}
+
+func TestTimeoutsAreClassifiedSeparately(t *testing.T) {
+	err := &url.Error{Op: "Head", URL: "https://registry-1.docker.io", Err: &net.DNSError{IsTimeout: true}}
+
+	if reason := failureReason(err); reason != failureReasonTimeout {
+		t.Fatalf("Expected a timeout, got %q", reason)
+	}
+}
+
+func TestConnectionFailuresAreClassified(t *testing.T) {
+	tlsServer := httptest.NewTLSServer(handler(&mockResponse{}))
+	defer tlsServer.Close()
+
+	resetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		_ = conn.Close()
+	}))
+	defer resetServer.Close()
+
+	for name, c := range map[string]struct {
+		url      string
+		expected string
+	}{
+		"tls":   {tlsServer.URL, failureReasonTLS},
+		"reset": {resetServer.URL, failureReasonReset},
+	} {
+		_, err := http.Get(c.url)
+
+		if reason := failureReason(err); reason != c.expected {
+			t.Errorf("Expected %s to be classified as %q, got %q: %v", name, c.expected, reason, err)
+		}
+	}
+
+	err := &url.Error{Op: "Head", URL: "https://registry-1.docker.io", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host"}}}
+
+	if reason := failureReason(err); reason != failureReasonDNS {
+		t.Errorf("Expected a DNS failure, got %q", reason)
+	}
+}
+
+func TestDataAgeIsReportedAfterFailures(t *testing.T) {
+	authServer := httptest.NewServer(handler(&mockResponse{
+		response: authResponseBody(),
+	}))
+	defer authServer.Close()
+
+	rateLimitServer := httptest.NewServer(subsequentRequestsFailHandler(&mockResponse{
+		headers: map[string][]string{
+			"RateLimit-Limit":     {"100;m21600"},
+			"RateLimit-Remaining": {"76;m21600"},
+		},
+	}))
+	defer rateLimitServer.Close()
+
+	now := time.Now()
+	exporter := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository}, nil)
+	exporter.clock = func() time.Time { return now }
+	expectMetrics(t, exporter, "success.metrics")
+
+	now = now.Add(30 * time.Second)
+	expectMetrics(t, exporter, "stale.metrics")
+}
+
+func TestEachRepositoryIsPolledWithItsOwnToken(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("scope")
+		w.Write([]byte(fmt.Sprintf(`{"token": "%s", "access_token": "%s", "expires_in": 300, "issued_at": "%s" }`, token, token, time.Now().Format(time.RFC3339))))
+	}))
+	defer authServer.Close()
+
+	rateLimitServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		repository := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v2/"), "/manifests/latest")
+
+		if r.Header.Get("Authorization") != "Bearer repository:"+repository+":pull" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", "100;w=21600")
+		w.Header().Set("RateLimit-Remaining", fmt.Sprintf("%d;w=21600", len(repository)))
+	}))
+	defer rateLimitServer.Close()
+
+	exporter := NewExporter(authServer.URL, rateLimitServer.URL, []string{"ratelimitpreview/test", "library/alpine"}, nil)
+	expectMetrics(t, exporter, "multi-repository.metrics")
+}
+
+func TestSlowTokenFetchSkipsTheManifestRequest(t *testing.T) {
+	now := time.Now()
+
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now = now.Add(3 * time.Second)
+		w.Write(authResponseBody())
+	}))
+	defer authServer.Close()
+
+	manifestRequests := 0
+	rateLimitServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		manifestRequests++
+		w.Header().Set("RateLimit-Limit", "100;w=21600")
+		w.Header().Set("RateLimit-Remaining", "76;w=21600")
+	}))
+	defer rateLimitServer.Close()
+
+	exporter := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository}, nil)
+	exporter.clock = func() time.Time { return now }
+	exporter.scrapeBudget = 4 * time.Second
+
+	exporter.scrape(context.Background(), exporter.targets[0], now)
+
+	if manifestRequests != 0 {
+		t.Errorf("Expected the manifest request to be skipped, got %d requests", manifestRequests)
+	}
+
+	if skips := testutil.ToFloat64(exporter.budgetSkips.WithLabelValues(phaseManifest)); skips != 1 {
+		t.Errorf("Expected 1 skipped manifest request, got %v", skips)
+	}
+
+	if failures := testutil.ToFloat64(exporter.scrapeFailures.WithLabelValues(failureReasonTimeout)); failures != 0 {
+		t.Errorf("Expected a skip not to count as a failure, got %v", failures)
+	}
+
+	// The token from the slow fetch can be reused, which leaves the whole budget for the manifest
+	exporter.scrape(context.Background(), exporter.targets[0], now)
+
+	if manifestRequests != 1 {
+		t.Errorf("Expected the manifest to be requested with the cached token, got %d requests", manifestRequests)
+	}
+
+	if remaining := testutil.ToFloat64(exporter.remaining.WithLabelValues(defaultRepository)); remaining != 76 {
+		t.Errorf("Expected 76 remaining, got %v", remaining)
+	}
+}
+
+func TestScrapesWithinTheMinimumPollIntervalReuseTheLastPoll(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	now := time.Now()
+
+	exporter := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+	exporter.clock = func() time.Time { return now }
+	exporter.minPollInterval = 30 * time.Second
+
+	for _, elapsed := range []time.Duration{0, 10 * time.Second, 10 * time.Second, 20 * time.Second} {
+		now = now.Add(elapsed)
+		testutil.CollectAndCount(exporter)
+	}
+
+	// Polled at 0s and 40s, but not at 10s or 20s
+	if requests := hub.ManifestRequests(); requests != 2 {
+		t.Errorf("Expected 2 polls, got %d", requests)
+	}
+
+	if age := testutil.ToFloat64(exporter.dataAge.WithLabelValues(defaultRepository)); age != 0 {
+		t.Errorf("Expected fresh values after the interval, got an age of %v", age)
+	}
+}
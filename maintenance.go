@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maintenanceWindow is a period when Docker Hub is known to be under maintenance, so failures to
+// poll it are expected.
+type maintenanceWindow struct {
+	start, end time.Time
+}
+
+// parseMaintenanceWindow parses a window written as an RFC 3339 interval, eg
+// "2020-11-20T10:00:00Z/2020-11-20T12:00:00Z".
+func parseMaintenanceWindow(s string) (maintenanceWindow, error) {
+	parts := strings.Split(s, "/")
+
+	if len(parts) != 2 {
+		return maintenanceWindow{}, fmt.Errorf("maintenance window %q should be written as <start>/<end>", s)
+	}
+
+	start, err := time.Parse(time.RFC3339, parts[0])
+
+	if err != nil {
+		return maintenanceWindow{}, fmt.Errorf("maintenance window %q has an invalid start: %v", s, err)
+	}
+
+	end, err := time.Parse(time.RFC3339, parts[1])
+
+	if err != nil {
+		return maintenanceWindow{}, fmt.Errorf("maintenance window %q has an invalid end: %v", s, err)
+	}
+
+	if !end.After(start) {
+		return maintenanceWindow{}, fmt.Errorf("maintenance window %q ends before it starts", s)
+	}
+
+	return maintenanceWindow{start: start, end: end}, nil
+}
+
+type maintenanceWindows []maintenanceWindow
+
+// contains returns whether t is within any of the windows.
+func (ws maintenanceWindows) contains(t time.Time) bool {
+	for _, w := range ws {
+		if !t.Before(w.start) && t.Before(w.end) {
+			return true
+		}
+	}
+
+	return false
+}
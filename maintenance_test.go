@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseMaintenanceWindow(t *testing.T) {
+	w, err := parseMaintenanceWindow("2020-11-20T10:00:00Z/2020-11-20T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for ts, expected := range map[string]bool{
+		"2020-11-20T09:59:59Z": false,
+		"2020-11-20T10:00:00Z": true,
+		"2020-11-20T11:00:00Z": true,
+		"2020-11-20T12:00:00Z": false,
+	} {
+		at, _ := time.Parse(time.RFC3339, ts)
+
+		if got := (maintenanceWindows{w}).contains(at); got != expected {
+			t.Errorf("Expected %s in window to be %v", ts, expected)
+		}
+	}
+}
+
+func TestParseMaintenanceWindowRejectsBadWindows(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"2020-11-20T10:00:00Z",
+		"2020-11-20T10:00:00Z/tomorrow",
+		"2020-11-20T12:00:00Z/2020-11-20T10:00:00Z",
+	} {
+		if _, err := parseMaintenanceWindow(s); err == nil {
+			t.Errorf("Expected an error parsing %q", s)
+		}
+	}
+}
+
+func TestFailuresDuringMaintenanceAreExpected(t *testing.T) {
+	authServer := httptest.NewServer(handler(&mockResponse{
+		response: authResponseBody(),
+	}))
+	defer authServer.Close()
+
+	rateLimitServer := httptest.NewServer(subsequentRequestsFailHandler(&mockResponse{
+		headers: map[string][]string{
+			"RateLimit-Limit":     {"100;m21600"},
+			"RateLimit-Remaining": {"76;m21600"},
+		},
+	}))
+	defer rateLimitServer.Close()
+
+	now := time.Now()
+	exporter := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository}, nil)
+	exporter.clock = func() time.Time { return now }
+	exporter.maintenanceWindows = maintenanceWindows{{start: now.Add(time.Minute), end: now.Add(time.Hour)}}
+	expectMetrics(t, exporter, "success.metrics")
+
+	now = now.Add(2 * time.Minute)
+	expectMetrics(t, exporter, "maintenance.metrics")
+
+	if err := exporter.ready(); err != nil {
+		t.Fatalf("Expected failures during maintenance not to affect readiness: %v", err)
+	}
+}
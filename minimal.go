@@ -0,0 +1,54 @@
+//go:build minimal
+// +build minimal
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The minimal build leaves out the optional subsystems, for a smaller binary on embedded devices.
+// These stand in for them, so that using them fails clearly.
+
+var errNotInMinimalBuild = errors.New("not available in the minimal build")
+
+// NewInventoryCollector is not available in the minimal build.
+func NewInventoryCollector(hubURL string, images []string, organizations []string, c *credentials, client *http.Client) (prometheus.Collector, error) {
+	return nil, errNotInMinimalBuild
+}
+
+// registerOptionalCollectors fails if args turn on any of the optional collectors, which poll APIs
+// other than the registry's, since none of them are in the minimal build.
+func registerOptionalCollectors(args *arguments, hubAPIURL string) error {
+	if args.account != "" || args.statusURL != "" || args.ghcr || args.harborURL != "" || len(args.ecrPublicRepositories) > 0 {
+		return fmt.Errorf("-account, -status-url, -ghcr, -harbor-url and -ecr-public-repository are %w", errNotInMinimalBuild)
+	}
+
+	return nil
+}
+
+// serveHistoryHTML is not available in the minimal build, which serves the history as JSON or CSV.
+func serveHistoryHTML(w http.ResponseWriter, histories []repositoryHistory) {
+	http.Error(w, "format=html is "+errNotInMinimalBuild.Error(), http.StatusNotImplemented)
+}
+
+// pusher stands in for the optional subsystems which send data somewhere periodically.
+type pusher interface {
+	prometheus.Collector
+	run(interval time.Duration)
+}
+
+// newOTLPExporter is not available in the minimal build.
+func newOTLPExporter(endpoint string, gatherer prometheus.Gatherer, client *http.Client) (pusher, error) {
+	return nil, errNotInMinimalBuild
+}
+
+// newTraceExporter is not available in the minimal build.
+func newTraceExporter(endpoint string, tr *tracer, client *http.Client) (pusher, error) {
+	return nil, errNotInMinimalBuild
+}
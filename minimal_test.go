@@ -0,0 +1,44 @@
+//go:build minimal
+// +build minimal
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTheMinimalBuildLeavesOutTheOptionalSubsystems(t *testing.T) {
+	for name, args := range map[string]*arguments{
+		"-account":               {account: "myorg"},
+		"-status-url":            {statusURL: "https://www.dockerstatus.com/api/v2/components.json"},
+		"-ghcr":                  {ghcr: true},
+		"-harbor-url":            {harborURL: "https://harbor.example.com"},
+		"-ecr-public-repository": {ecrPublicRepositories: []string{"docker/library/alpine"}},
+	} {
+		if err := registerOptionalCollectors(args, hubAPIURL); !errors.Is(err, errNotInMinimalBuild) {
+			t.Errorf("Expected %s not to be available, got %v", name, err)
+		}
+	}
+
+	if err := registerOptionalCollectors(&arguments{}, hubAPIURL); err != nil {
+		t.Errorf("Expected no optional collectors to be fine, got %v", err)
+	}
+
+	if _, err := NewInventoryCollector(hubAPIURL, []string{defaultRepository}, nil, nil, nil); !errors.Is(err, errNotInMinimalBuild) {
+		t.Errorf("Expected the inventory not to be available, got %v", err)
+	}
+
+	if _, err := newOTLPExporter("http://localhost:4318", nil, nil); !errors.Is(err, errNotInMinimalBuild) {
+		t.Errorf("Expected OTLP export not to be available, got %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	serveHistoryHTML(w, nil)
+
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected the history page not to be available, got %d", w.Code)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// headerMirrorHandler answers HEAD and GET requests for /v2/<repository>/manifests/<reference>
+// with the rate limit headers Docker Hub last sent about the repository, so that scripts which
+// already HEAD Docker Hub for them can be pointed at the exporter instead. Like rateLimitHandler, it
+// never polls Docker Hub itself.
+func headerMirrorHandler(e *Exporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead && r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		repository, ok := manifestRepository(r.URL.Path)
+
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		header, found := e.mirroredHeaders(repository)
+
+		if !found {
+			http.Error(w, fmt.Sprintf("%s isn't polled by this exporter", repository), http.StatusNotFound)
+			return
+		}
+
+		if header == nil {
+			http.Error(w, fmt.Sprintf("Docker Hub hasn't been polled about %s yet", repository), http.StatusServiceUnavailable)
+			return
+		}
+
+		for name, values := range header {
+			w.Header()[name] = values
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// manifestRepository extracts the repository from a manifest path, eg ratelimitpreview/test from
+// /v2/ratelimitpreview/test/manifests/latest.
+func manifestRepository(path string) (string, bool) {
+	path = strings.TrimPrefix(path, "/v2/")
+	i := strings.LastIndex(path, "/manifests/")
+
+	if i <= 0 || strings.HasSuffix(path, "/manifests/") {
+		return "", false
+	}
+
+	return path[:i], true
+}
+
+// mirroredHeaders returns the rate limit headers as Docker Hub would send them about repository,
+// or nil if it hasn't been polled successfully yet. found is false if it isn't one of e's targets.
+func (e *Exporter) mirroredHeaders(repository string) (header http.Header, found bool) {
+	e.rlock()
+	defer e.mu.RUnlock()
+
+	for _, t := range e.targets {
+		if t.repository != repository {
+			continue
+		}
+
+		if t.lastSuccess.IsZero() {
+			return nil, true
+		}
+
+		header = http.Header{}
+		header.Set(defaultHeaderMapping.limit, formatRateLimit(t.lastLimit, t.window))
+
+		if t.hasRemaining {
+			header.Set(defaultHeaderMapping.remaining, formatRateLimit(t.lastRemaining, t.window))
+		}
+
+		if t.sourceIP != "" {
+			header.Set("Docker-RateLimit-Source", t.sourceIP)
+		}
+
+		age := e.clock().Sub(t.lastSuccess).Seconds()
+		header.Set("Age", fmt.Sprintf("%.0f", math.Max(0, math.Floor(age))))
+
+		return header, true
+	}
+
+	return nil, false
+}
+
+// formatRateLimit is the inverse of parseWindow, eg 76;w=21600 for 76 per 6 hours.
+func formatRateLimit(value float64, window time.Duration) string {
+	if window <= 0 {
+		return fmt.Sprintf("%.0f", value)
+	}
+
+	return fmt.Sprintf("%.0f;w=%.0f", value, window.Seconds())
+}
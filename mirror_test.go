@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+)
+
+func TestHeaderMirrorServesTheLastRateLimitHeaders(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	hub.SetRateLimit(100, 76)
+	hub.SetSource("192.0.2.1")
+
+	now := time.Date(2020, 11, 16, 10, 0, 0, 0, time.UTC)
+	exporter := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository, "library/alpine"}, nil)
+	exporter.clock = func() time.Time { return now.Add(90 * time.Second) }
+	exporter.scrape(context.Background(), exporter.targets[0], now)
+
+	w := httptest.NewRecorder()
+	headerMirrorHandler(exporter)(w, httptest.NewRequest("HEAD", "/v2/ratelimitpreview/test/manifests/latest", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	for name, expected := range map[string]string{
+		"RateLimit-Limit":         "100;w=21600",
+		"RateLimit-Remaining":     "76;w=21600",
+		"Docker-RateLimit-Source": "192.0.2.1",
+		"Age":                     "90",
+	} {
+		if value := w.Header().Get(name); value != expected {
+			t.Errorf("Expected %s: %s, got %q", name, expected, value)
+		}
+	}
+
+	if requests := hub.ManifestRequests(); requests != 1 {
+		t.Errorf("Expected the mirror not to poll Docker Hub, got %d requests", requests)
+	}
+}
+
+func TestHeaderMirrorRejectsUnknownOrUnpolledRepositories(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	exporter := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+
+	for _, c := range []struct {
+		method, path string
+		code         int
+	}{
+		{"HEAD", "/v2/ratelimitpreview/test/manifests/latest", http.StatusServiceUnavailable},
+		{"HEAD", "/v2/library/alpine/manifests/latest", http.StatusNotFound},
+		{"HEAD", "/v2/", http.StatusNotFound},
+		{"POST", "/v2/ratelimitpreview/test/manifests/latest", http.StatusMethodNotAllowed},
+	} {
+		w := httptest.NewRecorder()
+		headerMirrorHandler(exporter)(w, httptest.NewRequest(c.method, c.path, nil))
+
+		if w.Code != c.code {
+			t.Errorf("%s %s: expected %d, got %d", c.method, c.path, c.code, w.Code)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// registerOptionalCollectors registers the collectors of the optional subsystems which args turn
+// on, which poll APIs other than the registry's.
+func registerOptionalCollectors(args *arguments, hubAPIURL string) error {
+	if args.account != "" {
+		prometheus.MustRegister(newAccountCollector(newHubAPI(hubAPIURL, args.credentials, args.plainClient), args.account))
+	}
+
+	if args.statusURL != "" {
+		prometheus.MustRegister(newStatusPageCollector(args.statusURL, args.plainClient))
+	}
+
+	if args.ghcr {
+		prometheus.MustRegister(newGHCRCollector(args.ghcrToken, args.ghcrRepositories, args.plainClient))
+	}
+
+	if args.harborURL != "" {
+		prometheus.MustRegister(newHarborCollector(args.harborURL, args.harborUsername, args.harborPassword, args.harborProjects, args.harborProbe, args.plainClient))
+	}
+
+	if len(args.ecrPublicRepositories) > 0 {
+		prometheus.MustRegister(newECRPublicCollector(args.ecrPublicRepositories, args.ecrPublicAuthenticated, args.plainClient))
+	}
+
+	return nil
+}
@@ -0,0 +1,277 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// otlpExporter periodically gathers the metrics and sends them to an OpenTelemetry collector,
+// using OTLP over HTTP with the JSON encoding. The encoding is simple enough to write out here,
+// which saves taking on the whole OpenTelemetry SDK.
+type otlpExporter struct {
+	url    string
+	client *http.Client
+
+	gatherer prometheus.Gatherer
+	failures prometheus.Counter
+}
+
+// newOTLPExporter returns an otlpExporter for the collector at endpoint, eg http://localhost:4318.
+func newOTLPExporter(endpoint string, gatherer prometheus.Gatherer, client *http.Client) (*otlpExporter, error) {
+	u, err := url.Parse(endpoint)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("OTLP endpoint %q should be an http or https URL", endpoint)
+	}
+
+	return &otlpExporter{
+		url:      strings.TrimRight(endpoint, "/") + "/v1/metrics",
+		client:   client,
+		gatherer: gatherer,
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exporter_otlp_failures_total",
+			Help:      "Number of errors while sending metrics to the OTLP endpoint.",
+		}),
+	}, nil
+}
+
+// Collect delivers the exporter's own metrics. It implements prometheus.Collector.
+func (o *otlpExporter) Collect(ch chan<- prometheus.Metric) {
+	ch <- o.failures
+}
+
+// Describe describes the exporter's own metrics. It implements prometheus.Collector.
+func (o *otlpExporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- o.failures.Desc()
+}
+
+// run sends the metrics every interval, forever.
+func (o *otlpExporter) run(interval time.Duration) {
+	for now := range time.Tick(interval) {
+		if err := o.push(now); err != nil {
+			fmt.Printf("otlp: %+v\n", err)
+			o.failures.Inc()
+		}
+	}
+}
+
+// push gathers the metrics and sends them as data points at now.
+func (o *otlpExporter) push(now time.Time) error {
+	families, err := o.gatherer.Gather()
+
+	if err != nil {
+		// Gather can return the metrics it did manage to collect alongside an error
+		fmt.Printf("otlp: %+v\n", err)
+	}
+
+	body, err := json.Marshal(toOTLP(families, now))
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", o.url, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := fetchHTTP(context.Background(), o.client, req)
+
+	if err != nil {
+		return err
+	}
+
+	closeResponse(res.Body)
+
+	return nil
+}
+
+// These follow the JSON mapping of the OTLP ExportMetricsServiceRequest protobuf message. 64 bit
+// integers are strings in that mapping.
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Gauge       *otlpGauge     `json:"gauge,omitempty"`
+	Sum         *otlpSum       `json:"sum,omitempty"`
+	Histogram   *otlpHistogram `json:"histogram,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type otlpHistogram struct {
+	DataPoints             []otlpHistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                      `json:"aggregationTemporality"`
+}
+
+type otlpDataPoint struct {
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	TimeUnixNano string          `json:"timeUnixNano"`
+	AsDouble     float64         `json:"asDouble"`
+}
+
+type otlpHistogramDataPoint struct {
+	Attributes     []otlpAttribute `json:"attributes,omitempty"`
+	TimeUnixNano   string          `json:"timeUnixNano"`
+	Count          string          `json:"count"`
+	Sum            float64         `json:"sum"`
+	BucketCounts   []string        `json:"bucketCounts"`
+	ExplicitBounds []float64       `json:"explicitBounds"`
+}
+
+type otlpAttribute struct {
+	Key   string             `json:"key"`
+	Value otlpAttributeValue `json:"value"`
+}
+
+type otlpAttributeValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+// otlpCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE, which is what Prometheus counters are.
+const otlpCumulative = 2
+
+// toOTLP converts the metric families into an OTLP request, with the data points at now.
+func toOTLP(families []*dto.MetricFamily, now time.Time) otlpRequest {
+	timestamp := strconv.FormatInt(now.UnixNano(), 10)
+
+	var metrics []otlpMetric
+
+	for _, mf := range families {
+		metric := otlpMetric{Name: mf.GetName(), Description: mf.GetHelp()}
+		var points []otlpDataPoint
+
+		for _, m := range mf.GetMetric() {
+			point := otlpDataPoint{Attributes: otlpAttributes(m.GetLabel()), TimeUnixNano: timestamp}
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				point.AsDouble = m.GetCounter().GetValue()
+			case dto.MetricType_GAUGE:
+				point.AsDouble = m.GetGauge().GetValue()
+			case dto.MetricType_HISTOGRAM:
+				if metric.Histogram == nil {
+					metric.Histogram = &otlpHistogram{AggregationTemporality: otlpCumulative}
+				}
+
+				metric.Histogram.DataPoints = append(metric.Histogram.DataPoints, otlpHistogramPoint(m, timestamp))
+				continue
+			default:
+				point.AsDouble = m.GetUntyped().GetValue()
+			}
+
+			points = append(points, point)
+		}
+
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			metric.Sum = &otlpSum{DataPoints: points, AggregationTemporality: otlpCumulative, IsMonotonic: true}
+		case dto.MetricType_HISTOGRAM:
+			// The data points were added to metric.Histogram as they were converted
+		default:
+			metric.Gauge = &otlpGauge{DataPoints: points}
+		}
+
+		metrics = append(metrics, metric)
+	}
+
+	return otlpRequest{
+		ResourceMetrics: []otlpResourceMetrics{{
+			Resource: otlpResource{
+				Attributes: []otlpAttribute{{Key: "service.name", Value: otlpAttributeValue{StringValue: "dockerhub_exporter"}}},
+			},
+			ScopeMetrics: []otlpScopeMetrics{{
+				Scope:   otlpScope{Name: "dockerhub_exporter"},
+				Metrics: metrics,
+			}},
+		}},
+	}
+}
+
+func otlpAttributes(labels []*dto.LabelPair) []otlpAttribute {
+	var attributes []otlpAttribute
+
+	for _, l := range labels {
+		attributes = append(attributes, otlpAttribute{Key: l.GetName(), Value: otlpAttributeValue{StringValue: l.GetValue()}})
+	}
+
+	return attributes
+}
+
+// otlpHistogramPoint converts a Prometheus histogram, whose buckets are cumulative, into an OTLP
+// one, whose buckets aren't.
+func otlpHistogramPoint(m *dto.Metric, timestamp string) otlpHistogramDataPoint {
+	h := m.GetHistogram()
+	point := otlpHistogramDataPoint{
+		Attributes:     otlpAttributes(m.GetLabel()),
+		TimeUnixNano:   timestamp,
+		Count:          strconv.FormatUint(h.GetSampleCount(), 10),
+		Sum:            h.GetSampleSum(),
+		BucketCounts:   []string{},
+		ExplicitBounds: []float64{},
+	}
+
+	var previous uint64
+
+	for _, b := range h.GetBucket() {
+		point.ExplicitBounds = append(point.ExplicitBounds, b.GetUpperBound())
+		point.BucketCounts = append(point.BucketCounts, strconv.FormatUint(b.GetCumulativeCount()-previous, 10))
+		previous = b.GetCumulativeCount()
+	}
+
+	// The +Inf bucket is implicit in Prometheus, but has to be given in OTLP
+	point.BucketCounts = append(point.BucketCounts, strconv.FormatUint(h.GetSampleCount()-previous, 10))
+
+	return point
+}
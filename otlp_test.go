@@ -0,0 +1,86 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetricsAreSentToOTLP(t *testing.T) {
+	var (
+		path string
+		req  otlpRequest
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&req)
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	remaining := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "remaining_requests",
+		Help:      "Remaining requests",
+	}, []string{"repository"})
+	remaining.WithLabelValues(defaultRepository).Set(42)
+	scrapes := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "exporter_scrapes_total",
+		Help:      "Scrapes",
+	})
+	scrapes.Add(3)
+	registry.MustRegister(remaining, scrapes)
+
+	otlp, err := newOTLPExporter(server.URL+"/", registry, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := otlp.push(time.Unix(1605520800, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/v1/metrics" {
+		t.Errorf("expected metrics to be sent to /v1/metrics, got %s", path)
+	}
+
+	repository := []otlpAttribute{{Key: "repository", Value: otlpAttributeValue{StringValue: defaultRepository}}}
+	expected := []otlpMetric{
+		{
+			Name:        "dockerhub_exporter_scrapes_total",
+			Description: "Scrapes",
+			Sum: &otlpSum{
+				DataPoints:             []otlpDataPoint{{TimeUnixNano: "1605520800000000000", AsDouble: 3}},
+				AggregationTemporality: otlpCumulative,
+				IsMonotonic:            true,
+			},
+		},
+		{
+			Name:        "dockerhub_remaining_requests",
+			Description: "Remaining requests",
+			Gauge: &otlpGauge{
+				DataPoints: []otlpDataPoint{{Attributes: repository, TimeUnixNano: "1605520800000000000", AsDouble: 42}},
+			},
+		},
+	}
+
+	if got := req.ResourceMetrics[0].ScopeMetrics[0].Metrics; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestOTLPEndpointMustBeHTTP(t *testing.T) {
+	if _, err := newOTLPExporter("localhost:4317", prometheus.NewRegistry(), nil); err == nil {
+		t.Error("expected an error for an endpoint without a scheme")
+	}
+}
@@ -0,0 +1,196 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// traceExporter periodically sends the spans recorded by a tracer to an OpenTelemetry collector,
+// using OTLP over HTTP with the JSON encoding, like otlpExporter does for the metrics.
+type traceExporter struct {
+	url    string
+	tracer *tracer
+	client *http.Client
+
+	failures prometheus.Counter
+}
+
+// newTraceExporter returns a traceExporter for the collector at endpoint, eg http://localhost:4318.
+func newTraceExporter(endpoint string, tr *tracer, client *http.Client) (*traceExporter, error) {
+	// The endpoint is checked in the same way as for the metrics
+	if _, err := newOTLPExporter(endpoint, nil, nil); err != nil {
+		return nil, err
+	}
+
+	return &traceExporter{
+		url:    strings.TrimRight(endpoint, "/") + "/v1/traces",
+		tracer: tr,
+		client: client,
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exporter_otlp_trace_failures_total",
+			Help:      "Number of errors while sending traces to the OTLP endpoint.",
+		}),
+	}, nil
+}
+
+// Collect delivers the exporter's own metrics. It implements prometheus.Collector.
+func (x *traceExporter) Collect(ch chan<- prometheus.Metric) {
+	ch <- x.failures
+}
+
+// Describe describes the exporter's own metrics. It implements prometheus.Collector.
+func (x *traceExporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- x.failures.Desc()
+}
+
+// run sends the finished spans every interval, forever.
+func (x *traceExporter) run(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := x.push(); err != nil {
+			fmt.Printf("otlp: %+v\n", err)
+			x.failures.Inc()
+		}
+	}
+}
+
+// push sends the spans which have finished since the last push, if there are any.
+func (x *traceExporter) push() error {
+	spans := x.tracer.take()
+
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(toOTLPTraces(spans))
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", x.url, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := fetchHTTP(context.Background(), x.client, req)
+
+	if err != nil {
+		return err
+	}
+
+	closeResponse(res.Body)
+
+	return nil
+}
+
+// These follow the JSON mapping of the OTLP ExportTraceServiceRequest protobuf message, where trace
+// and span IDs are hex strings.
+
+type otlpTraceRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// Values of the OTLP SpanKind and StatusCode enums
+const (
+	otlpSpanKindInternal = 1
+	otlpSpanKindClient   = 3
+
+	otlpStatusOK    = 1
+	otlpStatusError = 2
+)
+
+func toOTLPTraces(spans []*span) otlpTraceRequest {
+	converted := make([]otlpSpan, 0, len(spans))
+
+	for _, s := range spans {
+		o := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Status:            otlpStatus{Code: otlpStatusOK},
+		}
+
+		if s.parentID != [8]byte{} {
+			o.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+
+		if s.client {
+			o.Kind = otlpSpanKindClient
+		}
+
+		if s.err != nil {
+			o.Status = otlpStatus{Code: otlpStatusError, Message: s.err.Error()}
+		}
+
+		keys := make([]string, 0, len(s.attributes))
+		for k := range s.attributes {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			o.Attributes = append(o.Attributes, otlpAttribute{Key: k, Value: otlpAttributeValue{StringValue: s.attributes[k]}})
+		}
+
+		converted = append(converted, o)
+	}
+
+	return otlpTraceRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpAttribute{{Key: "service.name", Value: otlpAttributeValue{StringValue: "dockerhub_exporter"}}},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "dockerhub_exporter"},
+				Spans: converted,
+			}},
+		}},
+	}
+}
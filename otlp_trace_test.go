@@ -0,0 +1,105 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEachScrapeIsTraced(t *testing.T) {
+	authServer := httptest.NewServer(handler(&mockResponse{
+		response: authResponseBody(),
+	}))
+	defer authServer.Close()
+
+	rateLimitServer := httptest.NewServer(handler(&mockResponse{
+		headers: map[string][]string{
+			"RateLimit-Limit":     {"100;w=21600"},
+			"RateLimit-Remaining": {"76;w=21600"},
+		},
+	}))
+	defer rateLimitServer.Close()
+
+	var req otlpTraceRequest
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("expected traces to be sent to /v1/traces, got %s", r.URL.Path)
+		}
+
+		_ = json.NewDecoder(r.Body).Decode(&req)
+	}))
+	defer collector.Close()
+
+	e := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository}, nil)
+	e.tracer = &tracer{}
+	e.scrape(context.Background(), e.targets[0], time.Now())
+
+	traces, err := newTraceExporter(collector.URL, e.tracer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := traces.push(); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := map[string]otlpSpan{}
+	for _, s := range req.ResourceSpans[0].ScopeSpans[0].Spans {
+		spans[s.Name] = s
+	}
+
+	root, ok := spans["scrape"]
+	if !ok || root.ParentSpanID != "" {
+		t.Fatalf("expected a root scrape span, got %+v", spans)
+	}
+
+	for name, kind := range map[string]int{"auth": otlpSpanKindClient, "manifest HEAD": otlpSpanKindClient, "parse headers": otlpSpanKindInternal} {
+		s, ok := spans[name]
+
+		if !ok {
+			t.Errorf("expected a %q span", name)
+			continue
+		}
+
+		if s.TraceID != root.TraceID || s.ParentSpanID != root.SpanID {
+			t.Errorf("expected %q to be a child of the scrape span, got %+v", name, s)
+		}
+
+		if s.Kind != kind || s.Status.Code != otlpStatusOK {
+			t.Errorf("expected %q to be a successful span of kind %d, got %+v", name, kind, s)
+		}
+	}
+
+	if err := traces.push(); err != nil {
+		t.Errorf("expected nothing to push, got %v", err)
+	}
+}
+
+func TestFailedPhasesAreTracedAsErrors(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer authServer.Close()
+
+	e := NewExporter(authServer.URL, "http://localhost", []string{defaultRepository}, nil)
+	e.tracer = &tracer{}
+	e.scrape(context.Background(), e.targets[0], time.Now())
+
+	spans := toOTLPTraces(e.tracer.take()).ResourceSpans[0].ScopeSpans[0].Spans
+
+	if len(spans) != 2 {
+		t.Fatalf("expected auth and scrape spans, got %+v", spans)
+	}
+
+	for _, s := range spans {
+		if s.Status.Code != otlpStatusError {
+			t.Errorf("expected %q to be an error, got %+v", s.Name, s.Status)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// tokenClaims is the part of the JWT issued by Docker Hub's auth server which says what the
+// token grants access to.
+type tokenClaims struct {
+	Access []struct {
+		Type    string   `json:"type"`
+		Name    string   `json:"name"`
+		Actions []string `json:"actions"`
+	} `json:"access"`
+}
+
+// grantedActions returns the actions that the token allows on repository, eg "pull".
+func (a *AuthTokenResponse) grantedActions(repository string) ([]string, error) {
+	token := a.Token
+	if token == "" {
+		token = a.AccessToken
+	}
+
+	parts := strings.Split(token, ".")
+
+	if len(parts) != 3 {
+		return nil, errors.New("token is not a JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode token: %v", err)
+	}
+
+	var claims tokenClaims
+
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("unable to decode token: %v", err)
+	}
+
+	for _, access := range claims.Access {
+		if access.Type == "repository" && access.Name == repository {
+			return access.Actions, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// checkPullScope gets a token for each target, and checks that it allows pulling the repository.
+// Docker Hub still issues a token if the credentials don't have pull access, but it won't have
+// any rate limit headers on its responses.
+func (e *Exporter) checkPullScope() error {
+	for _, t := range e.targets {
+		// Registry targets are polled anonymously
+		if t.registry != nil {
+			continue
+		}
+
+		polled, credentials := e.pollCopy(t)
+		_, err := e.fetchToken(context.Background(), polled)
+
+		e.lock()
+		e.keepAuth(t, polled, credentials)
+		e.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+
+		actions, err := polled.authToken.grantedActions(t.repository)
+
+		if err != nil {
+			return &scrapeError{reason: failureReasonParse, err: err}
+		}
+
+		if !contains(actions, "pull") {
+			return &scrapeError{reason: failureReasonAuth, err: fmt.Errorf("token does not have pull access to %s", t.repository)}
+		}
+	}
+
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func jwtWithAccess(access string) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"access": ` + access + `}`))
+	return "eyJhbGciOiJSUzI1NiJ9." + payload + ".c2lnbmF0dXJl"
+}
+
+func patAuthServer(access string) *httptest.Server {
+	token := jwtWithAccess(access)
+
+	return httptest.NewServer(handler(&mockResponse{
+		response: []byte(fmt.Sprintf(`{"token": "%s", "access_token": "%s", "expires_in": 300, "issued_at": "%s" }`, token, token, time.Now().Format(time.RFC3339))),
+	}))
+}
+
+func TestPersonalAccessTokenWithPullScopeIsAccepted(t *testing.T) {
+	authServer := patAuthServer(`[{"type": "repository", "name": "ratelimitpreview/test", "actions": ["pull"]}]`)
+	defer authServer.Close()
+
+	exporter := NewExporter(authServer.URL, "http://localhost:0", []string{defaultRepository}, nil)
+
+	if err := exporter.checkPullScope(); err != nil {
+		t.Fatalf("Expected token to be accepted: %v", err)
+	}
+}
+
+func TestPersonalAccessTokenWithoutPullScopeIsRejected(t *testing.T) {
+	for _, access := range []string{
+		`[]`,
+		`[{"type": "repository", "name": "ratelimitpreview/test", "actions": []}]`,
+		`[{"type": "repository", "name": "library/alpine", "actions": ["pull"]}]`,
+	} {
+		authServer := patAuthServer(access)
+
+		exporter := NewExporter(authServer.URL, "http://localhost:0", []string{defaultRepository}, nil)
+		err := exporter.checkPullScope()
+
+		if reason := failureReason(err); err == nil || reason != failureReasonAuth {
+			t.Errorf("Expected token with access %s to be rejected, got %v", access, err)
+		}
+
+		authServer.Close()
+	}
+}
+
+func TestOpaqueTokensCannotBeChecked(t *testing.T) {
+	authServer := httptest.NewServer(handler(&mockResponse{
+		response: authResponseBody(),
+	}))
+	defer authServer.Close()
+
+	exporter := NewExporter(authServer.URL, "http://localhost:0", []string{defaultRepository}, nil)
+
+	if reason := failureReason(exporter.checkPullScope()); reason != failureReasonParse {
+		t.Fatalf("Expected a parse failure, got %q", reason)
+	}
+}
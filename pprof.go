@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+)
+
+// pprofHandler serves the net/http/pprof profiles under /debug/pprof/, for profiling the memory
+// and goroutines of a long-running exporter. /debug/pprof/cmdline is left out, since the command
+// line can have -pass or -token in it.
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	return mux
+}
+
+// servePprof serves the profiles on their own address, away from the metrics. That server has no
+// write timeout, since a CPU profile or trace takes as long as it's asked to.
+func servePprof(address string) error {
+	l, err := listenOn(address)
+
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s: %w", address, err)
+	}
+
+	go func() {
+		if err := http.Serve(l, pprofHandler()); err != nil {
+			fmt.Printf("Error serving the profiles: %v\n", err)
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPprofLeavesOutTheCommandLine(t *testing.T) {
+	server := httptest.NewServer(pprofHandler())
+	defer server.Close()
+
+	for path, expected := range map[string]int{
+		"/debug/pprof/":           http.StatusOK,
+		"/debug/pprof/goroutine":  http.StatusOK,
+		"/debug/pprof/heap":       http.StatusOK,
+		"/debug/pprof/cmdline":    http.StatusNotFound,
+		"/debug/pprof/symbol":     http.StatusOK,
+		"/debug/pprof/not-a-prof": http.StatusNotFound,
+	} {
+		res, err := http.Get(server.URL + path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res.Body.Close()
+
+		if res.StatusCode != expected {
+			t.Errorf("Expected %d for %s, got %d", expected, path, res.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// measureProbeCost polls Docker Hub about t again straight away, and records how much the remaining
+// requests dropped by in between. Docker Hub says that the HEAD requests used to poll it don't
+// count against the rate limit, and this is a way to check. The token is reused, so only the HEAD
+// request is repeated.
+func (e *Exporter) measureProbeCost(ctx context.Context, t *target, remaining float64) {
+	_, again, _, err := e.fetchRateLimit(ctx, t, nil)
+
+	if err != nil {
+		fmt.Printf("%s: unable to measure probe cost: %+v\n", t.repository, err)
+		return
+	}
+
+	e.probeCost.WithLabelValues(t.repository).Set(remaining - again)
+}
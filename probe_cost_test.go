@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestProbeCostIsMeasured(t *testing.T) {
+	authServer := httptest.NewServer(handler(&mockResponse{
+		response: authResponseBody(),
+	}))
+	defer authServer.Close()
+
+	for _, cost := range []int{0, 1} {
+		remaining := 100
+		rateLimitServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("RateLimit-Limit", "100;w=21600")
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining)+";w=21600")
+			remaining -= cost
+		}))
+
+		e := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository}, nil)
+		e.measuringProbeCost = true
+		e.scrape(context.Background(), e.targets[0], time.Now())
+		rateLimitServer.Close()
+
+		if measured := testutil.ToFloat64(e.probeCost.WithLabelValues(defaultRepository)); measured != float64(cost) {
+			t.Errorf("Expected a probe cost of %d, got %v", cost, measured)
+		}
+
+		if exported := testutil.ToFloat64(e.remaining.WithLabelValues(defaultRepository)); exported != 100 {
+			t.Errorf("Expected the first poll to be exported, got %v remaining", exported)
+		}
+	}
+}
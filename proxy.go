@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// proxyDirect is the -proxy for a repository which should be polled without a proxy.
+const proxyDirect = "direct"
+
+// parseProxy parses a -proxy flag, which is <repository>=<proxy URL>, or <repository>=direct to
+// poll it without a proxy. The proxy is nil for direct.
+func parseProxy(flag string) (string, *url.URL, error) {
+	parts := strings.SplitN(flag, "=", 2)
+
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", nil, fmt.Errorf("proxy %q should be <repository>=<proxy URL> or <repository>=%s", flag, proxyDirect)
+	}
+
+	if parts[1] == proxyDirect {
+		return parts[0], nil, nil
+	}
+
+	proxy, err := url.Parse(parts[1])
+
+	if err != nil {
+		return "", nil, fmt.Errorf("proxy for %s isn't a valid URL: %w", parts[0], err)
+	}
+
+	switch proxy.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return "", nil, fmt.Errorf("proxy for %s should be an http, https or socks5 URL, got %q", parts[0], parts[1])
+	}
+
+	if proxy.Host == "" {
+		return "", nil, fmt.Errorf("proxy for %s has no host: %q", parts[0], parts[1])
+	}
+
+	return parts[0], proxy, nil
+}
+
+// proxyClient returns a copy of base which connects through proxy, or directly if it's nil, rather
+// than using the proxy from the environment.
+func proxyClient(base *http.Client, proxy *url.URL) *http.Client {
+	transport, ok := base.Transport.(*http.Transport)
+	if !ok {
+		transport = http.DefaultTransport.(*http.Transport)
+	}
+
+	transport = transport.Clone()
+	transport.Proxy = nil
+
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	return &http.Client{Transport: transport, Timeout: base.Timeout}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+)
+
+func TestProxiesAreParsed(t *testing.T) {
+	repository, proxy, err := parseProxy("library/alpine=http://proxy.example.com:3128")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if repository != "library/alpine" || proxy.String() != "http://proxy.example.com:3128" {
+		t.Errorf("Unexpected proxy %v for %s", proxy, repository)
+	}
+
+	if _, proxy, err := parseProxy("library/alpine=direct"); err != nil || proxy != nil {
+		t.Errorf("Expected a direct connection, got %v, %v", proxy, err)
+	}
+
+	for _, invalid := range []string{
+		"library/alpine",
+		"=http://proxy.example.com:3128",
+		"library/alpine=",
+		"library/alpine=ftp://proxy.example.com",
+		"library/alpine=proxy.example.com:3128",
+	} {
+		if _, _, err := parseProxy(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestEachRepositoryIsPolledThroughItsOwnProxy(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	proxied := 0
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied++
+
+		// Requests to a proxy have the absolute URL of where they're going
+		httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: r.URL.Host}).ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	args := lintArgs()
+	args.authServerURL = hub.Auth.URL
+	args.registryURL = hub.Registry.URL
+	args.repositories = stringsFlag{"library/alpine", "library/nginx"}
+	args.proxies = map[string]*url.URL{"library/alpine": proxyURL, "library/nginx": nil}
+
+	e := args.newExporter(nil)
+
+	e.scrape(context.Background(), e.targets[0], e.clock())
+
+	if proxied != 2 {
+		t.Errorf("Expected the token and manifest requests for library/alpine to be proxied, got %d proxied requests", proxied)
+	}
+
+	e.scrape(context.Background(), e.targets[1], e.clock())
+
+	if proxied != 2 || hub.ManifestRequests() != 2 {
+		t.Errorf("Expected library/nginx to be polled directly, got %d proxied requests", proxied)
+	}
+}
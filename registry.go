@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// registryTarget is a repository on an OCI registry other than Docker Hub, eg Harbor or an
+// Artifactory remote, whose pull quota headers are polled like Docker Hub's rate limit. The
+// registry's token endpoint is discovered from the WWW-Authenticate challenge on its /v2/ endpoint,
+// and it's polled anonymously, since the credentials are Docker Hub's.
+type registryTarget struct {
+	url     string // the registry, eg https://harbor.example.com
+	path    string // the path to poll, eg /v2/library/nginx/manifests/latest
+	headers headerMapping
+}
+
+// parseRegistryTarget parses a -registry-target flag, which is <registry host>/<repository>,
+// optionally followed by comma separated options: url=<registry URL> to poll other than
+// https://<registry host>, path=<path> to poll other than the repository's latest manifest, and
+// limit-header=<header> and remaining-header=<header> to read the quota from other headers than
+// the -limit-header and -remaining-header given as headers. The reference is the target's
+// repository label.
+func parseRegistryTarget(flag string, headers headerMapping) (string, *registryTarget, error) {
+	parts := strings.Split(flag, ",")
+	reference := parts[0]
+	slash := strings.Index(reference, "/")
+
+	if slash <= 0 || slash == len(reference)-1 {
+		return "", nil, fmt.Errorf("registry target %q should be <registry host>/<repository>[,<option>=<value>...]", flag)
+	}
+
+	host, repository := reference[:slash], reference[slash+1:]
+	r := &registryTarget{
+		url:     "https://" + host,
+		path:    "/v2/" + repository + "/manifests/latest",
+		headers: headers,
+	}
+
+	for _, option := range parts[1:] {
+		kv := strings.SplitN(option, "=", 2)
+
+		if len(kv) != 2 || kv[1] == "" {
+			return "", nil, fmt.Errorf("option %q for registry target %s should be <option>=<value>", option, reference)
+		}
+
+		switch kv[0] {
+		case "url":
+			u, err := url.Parse(kv[1])
+
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return "", nil, fmt.Errorf("url for registry target %s should be an http or https URL, got %q", reference, kv[1])
+			}
+
+			r.url = strings.TrimRight(kv[1], "/")
+		case "path":
+			if !strings.HasPrefix(kv[1], "/") {
+				return "", nil, fmt.Errorf("path for registry target %s should start with /, got %q", reference, kv[1])
+			}
+
+			r.path = kv[1]
+		case "limit-header":
+			r.headers.limit = kv[1]
+		case "remaining-header":
+			r.headers.remaining = kv[1]
+		default:
+			return "", nil, fmt.Errorf("unknown option %q for registry target %s, should be url, path, limit-header or remaining-header", kv[0], reference)
+		}
+	}
+
+	return reference, r, nil
+}
+
+// registryScope is the token scope for pulling the repository of a registry target.
+func registryScope(reference string) string {
+	return "repository:" + reference[strings.Index(reference, "/")+1:] + ":pull"
+}
+
+// discoverAuth finds where to get tokens for t's registry from, by requesting its /v2/ endpoint
+// without one. A registry which doesn't need a token leaves t.authServerURL empty.
+func (e *Exporter) discoverAuth(ctx context.Context, t *target) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", t.registry.url+"/v2/", nil)
+
+	if err != nil {
+		return err
+	}
+
+	res, err := e.fetch(ctx, t, req)
+
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusUnauthorized {
+		realm, service, ok := parseBearerChallenge(statusErr.Header.Get("WWW-Authenticate"))
+
+		if !ok {
+			return &scrapeError{reason: failureReasonAuth, err: fmt.Errorf("%s needs authentication, but doesn't offer bearer tokens", t.registry.url)}
+		}
+
+		query := url.Values{"scope": {registryScope(t.repository)}}
+		if service != "" {
+			query.Set("service", service)
+		}
+
+		t.authServerURL = realm + "?" + query.Encode()
+		t.authDiscovered = true
+
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	closeResponse(res.Body)
+	t.authDiscovered = true
+
+	return nil
+}
+
+// parseBearerChallenge returns the realm and service of a WWW-Authenticate challenge for a bearer
+// token, eg Bearer realm="https://auth.docker.io/token",service="registry.docker.io".
+func parseBearerChallenge(challenge string) (realm string, service string, ok bool) {
+	const scheme = "bearer "
+
+	if len(challenge) < len(scheme) || !strings.EqualFold(challenge[:len(scheme)], scheme) {
+		return "", "", false
+	}
+
+	params := map[string]string{}
+	rest := strings.TrimSpace(challenge[len(scheme):])
+
+	for rest != "" {
+		eq := strings.Index(rest, "=")
+
+		if eq < 0 {
+			break
+		}
+
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+
+		var value string
+
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+
+			if end < 0 {
+				return "", "", false
+			}
+
+			value, rest = rest[1:end+1], rest[end+2:]
+		} else if comma := strings.Index(rest, ","); comma >= 0 {
+			value, rest = rest[:comma], rest[comma:]
+		} else {
+			value, rest = rest, ""
+		}
+
+		params[key] = value
+		rest = strings.TrimLeft(rest, ", ")
+	}
+
+	return params["realm"], params["service"], params["realm"] != ""
+}
+
+// fetchTargetToken gets a token to poll t with: from Docker Hub, or for a registry target, from
+// wherever its registry says to, anonymously. It's nil for a registry which doesn't need one.
+func (e *Exporter) fetchTargetToken(ctx context.Context, t *target) (*string, error) {
+	if t.registry == nil {
+		return e.fetchToken(ctx, t)
+	}
+
+	if !t.authDiscovered {
+		if err := e.discoverAuth(ctx, t); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.authServerURL == "" {
+		return nil, nil
+	}
+
+	if !e.hasUsableToken(t) {
+		if _, err := e.sharedToken(ctx, t, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	// Registries can issue the token as either, where Docker Hub issues both
+	if t.authToken.Token == "" {
+		return &t.authToken.AccessToken, nil
+	}
+
+	return &t.authToken.Token, nil
+}
+
+// targetHeaders returns the headers that t's rate limit is read from.
+func (e *Exporter) targetHeaders(t *target) headerMapping {
+	if t.registry != nil {
+		return t.registry.headers
+	}
+
+	return e.headers
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistryTargetsAreParsed(t *testing.T) {
+	repository, r, err := parseRegistryTarget("harbor.example.com/library/nginx,limit-header=X-Quota-Limit,path=/v2/library/nginx/manifests/stable", defaultHeaderMapping)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := registryTarget{
+		url:     "https://harbor.example.com",
+		path:    "/v2/library/nginx/manifests/stable",
+		headers: headerMapping{limit: "X-Quota-Limit", remaining: defaultHeaderMapping.remaining},
+	}
+
+	if repository != "harbor.example.com/library/nginx" || *r != expected {
+		t.Errorf("Expected %+v for harbor.example.com/library/nginx, got %+v for %s", expected, *r, repository)
+	}
+
+	for _, flag := range []string{"nginx", "harbor.example.com/", "harbor.example.com/nginx,colour=blue", "harbor.example.com/nginx,url=ftp://example.com"} {
+		if _, _, err := parseRegistryTarget(flag, defaultHeaderMapping); err == nil {
+			t.Errorf("Expected %q to be rejected", flag)
+		}
+	}
+}
+
+func TestBearerChallengesAreParsed(t *testing.T) {
+	realm, service, ok := parseBearerChallenge(`Bearer realm="https://harbor.example.com/service/token",service="harbor-registry"`)
+
+	if !ok || realm != "https://harbor.example.com/service/token" || service != "harbor-registry" {
+		t.Errorf("Expected the realm and service, got %q %q %v", realm, service, ok)
+	}
+
+	if _, _, ok := parseBearerChallenge(`Basic realm="harbor"`); ok {
+		t.Error("Expected a basic challenge not to be a bearer one")
+	}
+}
+
+func TestRegistryTargetsDiscoverTheirTokenEndpoint(t *testing.T) {
+	var registry *httptest.Server
+	var authorization, scope string
+	var leaked bool
+
+	registry = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/service/token",service="harbor-registry"`, registry.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/service/token":
+			scope = r.URL.Query().Get("scope")
+			_, _, leaked = r.BasicAuth()
+			fmt.Fprintf(w, `{"access_token": "harbor-token", "expires_in": 300, "issued_at": %q}`, time.Now().Format(time.RFC3339))
+		case "/v2/library/nginx/manifests/latest":
+			authorization = r.Header.Get("Authorization")
+			w.Header().Set("X-Quota-Limit", "1000")
+			w.Header().Set("X-Quota-Remaining", "998")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer registry.Close()
+
+	host := strings.TrimPrefix(registry.URL, "http://")
+	args := lintArgs()
+	args.credentials = &credentials{username: "username", passphrase: "password"}
+	args.repositories = stringsFlag{host + "/library/nginx"}
+	args.registries = map[string]*registryTarget{}
+
+	_, r, err := parseRegistryTarget(host+"/library/nginx,url="+registry.URL+",limit-header=X-Quota-Limit,remaining-header=X-Quota-Remaining", args.headers)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args.registries[host+"/library/nginx"] = r
+	e := args.newExporter(args.credentials)
+	limit, remaining, _, err := e.fetchRateLimit(context.Background(), e.targets[0], nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if limit != 1000 || remaining != 998 {
+		t.Errorf("Expected 998/1000 remaining, got %v/%v", remaining, limit)
+	}
+
+	if scope != "repository:library/nginx:pull" || authorization != "Bearer harbor-token" {
+		t.Errorf("Expected the token for the repository to be used, got scope %q and %q", scope, authorization)
+	}
+
+	if leaked {
+		t.Error("Expected the Docker Hub credentials not to be sent to another registry")
+	}
+}
@@ -0,0 +1,203 @@
+// Package registrytest provides a fake Docker Hub for tests: an auth server which issues tokens,
+// and a registry which answers manifest requests with rate limit headers, like the real one does.
+package registrytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is a fake Docker Hub. Use Auth.URL in place of https://auth.docker.io/token and
+// Registry.URL in place of https://registry-1.docker.io.
+//
+// Tokens are scoped to a repository, and the registry only accepts a token for the repository it
+// was issued for. Its behaviour can be changed between requests with the Set methods.
+type Server struct {
+	Auth     *httptest.Server
+	Registry *httptest.Server
+
+	mu sync.Mutex
+
+	username, password string
+
+	limit, remaining int
+	window           time.Duration
+	source           string
+
+	authStatus, registryStatus int
+
+	tokenRequests, manifestRequests int
+}
+
+// NewServer starts a fake Docker Hub, which allows anonymous access and reports 100 of 100 requests
+// remaining in a 6 hour window. The caller should call Close when finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		limit:     100,
+		remaining: 100,
+		window:    6 * time.Hour,
+	}
+
+	s.Auth = httptest.NewServer(http.HandlerFunc(s.serveToken))
+	s.Registry = httptest.NewServer(http.HandlerFunc(s.serveManifest))
+
+	return s
+}
+
+// Close shuts down the auth server and the registry.
+func (s *Server) Close() {
+	s.Auth.Close()
+	s.Registry.Close()
+}
+
+// SetCredentials makes the auth server require basic auth with username and password. An empty
+// username allows anonymous access again.
+func (s *Server) SetCredentials(username, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.username, s.password = username, password
+}
+
+// SetRateLimit sets the limit and remaining requests that the registry reports.
+func (s *Server) SetRateLimit(limit, remaining int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.limit, s.remaining = limit, remaining
+}
+
+// SetWindow sets the rate limit window that the registry reports.
+func (s *Server) SetWindow(window time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.window = window
+}
+
+// SetSource sets the IP address that the registry says the requests are counted against, in the
+// Docker-RateLimit-Source header. An empty source leaves out the header.
+func (s *Server) SetSource(source string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.source = source
+}
+
+// SetAuthStatus makes the auth server fail with status, eg http.StatusServiceUnavailable. Zero
+// makes it succeed again.
+func (s *Server) SetAuthStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.authStatus = status
+}
+
+// SetRegistryStatus makes the registry fail with status, eg http.StatusTooManyRequests. Zero makes
+// it succeed again.
+func (s *Server) SetRegistryStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.registryStatus = status
+}
+
+// TokenRequests returns how many tokens have been asked for, successfully or not.
+func (s *Server) TokenRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.tokenRequests
+}
+
+// ManifestRequests returns how many manifest requests the registry has had, successfully or not.
+func (s *Server) ManifestRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.manifestRequests
+}
+
+func (s *Server) serveToken(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokenRequests++
+
+	if s.authStatus != 0 {
+		w.WriteHeader(s.authStatus)
+		return
+	}
+
+	if s.username != "" {
+		if username, password, ok := r.BasicAuth(); !ok || username != s.username || password != s.password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+			http.Error(w, "Not authorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	_, _ = w.Write(TokenResponse(r.URL.Query().Get("scope"), time.Now()))
+}
+
+func (s *Server) serveManifest(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.manifestRequests++
+
+	repository := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v2/"), "/manifests/latest")
+
+	if r.Header.Get("Authorization") != "Bearer "+scope(repository) {
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	if s.source != "" {
+		w.Header().Set("Docker-RateLimit-Source", s.source)
+	}
+
+	w.Header().Set("RateLimit-Limit", fmt.Sprintf("%d;w=%d", s.limit, int(s.window.Seconds())))
+	w.Header().Set("RateLimit-Remaining", fmt.Sprintf("%d;w=%d", s.remaining, int(s.window.Seconds())))
+
+	if s.registryStatus != 0 {
+		w.WriteHeader(s.registryStatus)
+	}
+}
+
+// scope is the token scope for pulling repository, which the fake auth server uses as the token.
+func scope(repository string) string {
+	return "repository:" + repository + ":pull"
+}
+
+// TokenResponse returns the body of a Docker Hub token response for token, issued at issuedAt and
+// valid for 5 minutes.
+func TokenResponse(token string, issuedAt time.Time) []byte {
+	b, _ := json.Marshal(struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		IssuedAt    string `json:"issued_at"`
+	}{token, token, 300, issuedAt.Format(time.RFC3339)})
+
+	return b
+}
+
+// BasicAuth wraps h so that it only serves requests with basic auth for username and password, and
+// responds 401 Unauthorized to anything else.
+func BasicAuth(username, password string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != username || p != password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+			http.Error(w, "Not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,120 @@
+package registrytest
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func pull(t *testing.T, s *Server, repository string, username string, password string) *http.Response {
+	req, _ := http.NewRequest("GET", s.Auth.URL+"?service=registry.docker.io&scope="+scope(repository), nil)
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return res
+	}
+
+	var token struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ = http.NewRequest("HEAD", s.Registry.URL+"/v2/"+repository+"/manifests/latest", nil)
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	return res
+}
+
+func TestRateLimitHeadersAreReported(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.SetRateLimit(200, 150)
+	s.SetWindow(time.Hour)
+	s.SetSource("192.0.2.1")
+
+	res := pull(t, s, "library/alpine", "", "")
+
+	for header, expected := range map[string]string{
+		"RateLimit-Limit":         "200;w=3600",
+		"RateLimit-Remaining":     "150;w=3600",
+		"Docker-RateLimit-Source": "192.0.2.1",
+	} {
+		if got := res.Header.Get(header); got != expected {
+			t.Errorf("Expected %s %q, got %q", header, expected, got)
+		}
+	}
+
+	if s.TokenRequests() != 1 || s.ManifestRequests() != 1 {
+		t.Errorf("Expected 1 token and 1 manifest request, got %d and %d", s.TokenRequests(), s.ManifestRequests())
+	}
+}
+
+func TestCredentialsAreRequiredOnceSet(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.SetCredentials("username", "password")
+
+	if res := pull(t, s, "library/alpine", "username", "wrong"); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected wrong credentials to be rejected, got %d", res.StatusCode)
+	}
+
+	if res := pull(t, s, "library/alpine", "username", "password"); res.StatusCode != http.StatusOK {
+		t.Errorf("Expected the credentials to be accepted, got %d", res.StatusCode)
+	}
+}
+
+func TestTokensAreScopedToARepository(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	req, _ := http.NewRequest("HEAD", s.Registry.URL+"/v2/library/alpine/manifests/latest", nil)
+	req.Header.Set("Authorization", "Bearer "+scope("library/redis"))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected a token for another repository to be rejected, got %d", res.StatusCode)
+	}
+}
+
+func TestFailuresCanBeInjected(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.SetRegistryStatus(http.StatusTooManyRequests)
+
+	res := pull(t, s, "library/alpine", "", "")
+	if res.StatusCode != http.StatusTooManyRequests || res.Header.Get("RateLimit-Remaining") == "" {
+		t.Errorf("Expected a 429 with rate limit headers, got %d %v", res.StatusCode, res.Header)
+	}
+
+	s.SetRegistryStatus(0)
+	s.SetAuthStatus(http.StatusServiceUnavailable)
+
+	if res := pull(t, s, "library/alpine", "", ""); res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected the auth server to fail, got %d", res.StatusCode)
+	}
+}
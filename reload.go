@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+var errNothingToReload = errors.New("the credentials weren't read from anywhere that can be reloaded")
+
+// reload reads the credentials again straight away, rather than waiting for the next check, so that
+// rotated credentials can be picked up without a restart, which would lose the Docker Hub tokens
+// and the derived counters. There's nothing to reload if w is nil.
+func (w *credentialsWatcher) reload() error {
+	if w == nil {
+		return errNothingToReload
+	}
+
+	return w.refresh()
+}
+
+// reloadOnSIGHUP reloads w whenever the process gets a SIGHUP, forever.
+func reloadOnSIGHUP(w *credentialsWatcher) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for range hup {
+		if err := w.reload(); err != nil {
+			fmt.Printf("Unable to reload: %v\n", err)
+			continue
+		}
+
+		fmt.Println("Reloaded")
+	}
+}
+
+// reloadHandler reloads w on a POST, like Prometheus's /-/reload.
+func reloadHandler(w *credentialsWatcher) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodPut {
+			rw.Header().Set("Allow", "POST, PUT")
+			http.Error(rw, "Only POST or PUT requests allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := w.reload(); err != nil {
+			http.Error(rw, fmt.Sprintf("Failed to reload: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		fmt.Fprintln(rw, "Reloaded")
+	}
+}
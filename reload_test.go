@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestReloadingReadsTheCredentialsAgain(t *testing.T) {
+	f, err := ioutil.TempFile("", "config.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	write := func(password string) {
+		config := `{"auths":{"https://index.docker.io/v1/":{"username":"username","password":"` + password + `"}}}`
+
+		if err := ioutil.WriteFile(f.Name(), []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("password")
+
+	config := &dockerConfigFile{path: f.Name()}
+	c, version, err := config.read()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewExporter("http://localhost:0", "http://localhost:0", []string{defaultRepository}, c)
+	other := NewExporter("http://localhost:0", "http://localhost:0", []string{defaultRepository}, c)
+	watcher := &credentialsWatcher{exporter: e, others: []*Exporter{other}, source: config, version: version}
+
+	server := httptest.NewServer(reloadHandler(watcher))
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closeResponse(res.Body)
+
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("Expected GET to be refused, got HTTP status %d", res.StatusCode)
+	}
+
+	write("rotated")
+
+	res, err = http.Post(server.URL, "", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closeResponse(res.Body)
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected to reload, got HTTP status %d", res.StatusCode)
+	}
+
+	if current := e.currentCredentials(); current.passphrase != "rotated" {
+		t.Errorf("Expected the rotated credentials, got %+v", *current)
+	}
+
+	if current := other.currentCredentials(); current.passphrase != "rotated" {
+		t.Errorf("Expected the exporters sharing the credentials to get the rotated ones too, got %+v", *current)
+	}
+}
+
+func TestReloadingWithoutACredentialsSourceFails(t *testing.T) {
+	server := httptest.NewServer(reloadHandler(nil))
+	defer server.Close()
+
+	res, err := http.Post(server.URL, "", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closeResponse(res.Body)
+
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected reloading to fail, got HTTP status %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Defaults for the remote_write queue. A batch is about one push of a few repositories' metrics,
+// and the queue holds about an hour of pushes at the default interval.
+const (
+	defaultRemoteWriteBatchSize     = 500
+	defaultRemoteWriteQueueCapacity = 10000
+	remoteWriteMinBackoff           = time.Second
+	remoteWriteMaxBackoff           = time.Minute
+)
+
+// remoteWriter periodically gathers the metrics and pushes them to a Prometheus remote_write
+// endpoint, for when there's nothing to scrape the exporter. The samples are queued in memory, and
+// sent in batches by a separate goroutine, so that gathering carries on while the endpoint is down.
+// Failed batches are retried with exponential backoff, and once the queue is full, the oldest
+// samples are dropped to make room. Nothing is written to disk, so the queue is lost on restart.
+type remoteWriter struct {
+	url         string
+	username    string
+	password    string
+	bearerToken string
+	client      *http.Client
+	compress    bool
+	batchSize   int
+	capacity    int
+
+	gatherer prometheus.Gatherer
+
+	mu    sync.Mutex
+	queue []sample
+	head  uint64 // the sequence number of queue[0]
+	wake  chan struct{}
+
+	failures, retries, sent prometheus.Counter
+	dropped                 *prometheus.CounterVec
+	queueLength             prometheus.GaugeFunc
+	queueCapacity           prometheus.Gauge
+}
+
+// sample is a value of a series at a point in time, waiting to be sent.
+type sample struct {
+	timeSeries
+	timestamp int64 // milliseconds since the epoch
+}
+
+func newRemoteWriter(url string, gatherer prometheus.Gatherer, client *http.Client) *remoteWriter {
+	w := &remoteWriter{
+		url:       url,
+		client:    client,
+		batchSize: defaultRemoteWriteBatchSize,
+		capacity:  defaultRemoteWriteQueueCapacity,
+		gatherer:  gatherer,
+		wake:      make(chan struct{}, 1),
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exporter_remote_write_failures_total",
+			Help:      "Number of errors while pushing metrics to the remote_write endpoint.",
+		}),
+		retries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exporter_remote_write_retries_total",
+			Help:      "Number of times a batch of samples was retried after the remote_write endpoint failed.",
+		}),
+		sent: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exporter_remote_write_samples_sent_total",
+			Help:      "Number of samples sent to the remote_write endpoint.",
+		}),
+		dropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exporter_remote_write_samples_dropped_total",
+			Help:      "Number of samples dropped without being sent to the remote_write endpoint, because the queue was full or the endpoint rejected them.",
+		}, []string{"reason"}),
+		queueCapacity: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "exporter_remote_write_queue_capacity_samples",
+			Help:      "Number of samples the remote_write queue can hold.",
+		}),
+	}
+
+	w.queueLength = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "exporter_remote_write_queue_samples",
+		Help:      "Number of samples waiting to be sent to the remote_write endpoint.",
+	}, func() float64 {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		return float64(len(w.queue))
+	})
+
+	// Initialise every reason so that the series exist before the first drop
+	w.dropped.WithLabelValues(dropReasonQueueFull)
+	w.dropped.WithLabelValues(dropReasonRejected)
+
+	return w
+}
+
+// The reasons samples are dropped, used as the `reason` label on the dropped samples counter.
+const (
+	dropReasonQueueFull = "queue_full" // the queue was full, so the oldest samples made way
+	dropReasonRejected  = "rejected"   // the endpoint rejected them, so retrying wouldn't help
+)
+
+// Collect delivers the remote writer's own metrics. It implements prometheus.Collector.
+func (w *remoteWriter) Collect(ch chan<- prometheus.Metric) {
+	w.queueCapacity.Set(float64(w.capacity))
+
+	ch <- w.failures
+	ch <- w.retries
+	ch <- w.sent
+	w.dropped.Collect(ch)
+	ch <- w.queueLength
+	ch <- w.queueCapacity
+}
+
+// Describe describes the remote writer's own metrics. It implements prometheus.Collector.
+func (w *remoteWriter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- w.failures.Desc()
+	ch <- w.retries.Desc()
+	ch <- w.sent.Desc()
+	w.dropped.Describe(ch)
+	ch <- w.queueLength.Desc()
+	ch <- w.queueCapacity.Desc()
+}
+
+// run queues the metrics every interval, forever, while sending them in the background.
+func (w *remoteWriter) run(interval time.Duration) {
+	go w.send()
+
+	for now := range time.Tick(interval) {
+		w.enqueue(now)
+	}
+}
+
+// send sends the queued samples whenever there are some, backing off while the endpoint fails.
+func (w *remoteWriter) send() {
+	for range w.wake {
+		backoff := remoteWriteMinBackoff
+
+		for {
+			err := w.flush()
+
+			if err == nil {
+				break
+			}
+
+			fmt.Printf("remote_write: %+v\n", err)
+			w.failures.Inc()
+
+			// The rejected batch has been dropped, so carry on with the rest of the queue
+			if !isRetryable(err) {
+				continue
+			}
+
+			w.retries.Inc()
+			time.Sleep(backoff)
+
+			if backoff *= 2; backoff > remoteWriteMaxBackoff {
+				backoff = remoteWriteMaxBackoff
+			}
+		}
+	}
+}
+
+// push queues the metrics as samples at now, and sends everything in the queue.
+func (w *remoteWriter) push(now time.Time) error {
+	w.enqueue(now)
+
+	return w.flush()
+}
+
+// enqueue gathers the metrics and queues them as samples at now, dropping the oldest samples if
+// the queue would be over capacity.
+func (w *remoteWriter) enqueue(now time.Time) {
+	families, err := w.gatherer.Gather()
+
+	if err != nil {
+		// Gather can return the metrics it did manage to collect alongside an error
+		fmt.Printf("remote_write: %+v\n", err)
+	}
+
+	timestamp := now.UnixNano() / int64(time.Millisecond)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, s := range toTimeSeries(families) {
+		w.queue = append(w.queue, sample{timeSeries: s, timestamp: timestamp})
+	}
+
+	if over := len(w.queue) - w.capacity; over > 0 {
+		w.queue = w.queue[over:]
+		w.head += uint64(over)
+		w.dropped.WithLabelValues(dropReasonQueueFull).Add(float64(over))
+	}
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// flush sends the queued samples in batches, until the queue is empty or a batch fails. A batch
+// that fails in a way that retrying might fix is left at the front of the queue.
+func (w *remoteWriter) flush() error {
+	for {
+		w.mu.Lock()
+		batch := w.queue
+		if len(batch) > w.batchSize {
+			batch = batch[:w.batchSize]
+		}
+		end := w.head + uint64(len(batch))
+		w.mu.Unlock()
+
+		if len(batch) == 0 {
+			return nil
+		}
+
+		err := w.write(batch)
+
+		if err != nil && isRetryable(err) {
+			return err
+		}
+
+		// The oldest samples may have been dropped to make room while the batch was being sent
+		w.mu.Lock()
+		if end > w.head {
+			w.queue = w.queue[end-w.head:]
+			w.head = end
+		}
+		w.mu.Unlock()
+
+		if err != nil {
+			w.dropped.WithLabelValues(dropReasonRejected).Add(float64(len(batch)))
+			return err
+		}
+
+		w.sent.Add(float64(len(batch)))
+	}
+}
+
+// isRetryable returns whether a batch which failed with err might succeed if it were sent again.
+// Like Prometheus, only server errors, throttling and failing to reach the endpoint are retried.
+func isRetryable(err error) bool {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	return true
+}
+
+// write sends a batch of samples.
+func (w *remoteWriter) write(batch []sample) error {
+	var body []byte
+
+	if w.compress {
+		body = snappyCompress(encodeWriteRequest(batch))
+	} else {
+		body = snappyEncode(encodeWriteRequest(batch))
+	}
+
+	req, err := http.NewRequest("POST", w.url, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	if w.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+w.bearerToken)
+	} else if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+
+	res, err := fetchHTTP(context.Background(), w.client, req)
+
+	if err != nil {
+		return err
+	}
+
+	closeResponse(res.Body)
+
+	return nil
+}
+
+// timeSeries is a single series to write, with its labels sorted by name.
+type timeSeries struct {
+	labels []*dto.LabelPair
+	value  float64
+}
+
+// toTimeSeries flattens the metric families into series, in the same way the text exposition
+// format does, eg histograms become _bucket, _sum and _count series.
+func toTimeSeries(families []*dto.MetricFamily) []timeSeries {
+	var series []timeSeries
+
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			add := func(suffix string, value float64, extra ...*dto.LabelPair) {
+				name, n := "__name__", mf.GetName()+suffix
+				labels := append([]*dto.LabelPair{{Name: &name, Value: &n}}, m.GetLabel()...)
+				labels = append(labels, extra...)
+				sort.Slice(labels, func(i, j int) bool { return labels[i].GetName() < labels[j].GetName() })
+
+				series = append(series, timeSeries{labels: labels, value: value})
+			}
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add("", m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add("", m.GetGauge().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+
+				for _, b := range h.GetBucket() {
+					le, bound := "le", fmt.Sprint(b.GetUpperBound())
+					add("_bucket", float64(b.GetCumulativeCount()), &dto.LabelPair{Name: &le, Value: &bound})
+				}
+
+				le, inf := "le", "+Inf"
+				add("_bucket", float64(h.GetSampleCount()), &dto.LabelPair{Name: &le, Value: &inf})
+				add("_sum", h.GetSampleSum())
+				add("_count", float64(h.GetSampleCount()))
+			default:
+				add("", m.GetUntyped().GetValue())
+			}
+		}
+	}
+
+	return series
+}
+
+// encodeWriteRequest encodes the samples as a prometheus.WriteRequest protobuf message. It's small
+// enough to write out by hand, rather than taking on protobuf code generation.
+func encodeWriteRequest(samples []sample) []byte {
+	var req []byte
+
+	for _, s := range samples {
+		var ts []byte
+
+		for _, l := range s.labels {
+			var label []byte
+			label = appendBytesField(label, 1, []byte(l.GetName()))
+			label = appendBytesField(label, 2, []byte(l.GetValue()))
+			ts = appendBytesField(ts, 1, label)
+		}
+
+		var sample []byte
+		sample = append(sample, 1<<3|1) // field 1, 64-bit
+		sample = appendFixed64(sample, math.Float64bits(s.value))
+		sample = append(sample, 2<<3|0) // field 2, varint
+		sample = appendUvarint(sample, uint64(s.timestamp))
+		ts = appendBytesField(ts, 2, sample)
+
+		req = appendBytesField(req, 1, ts)
+	}
+
+	return req
+}
+
+func appendBytesField(b []byte, field int, value []byte) []byte {
+	b = appendUvarint(b, uint64(field<<3|2)) // length delimited
+	b = appendUvarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+func appendFixed64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// snappyEncode wraps src in the snappy block format that remote_write requires. It only uses
+// literals, so doesn't actually compress anything, but is valid for any snappy decoder.
+func snappyEncode(src []byte) []byte {
+	return appendSnappyLiteral(appendUvarint(nil, uint64(len(src))), src)
+}
+
+// snappyCompress is snappyEncode, but replaces repeats of earlier parts of src with copies of them,
+// which the labels repeated across series make worthwhile. It finds repeats with a simple lookup
+// of where each 4 bytes were last seen, which misses some, but never produces invalid output.
+func snappyCompress(src []byte) []byte {
+	dst := appendUvarint(nil, uint64(len(src)))
+	seen := map[uint32]int{}
+	literal := 0
+
+	for i := 0; i+4 <= len(src); {
+		key := binary.LittleEndian.Uint32(src[i:])
+		candidate, ok := seen[key]
+		seen[key] = i
+
+		// Copies can only reach back 64KiB with a 2 byte offset
+		if !ok || i-candidate >= 1<<16 {
+			i++
+			continue
+		}
+
+		n := 4
+		for i+n < len(src) && src[candidate+n] == src[i+n] {
+			n++
+		}
+
+		dst = appendSnappyLiteral(dst, src[literal:i])
+		dst = appendSnappyCopy(dst, i-candidate, n)
+
+		i += n
+		literal = i
+	}
+
+	return appendSnappyLiteral(dst, src[literal:])
+}
+
+func appendSnappyLiteral(dst []byte, src []byte) []byte {
+	for len(src) > 0 {
+		n := len(src)
+		if n > 1<<16 {
+			n = 1 << 16
+		}
+
+		if n <= 60 {
+			dst = append(dst, byte(n-1)<<2)
+		} else {
+			dst = append(dst, 61<<2, byte(n-1), byte((n-1)>>8)) // two byte length
+		}
+
+		dst = append(dst, src[:n]...)
+		src = src[n:]
+	}
+
+	return dst
+}
+
+// appendSnappyCopy appends copies of length bytes from offset bytes back, as copies with 2 byte
+// offsets, which are at most 64 bytes long.
+func appendSnappyCopy(dst []byte, offset int, length int) []byte {
+	for length > 0 {
+		n := length
+		if n > 64 {
+			n = 64
+		}
+
+		dst = append(dst, byte(n-1)<<2|2, byte(offset), byte(offset>>8))
+		length -= n
+	}
+
+	return dst
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// snappyDecode decodes the literal and copy elements written by snappyEncode and snappyCompress.
+func snappyDecode(t *testing.T, src []byte) []byte {
+	length, n := binary.Uvarint(src)
+	src = src[n:]
+
+	var dst []byte
+
+	for len(src) > 0 {
+		tag := src[0]
+		src = src[1:]
+
+		switch tag & 3 {
+		case 0:
+			size := int(tag>>2) + 1
+
+			switch tag >> 2 {
+			case 60:
+				size, src = int(src[0])+1, src[1:]
+			case 61:
+				size, src = int(binary.LittleEndian.Uint16(src))+1, src[2:]
+			}
+
+			dst = append(dst, src[:size]...)
+			src = src[size:]
+		case 2:
+			size, offset := int(tag>>2)+1, int(binary.LittleEndian.Uint16(src))
+			src = src[2:]
+
+			if offset == 0 || offset > len(dst) {
+				t.Fatalf("snappy copy from %d bytes back, with %d bytes decoded", offset, len(dst))
+			}
+
+			// Copies can overlap what they're copying, so go a byte at a time
+			for i := 0; i < size; i++ {
+				dst = append(dst, dst[len(dst)-offset])
+			}
+		default:
+			t.Fatalf("unexpected snappy element %x", tag)
+		}
+	}
+
+	if uint64(len(dst)) != length {
+		t.Fatalf("snappy block says %d bytes, got %d", length, len(dst))
+	}
+
+	return dst
+}
+
+// protoFields splits a protobuf message into its fields, keyed by field number.
+func protoFields(t *testing.T, b []byte) map[uint64][][]byte {
+	fields := map[uint64][][]byte{}
+
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		b = b[n:]
+
+		var value []byte
+
+		switch key & 7 {
+		case 0:
+			_, n = binary.Uvarint(b)
+			value, b = b[:n], b[n:]
+		case 1:
+			value, b = b[:8], b[8:]
+		case 2:
+			size, n := binary.Uvarint(b)
+			value, b = b[n:n+int(size)], b[n+int(size):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+
+		fields[key>>3] = append(fields[key>>3], value)
+	}
+
+	return fields
+}
+
+type decodedSample struct {
+	labels    map[string]string
+	value     float64
+	timestamp int64
+}
+
+func decodeWriteRequest(t *testing.T, b []byte) map[string]decodedSample {
+	samples := map[string]decodedSample{}
+
+	for _, ts := range protoFields(t, b)[1] {
+		fields := protoFields(t, ts)
+		s := decodedSample{labels: map[string]string{}}
+
+		for _, l := range fields[1] {
+			label := protoFields(t, l)
+			s.labels[string(label[1][0])] = string(label[2][0])
+		}
+
+		sample := protoFields(t, fields[2][0])
+		s.value = math.Float64frombits(binary.LittleEndian.Uint64(sample[1][0]))
+		timestamp, _ := binary.Uvarint(sample[2][0])
+		s.timestamp = int64(timestamp)
+
+		samples[s.labels["__name__"]] = s
+	}
+
+	return samples
+}
+
+func TestSnappyEncodeSplitsLongInput(t *testing.T) {
+	for _, size := range []int{0, 1, 60, 61, 1 << 16, 1<<16 + 1, 200000} {
+		src := []byte(strings.Repeat("x", size))
+
+		if got := snappyDecode(t, snappyEncode(src)); string(got) != string(src) {
+			t.Errorf("round trip of %d bytes gave %d bytes", size, len(got))
+		}
+	}
+}
+
+func TestSnappyCompressRoundTrips(t *testing.T) {
+	for _, src := range []string{
+		"",
+		"abc",
+		"abcdabcdabcdabcd",
+		strings.Repeat("dockerhub_limit_remaining_requests_total{repository=\"library/alpine\"} ", 1000),
+		strings.Repeat("x", 200000),
+	} {
+		compressed := snappyCompress([]byte(src))
+
+		if got := snappyDecode(t, compressed); string(got) != src {
+			t.Errorf("round trip of %d bytes gave %d bytes", len(src), len(got))
+		}
+
+		if len(src) > 1000 && len(compressed) > len(src)/10 {
+			t.Errorf("expected repetitive input to compress, got %d bytes from %d", len(compressed), len(src))
+		}
+	}
+}
+
+func TestMetricsArePushedToRemoteWrite(t *testing.T) {
+	var (
+		header http.Header
+		body   []byte
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	remaining := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "remaining_requests",
+		Help:      "test",
+	}, []string{"repository"})
+	remaining.WithLabelValues(defaultRepository).Set(42)
+	registry.MustRegister(remaining)
+
+	writer := newRemoteWriter(server.URL, registry, nil)
+	writer.bearerToken = "s3cret"
+
+	now := time.Unix(1605520800, 0)
+	if err := writer.push(now); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := header.Get("Authorization"); got != "Bearer s3cret" {
+		t.Errorf("expected bearer token, got %q", got)
+	}
+
+	if got := header.Get("Content-Encoding"); got != "snappy" {
+		t.Errorf("expected snappy encoding, got %q", got)
+	}
+
+	expected := map[string]decodedSample{
+		"dockerhub_remaining_requests": {
+			labels:    map[string]string{"__name__": "dockerhub_remaining_requests", "repository": defaultRepository},
+			value:     42,
+			timestamp: 1605520800000,
+		},
+	}
+
+	if got := decodeWriteRequest(t, snappyDecode(t, body)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestRemoteWriteAddsExternalAndGroupLabels(t *testing.T) {
+	var body []byte
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	remaining := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "remaining_requests",
+		Help:      "test",
+	}, []string{"repository"})
+	remaining.WithLabelValues(defaultRepository).Set(42)
+	registry.MustRegister(remaining)
+
+	args := lintArgs()
+	args.remoteWriteURL = server.URL
+	args.remoteWriteBatchSize = defaultRemoteWriteBatchSize
+	args.remoteWriteQueueCapacity = defaultRemoteWriteQueueCapacity
+	args.groupLabels[defaultRepository] = prometheus.Labels{"team": "platform"}
+	args.remoteWriteLabels = prometheus.Labels{"cluster": "eu-west-1", "team": "overridden"}
+
+	writer := args.newRemoteWriter(args.wrapGatherer(registry))
+
+	if err := writer.push(time.Unix(1605520800, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Like Prometheus's external labels, they don't replace the series' own labels
+	expected := map[string]string{
+		"__name__":   "dockerhub_remaining_requests",
+		"repository": defaultRepository,
+		"team":       "platform",
+		"cluster":    "eu-west-1",
+	}
+
+	if got := decodeWriteRequest(t, snappyDecode(t, body))["dockerhub_remaining_requests"].labels; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestRemoteWriteUsesBasicAuth(t *testing.T) {
+	server := httptest.NewServer(basicAuth(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	writer := newRemoteWriter(server.URL, remoteWriteRegistry(1), nil)
+	writer.username = "username"
+	writer.password = "password"
+
+	if err := writer.push(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemoteWriteRejectionIsAnError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	if err := newRemoteWriter(server.URL, remoteWriteRegistry(1), nil).push(time.Now()); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+// remoteWriteRegistry has a series for each of n repositories.
+func remoteWriteRegistry(n int) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	remaining := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "remaining_requests",
+		Help:      "test",
+	}, []string{"repository"})
+
+	for i := 0; i < n; i++ {
+		remaining.WithLabelValues(fmt.Sprintf("library/image-%d", i)).Set(float64(i))
+	}
+
+	registry.MustRegister(remaining)
+
+	return registry
+}
+
+func TestRemoteWriteSendsInBatches(t *testing.T) {
+	var batches []int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		batches = append(batches, len(protoFields(t, snappyDecode(t, body))[1]))
+	}))
+	defer server.Close()
+
+	writer := newRemoteWriter(server.URL, remoteWriteRegistry(5), nil)
+	writer.batchSize = 2
+	writer.compress = true
+
+	if err := writer.push(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(batches, []int{2, 2, 1}) {
+		t.Errorf("expected batches of 2, 2 and 1 samples, got %v", batches)
+	}
+
+	if sent := testutil.ToFloat64(writer.sent); sent != 5 {
+		t.Errorf("expected 5 samples sent, got %v", sent)
+	}
+}
+
+func TestRemoteWriteQueuesWhileTheEndpointIsDown(t *testing.T) {
+	status := http.StatusServiceUnavailable
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	writer := newRemoteWriter(server.URL, remoteWriteRegistry(3), nil)
+	writer.capacity = 7
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if err := writer.push(now.Add(time.Duration(i) * time.Minute)); err == nil || !isRetryable(err) {
+			t.Fatalf("expected a retryable error, got %v", err)
+		}
+	}
+
+	if queued := testutil.ToFloat64(writer.queueLength); queued != 7 {
+		t.Errorf("expected the queue to be full with 7 samples, got %v", queued)
+	}
+
+	if dropped := testutil.ToFloat64(writer.dropped.WithLabelValues(dropReasonQueueFull)); dropped != 2 {
+		t.Errorf("expected the oldest 2 samples to be dropped, got %v", dropped)
+	}
+
+	status = http.StatusNoContent
+
+	if err := writer.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if sent, queued := testutil.ToFloat64(writer.sent), testutil.ToFloat64(writer.queueLength); sent != 7 || queued != 0 {
+		t.Errorf("expected the queue to be sent once the endpoint was back, got %v sent and %v queued", sent, queued)
+	}
+}
+
+func TestRemoteWriteDropsRejectedBatches(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	writer := newRemoteWriter(server.URL, remoteWriteRegistry(3), nil)
+
+	if err := writer.push(time.Now()); err == nil || isRetryable(err) {
+		t.Fatalf("expected an error which isn't retryable, got %v", err)
+	}
+
+	if dropped := testutil.ToFloat64(writer.dropped.WithLabelValues(dropReasonRejected)); dropped != 3 {
+		t.Errorf("expected 3 rejected samples to be dropped, got %v", dropped)
+	}
+
+	if queued := testutil.ToFloat64(writer.queueLength); queued != 0 {
+		t.Errorf("expected nothing to be left queued, got %v", queued)
+	}
+}
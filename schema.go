@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/common/version"
+)
+
+// How much a metric can be relied on. Stable metrics only change in a major release, while
+// experimental ones may be renamed, relabelled or removed in any release.
+const (
+	stabilityStable       = "stable"
+	stabilityExperimental = "experimental"
+)
+
+// experimentalMetrics are the metrics which aren't stable yet. Everything else is.
+var experimentalMetrics = map[string]bool{
+	"dockerhub_limit_consumed_requests_per_second":           true,
+	"dockerhub_limit_estimated_exhaustion_timestamp_seconds": true,
+	"dockerhub_exporter_probe_cost_requests":                 true,
+	"dockerhub_ratelimit_source_info":                        true,
+	"dockerhub_canary_polls_total":                           true,
+	"dockerhub_exporter_oversized_responses_total":           true,
+	"dockerhub_window_consumed_requests":                     true,
+	"dockerhub_window_min_remaining_requests":                true,
+	"dockerhub_window_low_seconds":                           true,
+	"dockerhub_window_end_timestamp_seconds":                 true,
+}
+
+// metricsSchema is what /schema says about the metrics, for tools which check dashboards and alerts
+// against the version of the exporter that is running.
+type metricsSchema struct {
+	Version string         `json:"version"`
+	Metrics []metricSchema `json:"metrics"`
+}
+
+type metricSchema struct {
+	Name      string   `json:"name"`
+	Help      string   `json:"help"`
+	Type      string   `json:"type"`
+	Labels    []string `json:"labels"`
+	Stability string   `json:"stability"`
+}
+
+// buildSchema describes the metrics that the exporter configured by args exports about Docker Hub,
+// from what it exports when polling a fake one.
+func buildSchema(args *arguments) (*metricsSchema, error) {
+	families, err := gatherFromFakeHub(args)
+
+	if err != nil {
+		return nil, err
+	}
+
+	schema := &metricsSchema{Version: version.Version, Metrics: []metricSchema{}}
+
+	experimental := map[string]bool{}
+	for name := range experimentalMetrics {
+		experimental[inNamespace(name, args.metricsNamespace)] = true
+	}
+
+	for _, mf := range families {
+		labels := map[string]bool{}
+
+		for _, m := range mf.Metric {
+			for _, l := range m.Label {
+				labels[l.GetName()] = true
+			}
+		}
+
+		metric := metricSchema{
+			Name:      mf.GetName(),
+			Help:      mf.GetHelp(),
+			Type:      strings.ToLower(mf.GetType().String()),
+			Labels:    []string{},
+			Stability: stabilityStable,
+		}
+
+		for l := range labels {
+			metric.Labels = append(metric.Labels, l)
+		}
+
+		sort.Strings(metric.Labels)
+
+		if experimental[metric.Name] {
+			metric.Stability = stabilityExperimental
+		}
+
+		schema.Metrics = append(schema.Metrics, metric)
+	}
+
+	sort.Slice(schema.Metrics, func(i, j int) bool { return schema.Metrics[i].Name < schema.Metrics[j].Name })
+
+	return schema, nil
+}
+
+// schemaHandler serves the schema for the exporter configured by args. It's only built on the first
+// request, rather than when the exporter starts, as it polls a fake Docker Hub.
+func schemaHandler(args *arguments) http.HandlerFunc {
+	var once sync.Once
+	var schema *metricsSchema
+	var err error
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() { schema, err = buildSchema(args) })
+
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Unable to describe the metrics: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(schema)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSchemaDescribesEachMetric(t *testing.T) {
+	server := httptest.NewServer(schemaHandler(lintArgs()))
+	defer server.Close()
+
+	res, err := server.Client().Get(server.URL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer closeResponse(res.Body)
+
+	var served metricsSchema
+	if err := json.NewDecoder(res.Body).Decode(&served); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := map[string]metricSchema{}
+	for _, m := range served.Metrics {
+		metrics[m.Name] = m
+	}
+
+	expected := metricSchema{
+		Name:      "dockerhub_limit_remaining_requests_total",
+		Help:      "Docker Hub Rate Limit Remaining Requests",
+		Type:      "gauge",
+		Labels:    []string{"repository"},
+		Stability: stabilityStable,
+	}
+
+	if actual := metrics[expected.Name]; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, actual)
+	}
+
+	if stability := metrics["dockerhub_ratelimit_source_info"].Stability; stability != stabilityExperimental {
+		t.Errorf("Expected the source info to be experimental, got %q", stability)
+	}
+}
+
+func TestSchemaSharesNothingWithTheRealExporter(t *testing.T) {
+	args := lintArgs()
+	args.credentials = &credentials{username: "user", passphrase: "secret"}
+	args.clientMetrics = newClientMetrics()
+	args.tokens = newTokenGroup()
+	args.scrapeDeadlines = &scrapeDeadlines{}
+
+	if _, err := buildSchema(args); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := testutil.CollectAndCount(args.clientMetrics, "dockerhub_exporter_client_request_duration_seconds"); count != 0 {
+		t.Errorf("Expected the fake polls not to be in the client metrics, got %d series", count)
+	}
+
+	if len(args.tokens.latest) != 0 {
+		t.Errorf("Expected the fake tokens not to be shared, got %v", args.tokens.latest)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// scrapeTimeoutHeader is how Prometheus tells targets how long it will wait for a scrape.
+	scrapeTimeoutHeader = "X-Prometheus-Scrape-Timeout-Seconds"
+
+	defaultScrapeTimeoutOffset = 500 * time.Millisecond
+)
+
+// phasePoll is the whole of a poll of Docker Hub, which is skipped or abandoned when the scrape
+// which triggered it is about to time out.
+const phasePoll = "poll"
+
+// scrapeDeadlines are the deadlines of the scrapes in progress, from their scrape timeout headers,
+// shared by the exporters which they collect from. A nil *scrapeDeadlines has none.
+type scrapeDeadlines struct {
+	mu        sync.Mutex
+	next      int
+	deadlines map[int]time.Time
+}
+
+// add adds a deadline until the returned function is called.
+func (d *scrapeDeadlines) add(deadline time.Time) (remove func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.deadlines == nil {
+		d.deadlines = map[int]time.Time{}
+	}
+
+	id := d.next
+	d.next++
+	d.deadlines[id] = deadline
+
+	return func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		delete(d.deadlines, id)
+	}
+}
+
+// earliest returns the earliest deadline of the scrapes in progress, since a collect may be for
+// any of them, or false if none of them have one.
+func (d *scrapeDeadlines) earliest() (time.Time, bool) {
+	if d == nil {
+		return time.Time{}, false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var earliest time.Time
+
+	for _, deadline := range d.deadlines {
+		if earliest.IsZero() || deadline.Before(earliest) {
+			earliest = deadline
+		}
+	}
+
+	return earliest, !earliest.IsZero()
+}
+
+// context returns a context for polling Docker Hub during a collect, which ends at the earliest
+// deadline of the scrapes in progress.
+func (d *scrapeDeadlines) context() (context.Context, context.CancelFunc) {
+	if deadline, ok := d.earliest(); ok {
+		return context.WithDeadline(context.Background(), deadline)
+	}
+
+	return context.WithCancel(context.Background())
+}
+
+// scrapeTimeoutHandler adds the deadline from each scrape's timeout header to deadlines, less
+// offset for the time taken to send the response, while next handles it. Polls which would
+// overrun the deadline are cut short, so that Prometheus gets the last values for those
+// repositories rather than timing out and getting nothing.
+func scrapeTimeoutHandler(deadlines *scrapeDeadlines, offset time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seconds, err := strconv.ParseFloat(r.Header.Get(scrapeTimeoutHeader), 64)
+
+		if err == nil && seconds > 0 {
+			timeout := time.Duration(seconds*float64(time.Second)) - offset
+			defer deadlines.add(time.Now().Add(timeout))()
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
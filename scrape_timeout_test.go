@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSlowPollsAreCutShortAtTheScrapeTimeout(t *testing.T) {
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(registrytest.TokenResponse("token", time.Now()))
+	}))
+	defer auth.Close()
+
+	var slow int32
+
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "library/alpine") && atomic.LoadInt32(&slow) == 1 {
+			time.Sleep(500 * time.Millisecond)
+		}
+
+		w.Header().Set("RateLimit-Limit", "100;w=21600")
+		w.Header().Set("RateLimit-Remaining", "76;w=21600")
+	}))
+	defer registry.Close()
+
+	e := NewExporter(auth.URL, registry.URL, []string{"library/alpine", defaultRepository}, nil)
+	e.deadlines = &scrapeDeadlines{}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(e)
+
+	server := httptest.NewServer(scrapeTimeoutHandler(e.deadlines, 100*time.Millisecond, promhttp.HandlerFor(reg, promhttp.HandlerOpts{})))
+	defer server.Close()
+
+	scrape := func() {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		req.Header.Set(scrapeTimeoutHeader, "0.3")
+
+		start := time.Now()
+		res, err := http.DefaultClient.Do(req)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		closeResponse(res.Body)
+
+		if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+			t.Errorf("Expected the scrape to finish within its timeout, took %v", elapsed)
+		}
+	}
+
+	scrape()
+	atomic.StoreInt32(&slow, 1)
+	scrape()
+
+	if skips := testutil.ToFloat64(e.budgetSkips.WithLabelValues(phasePoll)); skips != 2 {
+		t.Errorf("Expected the slow poll and the one after it to be skipped, got %v", skips)
+	}
+
+	for _, reason := range failureReasons {
+		if failures := testutil.ToFloat64(e.scrapeFailures.WithLabelValues(reason)); failures != 0 {
+			t.Errorf("Expected a skip not to count as a %s failure, got %v", reason, failures)
+		}
+	}
+
+	if remaining := testutil.ToFloat64(e.remaining.WithLabelValues("library/alpine")); remaining != 76 {
+		t.Errorf("Expected the last remaining to be kept, got %v", remaining)
+	}
+}
+
+func TestTheEarliestScrapeDeadlineApplies(t *testing.T) {
+	var d *scrapeDeadlines
+
+	if _, ok := d.earliest(); ok {
+		t.Fatal("Expected no deadline without any scrapes")
+	}
+
+	d = &scrapeDeadlines{}
+	now := time.Now()
+
+	removeLater := d.add(now.Add(10 * time.Second))
+	removeSooner := d.add(now.Add(time.Second))
+
+	if deadline, _ := d.earliest(); !deadline.Equal(now.Add(time.Second)) {
+		t.Errorf("Expected the sooner deadline, got %v", deadline)
+	}
+
+	removeSooner()
+
+	if deadline, _ := d.earliest(); !deadline.Equal(now.Add(10 * time.Second)) {
+		t.Errorf("Expected the later deadline once the sooner scrape finished, got %v", deadline)
+	}
+
+	removeLater()
+
+	if _, ok := d.earliest(); ok {
+		t.Error("Expected no deadline once the scrapes finished")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultWatchdogTimeout is how long a poll of Docker Hub can take before the watchdog cancels it,
+// well beyond the time limits for each request.
+const defaultWatchdogTimeout = time.Minute
+
+// sharedPoll lets concurrent collects share one poll of Docker Hub, eg when a pair of Prometheus
+// servers scrape the exporter at the same time, rather than each polling in turn.
+//
+// It also has a watchdog, so that a poll which is wedged, eg on a connection which the request
+// timeouts don't cover, doesn't hold up every scrape after it. A poll which takes longer than
+// timeout is cancelled, recovered is called, and the collects waiting for it carry on with the
+// last values, so that the next one polls afresh. Since Docker Hub is polled outside the exporter's
+// lock, that's so even if the request doesn't honour the cancellation, and carries on regardless.
+type sharedPoll struct {
+	mu      sync.Mutex
+	current *pollInProgress // nil if there isn't a poll in progress
+
+	timeout   time.Duration // zero for no watchdog
+	recovered func()
+}
+
+// pollInProgress is a poll that collects are waiting for. It isn't cancelled when one of them gives
+// up on it, only once the last of their deadlines has passed, so that a scrape with a short
+// timeout, or one which is cancelled, doesn't cut the poll short for the others.
+type pollInProgress struct {
+	done     chan struct{} // closed when the poll finishes
+	deadline time.Time     // the latest of the waiters' deadlines
+	timer    *time.Timer   // which cancels the poll at deadline, nil if a waiter has no deadline
+}
+
+// wait extends the poll to the deadline of ctx, if that's later. The caller must hold the
+// sharedPoll's mu.
+func (p *pollInProgress) wait(ctx context.Context) {
+	if p.timer == nil {
+		return
+	}
+
+	deadline, ok := ctx.Deadline()
+
+	if !ok {
+		p.timer.Stop()
+		p.timer = nil
+		return
+	}
+
+	if deadline.After(p.deadline) {
+		p.deadline = deadline
+		p.timer.Reset(time.Until(deadline))
+	}
+}
+
+// do calls poll, unless a poll is already in progress, in which case it waits for that one to
+// finish instead. Either way, it returns early if ctx is done, or the watchdog gives up on the poll.
+// poll runs on its own goroutine, so that a wedged one can be left behind, with a context of its
+// own which ends at the latest deadline of the collects waiting for it.
+func (p *sharedPoll) do(ctx context.Context, poll func(ctx context.Context)) {
+	p.mu.Lock()
+	current := p.current
+
+	if current == nil {
+		pollCtx, cancel := context.WithCancel(context.Background())
+		current = &pollInProgress{done: make(chan struct{})}
+
+		if deadline, ok := ctx.Deadline(); ok {
+			current.deadline = deadline
+			current.timer = time.AfterFunc(time.Until(deadline), cancel)
+		}
+
+		p.current = current
+		go p.run(pollCtx, cancel, current, poll)
+	} else {
+		current.wait(ctx)
+	}
+
+	p.mu.Unlock()
+
+	select {
+	case <-current.done:
+	case <-ctx.Done():
+	}
+}
+
+// run calls poll, and closes current.done when it finishes, or when the watchdog gives up on it.
+func (p *sharedPoll) run(ctx context.Context, cancel context.CancelFunc, current *pollInProgress, poll func(ctx context.Context)) {
+	// A wedged poll may finish after the watchdog has let another one start
+	finish := func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		if p.current == current {
+			p.current = nil
+			close(current.done)
+
+			if current.timer != nil {
+				current.timer.Stop()
+			}
+		}
+	}
+
+	defer cancel()
+	defer finish()
+
+	if p.timeout > 0 {
+		watchdog := time.AfterFunc(p.timeout, func() {
+			fmt.Printf("Polling Docker Hub has taken more than %v, cancelling it\n", p.timeout)
+			cancel()
+			finish()
+
+			if p.recovered != nil {
+				p.recovered()
+			}
+		})
+		defer watchdog.Stop()
+	}
+
+	poll(ctx)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestConcurrentCollectsShareOnePoll(t *testing.T) {
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(registrytest.TokenResponse("token", time.Now()))
+	}))
+	defer auth.Close()
+
+	var requests int32
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		started <- struct{}{}
+		<-release
+
+		w.Header().Set("RateLimit-Limit", "100;w=21600")
+		w.Header().Set("RateLimit-Remaining", "76;w=21600")
+	}))
+	defer registry.Close()
+
+	e := NewExporter(auth.URL, registry.URL, []string{defaultRepository}, nil)
+
+	var wg sync.WaitGroup
+	collect := func() {
+		defer wg.Done()
+
+		ch := make(chan prometheus.Metric)
+		go func() {
+			e.Collect(ch)
+			close(ch)
+		}()
+
+		for range ch {
+		}
+	}
+
+	wg.Add(2)
+	go collect()
+	<-started
+
+	go collect()
+
+	// Give the second collect time to join the poll in progress
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("Expected the collects to share 1 request to Docker Hub, got %d", n)
+	}
+}
+
+func TestTheWatchdogCancelsAWedgedPoll(t *testing.T) {
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(registrytest.TokenResponse("token", time.Now()))
+	}))
+	defer auth.Close()
+
+	var requests int32
+
+	// Never responds, until the exporter gives up on the request
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-r.Context().Done()
+	}))
+	defer registry.Close()
+
+	e := NewExporter(auth.URL, registry.URL, []string{defaultRepository}, nil)
+	e.client = &http.Client{}
+	e.polls.timeout = 50 * time.Millisecond
+
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		testutil.CollectAndCount(e)
+
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("Expected the watchdog to cancel the poll, took %v", elapsed)
+		}
+	}
+
+	if recoveries := testutil.ToFloat64(e.watchdogRecoveries); recoveries != 2 {
+		t.Errorf("Expected 2 recoveries, got %v", recoveries)
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("Expected each collect to poll afresh, got %d requests", n)
+	}
+}
+
+// wedgedTransport never responds, and ignores the request's context, as a transport stuck in a
+// read without a deadline would.
+type wedgedTransport struct {
+	release chan struct{}
+}
+
+func (w wedgedTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	<-w.release
+	return nil, errors.New("released")
+}
+
+func TestCollectsCarryOnWhileAPollIgnoringCancellationIsWedged(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	e := NewExporter("http://auth.invalid/token", "http://registry.invalid", []string{defaultRepository}, nil)
+	e.client = &http.Client{Transport: wedgedTransport{release: release}}
+	e.polls.timeout = 50 * time.Millisecond
+
+	for i := 0; i < 2; i++ {
+		done := make(chan struct{})
+
+		go func() {
+			testutil.CollectAndCount(e)
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected collect %d to return once the watchdog fired", i+1)
+		}
+	}
+
+	if statuses := e.status(); len(statuses) != 1 {
+		t.Errorf("Expected the status of 1 repository while polls are wedged, got %d", len(statuses))
+	}
+}
+
+func TestASharedPollOutlastsTheCollectWhichStartedIt(t *testing.T) {
+	var p sharedPoll
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	result := make(chan error, 1)
+
+	short, cancelShort := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelShort()
+
+	go p.do(short, func(ctx context.Context) {
+		close(started)
+
+		select {
+		case <-release:
+			result <- nil
+		case <-ctx.Done():
+			result <- ctx.Err()
+		}
+	})
+
+	<-started
+
+	long, cancelLong := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelLong()
+
+	finished := make(chan struct{})
+	go func() {
+		p.do(long, func(context.Context) { t.Error("Expected to wait for the poll in progress") })
+		close(finished)
+	}()
+
+	// Once the second collect has joined the poll, the first one gives up on it
+	deadline, _ := long.Deadline()
+	for joined := false; !joined; time.Sleep(time.Millisecond) {
+		p.mu.Lock()
+		joined = p.current != nil && p.current.deadline.Equal(deadline)
+		p.mu.Unlock()
+	}
+
+	<-short.Done()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	<-finished
+
+	if err := <-result; err != nil {
+		t.Errorf("Expected the poll to carry on for the collect still waiting, got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// socketOptions are set on the sockets used to talk to Docker Hub. Support for them depends on the
+// platform, see sockopt_linux.go and sockopt_other.go.
+type socketOptions struct {
+	mark   int    // SO_MARK, for policy routing
+	device string // SO_BINDTODEVICE, for multi-homed hosts
+	source string // the local address to connect from, empty for any
+	family string // tcp4 or tcp6 to only connect over IPv4 or IPv6, empty for either
+}
+
+func (o socketOptions) isZero() bool {
+	return o == socketOptions{}
+}
+
+// dialer returns a net.Dialer which sets the socket options on each connection.
+func (o socketOptions) dialer() *net.Dialer {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   o.control,
+	}
+
+	if o.source != "" {
+		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(o.source)}
+	}
+
+	return dialer
+}
+
+// check sets the socket options on a throwaway socket, so that a lack of support or permission, or
+// a source address which isn't one of the host's, is reported at startup rather than on every poll.
+func (o socketOptions) check() error {
+	address := "127.0.0.1"
+	if o.source != "" {
+		address = o.source
+	}
+
+	lc := net.ListenConfig{Control: o.control}
+	conn, err := lc.ListenPacket(context.Background(), "udp", net.JoinHostPort(address, "0"))
+
+	if err != nil {
+		return fmt.Errorf("unable to set socket options: %v", err)
+	}
+
+	return conn.Close()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+func (o socketOptions) control(network, address string, c syscall.RawConn) error {
+	var err error
+
+	controlErr := c.Control(func(fd uintptr) {
+		if o.mark != 0 {
+			err = setsockopt(fd, syscall.SO_MARK, o.mark, "SO_MARK")
+		}
+
+		if err == nil && o.device != "" {
+			err = bindToDevice(fd, o.device)
+		}
+	})
+
+	if controlErr != nil {
+		return controlErr
+	}
+
+	return err
+}
+
+func setsockopt(fd uintptr, opt int, value int, name string) error {
+	err := syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, opt, value)
+
+	if errors.Is(err, syscall.EPERM) {
+		return fmt.Errorf("setting %s needs the CAP_NET_ADMIN capability: %w", name, err)
+	}
+
+	if err != nil {
+		return fmt.Errorf("setting %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func bindToDevice(fd uintptr, device string) error {
+	err := syscall.BindToDevice(int(fd), device)
+
+	if errors.Is(err, syscall.EPERM) {
+		return fmt.Errorf("setting SO_BINDTODEVICE needs the CAP_NET_RAW capability: %w", err)
+	}
+
+	if errors.Is(err, syscall.ENODEV) {
+		return fmt.Errorf("setting SO_BINDTODEVICE: no network interface named %q", device)
+	}
+
+	if err != nil {
+		return fmt.Errorf("setting SO_BINDTODEVICE: %w", err)
+	}
+
+	return nil
+}
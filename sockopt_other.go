@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+func (o socketOptions) control(network, address string, c syscall.RawConn) error {
+	if o.mark != 0 {
+		return errors.New("SO_MARK is only supported on Linux")
+	}
+
+	if o.device != "" {
+		return errors.New("SO_BINDTODEVICE is only supported on Linux")
+	}
+
+	return nil
+}
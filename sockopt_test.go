@@ -0,0 +1,15 @@
+package main
+
+import "testing"
+
+func TestNoSocketOptionsAreAlwaysSupported(t *testing.T) {
+	if err := (socketOptions{}).check(); err != nil {
+		t.Fatalf("Expected no socket options to be supported: %v", err)
+	}
+}
+
+func TestBindingToAMissingDeviceFails(t *testing.T) {
+	if err := (socketOptions{device: "no-such-device0"}).check(); err == nil {
+		t.Fatal("Expected binding to a missing device to fail")
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+// observeSource exports the IP address that Docker Hub counted t's requests against as an info
+// metric, rather than as a label on the rate limit metrics, so that an egress IP which changes
+// often doesn't churn their series. The series for the previous address is removed.
+func (e *Exporter) observeSource(t *target, source string) {
+	if source != t.sourceIP && t.sourceIP != "" {
+		e.sourceInfo.DeleteLabelValues(t.repository, t.sourceIP)
+	}
+
+	if source != "" {
+		e.sourceInfo.WithLabelValues(t.repository, source).Set(1)
+	}
+
+	t.sourceIP = source
+}
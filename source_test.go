@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSourceInfoFollowsTheLatestAddress(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+
+	for _, source := range []string{"192.0.2.1", "192.0.2.2"} {
+		hub.SetSource(source)
+		e.scrape(context.Background(), e.targets[0], time.Now())
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(e.sourceInfo)
+
+	expected := `
+# HELP dockerhub_ratelimit_source_info The IP address which Docker Hub counts the requests about each repository against, from the Docker-RateLimit-Source header.
+# TYPE dockerhub_ratelimit_source_info gauge
+dockerhub_ratelimit_source_info{repository="ratelimitpreview/test",source_ip="192.0.2.2"} 1
+`
+
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+
+	hub.SetSource("")
+	e.scrape(context.Background(), e.targets[0], time.Now())
+
+	if count := testutil.CollectAndCount(e.sourceInfo); count != 0 {
+		t.Errorf("Expected no source info without the header, got %d series", count)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// sourcePool polls Docker Hub anonymously from each of a pool of local source addresses in turn,
+// one per gather, so that one exporter can sample the anonymous rate limit of several egress IPs,
+// eg behind different NAT gateways. Each address has its own exporter, whose series are labelled
+// with source_address, and those whose turn it isn't carry on exporting their last values.
+//
+// The extra addresses of -source-address are a pool too, but one which polls from every address on
+// each gather, with the exporter's credentials.
+type sourcePool struct {
+	mu      sync.Mutex
+	next    int
+	all     bool // whether every address is due on each gather, rather than one in turn
+	members []*sourceMember
+}
+
+type sourceMember struct {
+	address  string
+	due      bool
+	exporter *Exporter
+	registry *prometheus.Registry
+}
+
+// parseSourceAddress checks that a -source-address or -anonymous-source-address flag is an IP
+// address.
+func parseSourceAddress(flag string) (string, error) {
+	ip := net.ParseIP(flag)
+
+	if ip == nil {
+		return "", fmt.Errorf("source address %q isn't an IP address", flag)
+	}
+
+	return ip.String(), nil
+}
+
+// newSourcePool returns a pool of the exporters returned by newExporter for each of addresses.
+func newSourcePool(addresses []string, newExporter func(address string) *Exporter) (*sourcePool, error) {
+	p := &sourcePool{}
+
+	for _, address := range addresses {
+		e := newExporter(address)
+		m := &sourceMember{address: address, exporter: e, registry: prometheus.NewRegistry()}
+		e.turn = func() bool { return m.due }
+
+		reg := prometheus.WrapRegistererWith(prometheus.Labels{"source_address": address}, m.registry)
+
+		if err := reg.Register(e); err != nil {
+			return nil, err
+		}
+
+		p.members = append(p.members, m)
+	}
+
+	return p, nil
+}
+
+// exporters returns the exporter for each address in the pool.
+func (p *sourcePool) exporters() []*Exporter {
+	exporters := make([]*Exporter, 0, len(p.members))
+
+	for _, m := range p.members {
+		exporters = append(exporters, m.exporter)
+	}
+
+	return exporters
+}
+
+// Gather polls from the next address in the pool, or all of them, and gathers from all of them. It
+// implements prometheus.Gatherer.
+func (p *sourcePool) Gather() ([]*dto.MetricFamily, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	gatherers := prometheus.Gatherers{}
+
+	for i, m := range p.members {
+		m.due = p.all || i == p.next
+		gatherers = append(gatherers, m.registry)
+	}
+
+	p.next = (p.next + 1) % len(p.members)
+
+	return gatherers.Gather()
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSourcePoolPollsFromOneAddressPerGather(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	addresses := []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}
+	exporters := map[string]*Exporter{}
+
+	pool, err := newSourcePool(addresses, func(address string) *Exporter {
+		exporters[address] = NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+		return exporters[address]
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if _, err := pool.Gather(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for address, expected := range map[string]float64{"192.0.2.1": 2, "192.0.2.2": 1, "192.0.2.3": 1} {
+		if polls := testutil.ToFloat64(exporters[address].totalScrapes); polls != expected {
+			t.Errorf("Expected %v polls from %s, got %v", expected, address, polls)
+		}
+	}
+
+	families, err := pool.Gather()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+
+	for _, mf := range families {
+		if mf.GetName() != "dockerhub_limit_remaining_requests_total" {
+			continue
+		}
+
+		for _, m := range mf.Metric {
+			for _, l := range m.Label {
+				if l.GetName() == "source_address" {
+					seen[l.GetValue()] = true
+				}
+			}
+		}
+	}
+
+	if len(seen) != len(addresses) {
+		t.Errorf("Expected the remaining requests from each address, got %v", seen)
+	}
+}
+
+func TestSourceSetPollsFromEveryAddressWithTheCredentials(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	hub.SetCredentials("username", "password")
+
+	args := lintArgs()
+	args.authServerURL = hub.Auth.URL
+	args.registryURL = hub.Registry.URL
+	args.credentials = &credentials{username: "username", passphrase: "password"}
+
+	// The first address is the main exporter's, so the set only has the loopback address
+	args.sourceAddresses = []string{"192.0.2.1", "127.0.0.1"}
+
+	sources, err := args.newSourceSet()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := sources.Gather(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exporters := sources.exporters()
+
+	if len(exporters) != 1 {
+		t.Fatalf("Expected an exporter for 127.0.0.1 only, got %d", len(exporters))
+	}
+
+	if polls := testutil.ToFloat64(exporters[0].totalScrapes); polls != 2 {
+		t.Errorf("Expected a poll on every gather, got %v", polls)
+	}
+
+	if ok := testutil.ToFloat64(exporters[0].lastScrapeSuccess.WithLabelValues(defaultRepository)); ok != 1 {
+		t.Error("Expected the polls to use the credentials")
+	}
+}
+
+func TestConnectionsAreMadeFromTheSourceAddress(t *testing.T) {
+	var remote string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remote, _, _ = net.SplitHostPort(r.RemoteAddr)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: phaseTimeouts{}.transport(socketOptions{source: "127.0.0.1"})}
+	res, err := client.Get(server.URL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closeResponse(res.Body)
+
+	if remote != "127.0.0.1" {
+		t.Errorf("Expected the connection to come from 127.0.0.1, got %s", remote)
+	}
+}
+
+func TestSourceAddressesMustBeLocalIPs(t *testing.T) {
+	if _, err := parseSourceAddress("egress-1"); err == nil {
+		t.Error("Expected a hostname to be rejected")
+	}
+
+	if address, err := parseSourceAddress("2001:db8::0001"); err != nil || address != "2001:db8::1" {
+		t.Errorf("Expected the address to be normalised, got %q: %v", address, err)
+	}
+
+	// 192.0.2.0/24 is reserved for documentation, so it won't be one of ours
+	if err := (socketOptions{source: "192.0.2.1"}).check(); err == nil {
+		t.Error("Expected an address which isn't the host's to be rejected")
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// standby keeps an exporter's derived counters and consumption estimates in step with a peer's,
+// from the peer's /api/v1/history, so that failing over from the peer to it doesn't start them
+// again from zero.
+type standby struct {
+	url      string
+	exporter *Exporter
+	failures prometheus.Counter
+}
+
+func newStandby(peerURL string, e *Exporter) *standby {
+	return &standby{
+		url:      strings.TrimRight(peerURL, "/") + "/api/v1/history",
+		exporter: e,
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exporter_standby_sync_failures_total",
+			Help:      "Number of errors while reading the history from the -standby-of peer.",
+		}),
+	}
+}
+
+// run syncs with the peer straight away, and then every interval, forever.
+func (s *standby) run(interval time.Duration) {
+	s.syncOrLog()
+
+	for range time.Tick(interval) {
+		s.syncOrLog()
+	}
+}
+
+func (s *standby) syncOrLog() {
+	if err := s.sync(); err != nil {
+		fmt.Printf("Unable to sync with %s: %v\n", s.url, err)
+		s.failures.Inc()
+	}
+}
+
+// sync reads the peer's history, and catches the exporter up with it.
+func (s *standby) sync() error {
+	req, err := http.NewRequest("GET", s.url, nil)
+
+	if err != nil {
+		return err
+	}
+
+	res, err := fetchHTTP(context.Background(), s.exporter.client, req)
+
+	if err != nil {
+		return err
+	}
+
+	defer closeResponse(res.Body)
+
+	var state persistedState
+
+	if err := json.NewDecoder(res.Body).Decode(&state); err != nil {
+		return err
+	}
+
+	s.exporter.lock()
+	defer s.exporter.mu.Unlock()
+
+	s.exporter.mergeState(&state, true)
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestStandbyKeepsInStepWithItsPeer(t *testing.T) {
+	authServer := httptest.NewServer(handler(&mockResponse{
+		response: authResponseBody(),
+	}))
+	defer authServer.Close()
+
+	remaining := 0
+	rateLimitServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("RateLimit-Limit", "100;w=21600")
+		w.Header().Set("RateLimit-Remaining", fmt.Sprintf("%d;w=21600", remaining))
+	}))
+	defer rateLimitServer.Close()
+
+	started, _ := time.Parse(time.RFC3339, "2020-11-16T10:00:00Z")
+
+	primary := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository}, nil)
+	for i, r := range []int{90, 80, 70} {
+		remaining = r
+		primary.scrape(context.Background(), primary.targets[0], started.Add(time.Duration(i)*time.Minute))
+	}
+
+	peer := httptest.NewServer(historyHandler(primary))
+	defer peer.Close()
+
+	secondary := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository}, nil)
+	standby := newStandby(peer.URL, secondary)
+
+	// Syncing more than once mustn't count the same consumption twice
+	for i := 0; i < 2; i++ {
+		if err := standby.sync(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if pulls := testutil.ToFloat64(secondary.pullsConsumed.WithLabelValues(defaultRepository)); pulls != 20 {
+		t.Errorf("Expected the peer's 20 pulls consumed, got %v", pulls)
+	}
+
+	if rate := secondary.targets[0].burnRate; rate != primary.targets[0].burnRate || rate <= 0 {
+		t.Errorf("Expected the peer's consumption rate of %v, got %v", primary.targets[0].burnRate, rate)
+	}
+
+	// After failing over, the standby carries on from where the peer left off
+	remaining = 65
+	secondary.scrape(context.Background(), secondary.targets[0], started.Add(3*time.Minute))
+
+	if pulls := testutil.ToFloat64(secondary.pullsConsumed.WithLabelValues(defaultRepository)); pulls != 25 {
+		t.Errorf("Expected pulls consumed to carry on from 20 to 25, got %v", pulls)
+	}
+}
+
+func TestStandbyCountsFailuresToSync(t *testing.T) {
+	peer := httptest.NewServer(http.NotFoundHandler())
+	defer peer.Close()
+
+	standby := newStandby(peer.URL, NewExporter(peer.URL, peer.URL, []string{defaultRepository}, nil))
+	standby.syncOrLog()
+
+	if failures := testutil.ToFloat64(standby.failures); failures != 1 {
+		t.Errorf("Expected 1 failure, got %v", failures)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// persistedState is what -state-file keeps across restarts, so that the counters derived from
+// successive polls carry on from where they left off instead of starting again from zero. It is
+// also what /api/v1/history serves to a standby.
+type persistedState struct {
+	Targets map[string]*persistedTarget `json:"targets"`
+}
+
+type persistedTarget struct {
+	LastRemaining   *float64             `json:"last_remaining,omitempty"`
+	LastRemainingAt *time.Time           `json:"last_remaining_at,omitempty"`
+	BurnRate        float64              `json:"burn_rate,omitempty"`
+	PullsConsumed   float64              `json:"pulls_consumed,omitempty"`
+	Consumed        map[string]float64   `json:"consumed,omitempty"`
+	ConsumedCreated map[string]time.Time `json:"consumed_created,omitempty"`
+}
+
+// loadState restores the state saved in path, if there is any, and saves to it from then on.
+func (e *Exporter) loadState(path string) error {
+	e.lock()
+	defer e.mu.Unlock()
+
+	e.stateFile = path
+
+	b, err := ioutil.ReadFile(path)
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var state persistedState
+
+	if err := json.Unmarshal(b, &state); err != nil {
+		return err
+	}
+
+	e.mergeState(&state, false)
+
+	return nil
+}
+
+// mergeState catches the counters up with those in state. The estimated consumption rate is only
+// taken from a live peer's state, since it goes stale quickly, and the remaining requests are only
+// taken from it if it polled Docker Hub more recently. The caller must hold e.mu.
+func (e *Exporter) mergeState(state *persistedState, live bool) {
+	for _, t := range e.targets {
+		saved, ok := state.Targets[t.repository]
+
+		if !ok {
+			continue
+		}
+
+		if saved.LastRemaining != nil && !t.hasRemaining {
+			t.hasRemaining = true
+			t.lastRemaining = *saved.LastRemaining
+		}
+
+		if live && saved.LastRemaining != nil && saved.LastRemainingAt != nil && saved.LastRemainingAt.After(t.lastRemainingAt) {
+			t.lastRemaining = *saved.LastRemaining
+			t.lastRemainingAt = *saved.LastRemainingAt
+			t.burnRate = saved.BurnRate
+			e.burnRate.WithLabelValues(t.repository).Set(t.burnRate)
+		}
+
+		if saved.PullsConsumed > t.pullsConsumed {
+			e.pullsConsumed.WithLabelValues(t.repository).Add(saved.PullsConsumed - t.pullsConsumed)
+			t.pullsConsumed = saved.PullsConsumed
+		}
+
+		for hours, created := range saved.ConsumedCreated {
+			if _, ok := t.consumedCreated[hours]; !ok {
+				t.consumedCreated[hours] = created
+				e.consumedCreated.WithLabelValues(t.repository, hours).Set(float64(created.Unix()))
+			}
+
+			if saved.Consumed[hours] > t.consumed[hours] {
+				e.consumed.WithLabelValues(t.repository, hours).Add(saved.Consumed[hours] - t.consumed[hours])
+				t.consumed[hours] = saved.Consumed[hours]
+			}
+		}
+	}
+}
+
+// snapshotState returns the state, for saving or serving to a standby. The caller must hold e.mu.
+func (e *Exporter) snapshotState() *persistedState {
+	state := &persistedState{Targets: map[string]*persistedTarget{}}
+
+	for _, t := range e.targets {
+		saved := &persistedTarget{
+			BurnRate:        t.burnRate,
+			PullsConsumed:   t.pullsConsumed,
+			Consumed:        t.consumed,
+			ConsumedCreated: t.consumedCreated,
+		}
+
+		if t.hasRemaining {
+			remaining := t.lastRemaining
+			saved.LastRemaining = &remaining
+		}
+
+		if !t.lastRemainingAt.IsZero() {
+			at := t.lastRemainingAt
+			saved.LastRemainingAt = &at
+		}
+
+		state.Targets[t.repository] = saved
+	}
+
+	return state
+}
+
+// saveState writes the state to e.stateFile. It replaces the file rather than overwriting it, so
+// that a crash can't leave it half written. The caller must hold e.mu.
+func (e *Exporter) saveState() error {
+	b, err := json.Marshal(e.snapshotState())
+
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(e.stateFile), filepath.Base(e.stateFile))
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), e.stateFile)
+}
+
+// historyHandler serves the state, so that a standby can keep its derived counters in step with
+// this exporter's. See standby.go.
+func historyHandler(e *Exporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		e.rlock()
+		defer e.mu.RUnlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(e.snapshotState())
+	}
+}
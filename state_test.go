@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDerivedCountersSurviveRestarts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	authServer := httptest.NewServer(handler(&mockResponse{
+		response: authResponseBody(),
+	}))
+	defer authServer.Close()
+
+	remaining := 0
+	rateLimitServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("RateLimit-Limit", "100;w=21600")
+		w.Header().Set("RateLimit-Remaining", fmt.Sprintf("%d;w=21600", remaining))
+	}))
+	defer rateLimitServer.Close()
+
+	stateFile := filepath.Join(dir, "state.json")
+	started, _ := time.Parse(time.RFC3339, "2020-11-16T10:00:00Z")
+	hours, _ := parseBusinessHours("09:00-17:00", "mon,tue,wed,thu,fri", "UTC")
+
+	newExporter := func() *Exporter {
+		e := NewExporter(authServer.URL, rateLimitServer.URL, []string{defaultRepository}, nil)
+		e.businessHours = hours
+
+		if err := e.loadState(stateFile); err != nil {
+			t.Fatal(err)
+		}
+
+		return e
+	}
+
+	before := newExporter()
+	for i, r := range []int{90, 80} {
+		remaining = r
+		before.scrape(context.Background(), before.targets[0], started.Add(time.Duration(i)*time.Minute))
+	}
+
+	after := newExporter()
+	remaining = 75
+	after.scrape(context.Background(), after.targets[0], started.Add(time.Hour))
+
+	if consumed := testutil.ToFloat64(after.consumed.WithLabelValues(defaultRepository, hoursBusiness)); consumed != 15 {
+		t.Errorf("Expected consumption to carry on from 10 to 15, got %v", consumed)
+	}
+
+	if pulls := testutil.ToFloat64(after.pullsConsumed.WithLabelValues(defaultRepository)); pulls != 15 {
+		t.Errorf("Expected pulls consumed to carry on from 10 to 15, got %v", pulls)
+	}
+
+	if created := testutil.ToFloat64(after.consumedCreated.WithLabelValues(defaultRepository, hoursBusiness)); created != float64(started.Unix()) {
+		t.Errorf("Expected created time to be kept as %v, got %v", started.Unix(), created)
+	}
+}
+
+func TestMissingStateFileIsIgnored(t *testing.T) {
+	e := NewExporter("http://localhost:0", "http://localhost:0", []string{defaultRepository}, nil)
+
+	if err := e.loadState(filepath.Join(os.TempDir(), "does-not-exist", "state.json")); err != nil {
+		t.Fatalf("Expected a missing state file to be ignored: %v", err)
+	}
+}
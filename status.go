@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rateLimitStatus is what /api/v1/ratelimit says about a target, as of the last poll of Docker Hub.
+type rateLimitStatus struct {
+	Repository    string     `json:"repository"`
+	Limit         float64    `json:"limit"`
+	Remaining     float64    `json:"remaining"`
+	WindowSeconds float64    `json:"window_seconds,omitempty"`
+	SourceIP      string     `json:"source_ip,omitempty"`
+	TokenExpiry   *time.Time `json:"token_expiry,omitempty"`
+	LastScrape    *time.Time `json:"last_scrape,omitempty"`
+	LastSuccess   *time.Time `json:"last_success,omitempty"`
+}
+
+// rateLimitHandler serves the rate limit status of each of e's targets as JSON. It doesn't poll
+// Docker Hub itself, so it can't be used to use up the rate limit. With ?source_ip=<address> only
+// the targets whose requests Docker Hub last counted against that address are served.
+func rateLimitHandler(e *Exporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		statuses := e.status()
+
+		if source := r.URL.Query().Get("source_ip"); source != "" {
+			ip := net.ParseIP(source)
+
+			if ip == nil {
+				http.Error(w, fmt.Sprintf("source_ip %q isn't an IP address", source), http.StatusBadRequest)
+				return
+			}
+
+			statuses = statusesFromSource(statuses, ip)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(statuses)
+	}
+}
+
+// statusesFromSource returns the statuses of the targets last counted against ip.
+func statusesFromSource(statuses []rateLimitStatus, ip net.IP) []rateLimitStatus {
+	matching := []rateLimitStatus{}
+
+	for _, status := range statuses {
+		if ip.Equal(net.ParseIP(status.SourceIP)) {
+			matching = append(matching, status)
+		}
+	}
+
+	return matching
+}
+
+func (e *Exporter) status() []rateLimitStatus {
+	e.rlock()
+	defer e.mu.RUnlock()
+
+	statuses := make([]rateLimitStatus, 0, len(e.targets))
+
+	for _, t := range e.targets {
+		status := rateLimitStatus{
+			Repository:    t.repository,
+			Limit:         t.lastLimit,
+			Remaining:     t.lastRemaining,
+			WindowSeconds: t.window.Seconds(),
+			SourceIP:      t.sourceIP,
+			LastScrape:    optionalTime(t.lastScrape),
+			LastSuccess:   optionalTime(t.lastSuccess),
+		}
+
+		if t.authToken != nil {
+			status.TokenExpiry = optionalTime(t.authToken.roughExpiry())
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+// parseWindow takes the header value 76;w=21600 (76 per 6 hours) and extracts the window, or zero
+// if there isn't one.
+func parseWindow(s string) time.Duration {
+	for _, param := range strings.Split(s, ";")[1:] {
+		param = strings.TrimSpace(param)
+
+		if !strings.HasPrefix(param, "w=") {
+			continue
+		}
+
+		if seconds, err := strconv.Atoi(param[2:]); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	return 0
+}
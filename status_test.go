@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+)
+
+func TestRateLimitStatusIsServedAsJSON(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	hub.SetRateLimit(100, 76)
+	hub.SetSource("192.0.2.1")
+
+	now := time.Date(2020, 11, 16, 10, 0, 0, 0, time.UTC)
+	exporter := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository, "library/alpine"}, nil)
+	exporter.scrape(context.Background(), exporter.targets[0], now)
+
+	w := httptest.NewRecorder()
+	rateLimitHandler(exporter)(w, httptest.NewRequest("GET", "/api/v1/ratelimit", nil))
+
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected JSON, got %s", contentType)
+	}
+
+	var statuses []rateLimitStatus
+	if err := json.NewDecoder(w.Body).Decode(&statuses); err != nil {
+		t.Fatal(err)
+	}
+
+	expiry := exporter.targets[0].authToken.roughExpiry()
+	expected := []rateLimitStatus{
+		{
+			Repository:    defaultRepository,
+			Limit:         100,
+			Remaining:     76,
+			WindowSeconds: 21600,
+			SourceIP:      "192.0.2.1",
+			TokenExpiry:   &expiry,
+			LastScrape:    &now,
+			LastSuccess:   &now,
+		},
+		{Repository: "library/alpine"},
+	}
+
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, statuses)
+	}
+}
+
+func TestRateLimitStatusCanBeFilteredBySourceIP(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	exporter := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository, "library/alpine"}, nil)
+
+	hub.SetSource("2001:db8::1")
+	exporter.scrape(context.Background(), exporter.targets[0], time.Now())
+
+	hub.SetSource("192.0.2.1")
+	exporter.scrape(context.Background(), exporter.targets[1], time.Now())
+
+	for _, c := range []struct {
+		query    string
+		code     int
+		expected []string
+	}{
+		{"?source_ip=2001:db8:0::1", http.StatusOK, []string{defaultRepository}},
+		{"?source_ip=192.0.2.1", http.StatusOK, []string{"library/alpine"}},
+		{"?source_ip=192.0.2.2", http.StatusOK, []string{}},
+		{"?source_ip=egress", http.StatusBadRequest, nil},
+	} {
+		w := httptest.NewRecorder()
+		rateLimitHandler(exporter)(w, httptest.NewRequest("GET", "/api/v1/ratelimit"+c.query, nil))
+
+		if w.Code != c.code {
+			t.Errorf("Expected %d for %s, got %d", c.code, c.query, w.Code)
+			continue
+		}
+
+		if c.code != http.StatusOK {
+			continue
+		}
+
+		var statuses []rateLimitStatus
+		if err := json.NewDecoder(w.Body).Decode(&statuses); err != nil {
+			t.Fatal(err)
+		}
+
+		repositories := []string{}
+		for _, status := range statuses {
+			repositories = append(repositories, status.Repository)
+		}
+
+		if !reflect.DeepEqual(repositories, c.expected) {
+			t.Errorf("Expected %v for %s, got %v", c.expected, c.query, repositories)
+		}
+	}
+}
+
+func TestWindowIsParsedFromTheHeader(t *testing.T) {
+	for header, expected := range map[string]time.Duration{
+		"100;w=21600":   6 * time.Hour,
+		"100; w=3600":   time.Hour,
+		"100":           0,
+		"100;m21600":    0,
+		"100;w=unknown": 0,
+	} {
+		if window := parseWindow(header); window != expected {
+			t.Errorf("Expected %v for %q, got %v", expected, header, window)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The component statuses of a Statuspage status page, which Docker's is.
+var statusPageStatuses = []string{"operational", "degraded_performance", "partial_outage", "major_outage", "under_maintenance"}
+
+// statusPageCollector exports the status of each component of Docker's status page, from its
+// Statuspage components API, so that dashboards can tell a Docker Hub incident from a problem
+// with the exporter's own credentials. It polls whenever it's collected, like the Exporter.
+type statusPageCollector struct {
+	url    string
+	client *http.Client
+
+	mu sync.Mutex // polls one at a time
+
+	up, status *prometheus.Desc
+}
+
+func newStatusPageCollector(statusURL string, client *http.Client) *statusPageCollector {
+	return &statusPageCollector{
+		url:    statusURL,
+		client: client,
+
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "service_status", "up"),
+			"Whether the last poll of Docker's status page succeeded (1) or not (0).",
+			nil, nil),
+		status: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "service", "status"),
+			"Whether the component of Docker's services is in the status (1) or not (0), according to Docker's status page.",
+			[]string{"component", "status"}, nil),
+	}
+}
+
+// Describe describes the status page metrics. It implements prometheus.Collector.
+func (s *statusPageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.up
+	ch <- s.status
+}
+
+// Collect polls the status page and delivers its metrics. It implements prometheus.Collector.
+func (s *statusPageCollector) Collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	components, err := s.fetchComponents(context.Background())
+
+	if err != nil {
+		fmt.Printf("Unable to poll Docker's status page: %v\n", err)
+		ch <- prometheus.MustNewConstMetric(s.up, prometheus.GaugeValue, 0)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(s.up, prometheus.GaugeValue, 1)
+
+	for _, c := range components {
+		// Groups only summarise their components
+		if c.Group {
+			continue
+		}
+
+		for _, status := range statusPageStatuses {
+			value := 0.0
+			if c.Status == status {
+				value = 1
+			}
+
+			ch <- prometheus.MustNewConstMetric(s.status, prometheus.GaugeValue, value, c.Name, status)
+		}
+	}
+}
+
+// statusPageComponent is the part of a component in the Statuspage components API which is
+// exported.
+type statusPageComponent struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Group  bool   `json:"group"`
+}
+
+func (s *statusPageCollector) fetchComponents(ctx context.Context) ([]statusPageComponent, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.url, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	res, err := fetchHTTP(ctx, s.client, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeResponse(res.Body)
+
+	var page struct {
+		Components []statusPageComponent `json:"components"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&page); err != nil {
+		return nil, &scrapeError{reason: failureReasonParse, err: err}
+	}
+
+	return page.Components, nil
+}
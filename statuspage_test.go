@@ -0,0 +1,46 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestStatusPageComponentsAreExported(t *testing.T) {
+	status := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"components": [
+			{"name": "Docker Hub", "status": "partial_outage", "group": true},
+			{"name": "Docker Hub Registry", "status": "partial_outage", "group": false},
+			{"name": "Docker Hub Web Services", "status": "operational"}
+		]}`))
+	}))
+	defer status.Close()
+
+	expected := `
+# HELP dockerhub_service_status Whether the component of Docker's services is in the status (1) or not (0), according to Docker's status page.
+# TYPE dockerhub_service_status gauge
+dockerhub_service_status{component="Docker Hub Registry",status="degraded_performance"} 0
+dockerhub_service_status{component="Docker Hub Registry",status="major_outage"} 0
+dockerhub_service_status{component="Docker Hub Registry",status="operational"} 0
+dockerhub_service_status{component="Docker Hub Registry",status="partial_outage"} 1
+dockerhub_service_status{component="Docker Hub Registry",status="under_maintenance"} 0
+dockerhub_service_status{component="Docker Hub Web Services",status="degraded_performance"} 0
+dockerhub_service_status{component="Docker Hub Web Services",status="major_outage"} 0
+dockerhub_service_status{component="Docker Hub Web Services",status="operational"} 1
+dockerhub_service_status{component="Docker Hub Web Services",status="partial_outage"} 0
+dockerhub_service_status{component="Docker Hub Web Services",status="under_maintenance"} 0
+# HELP dockerhub_service_status_up Whether the last poll of Docker's status page succeeded (1) or not (0).
+# TYPE dockerhub_service_status_up gauge
+dockerhub_service_status_up 1
+`
+
+	if err := testutil.CollectAndCompare(newStatusPageCollector(status.URL, nil), strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+}
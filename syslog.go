@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Syslog severities, from RFC 5424
+const (
+	severityError   = 3
+	severityWarning = 4
+	severityNotice  = 5
+)
+
+// Names of the events sent to syslog, used as the MSGID
+const (
+	eventStart               = "start"
+	eventPollFailing         = "poll-failing"
+	eventPollRecovered       = "poll-recovered"
+	eventCredentialsRejected = "credentials-rejected"
+	eventAlert               = "alert"
+	eventCircuitOpened       = "circuit-opened"
+	eventCircuitClosed       = "circuit-closed"
+)
+
+const (
+	syslogFacilityDaemon = 3
+	syslogAppName        = "dockerhub_exporter"
+	syslogWriteTimeout   = 5 * time.Second
+
+	// The SD-ID for the event's details. 32473 is the enterprise number reserved for examples,
+	// which is what RFC 5424 suggests for private use.
+	syslogStructuredDataID = "dockerhub@32473"
+)
+
+// syslogWriter sends lifecycle and alert events to a syslog server as RFC 5424 messages, over UDP,
+// TCP or TLS. Messages over TCP and TLS are framed with octet counting, from RFC 6587. A nil
+// *syslogWriter sends nothing, so that callers don't need to check whether it's turned on.
+type syslogWriter struct {
+	network   string
+	address   string
+	tlsConfig *tls.Config
+	hostname  string
+
+	mu   sync.Mutex
+	conn net.Conn
+
+	failures prometheus.Counter
+}
+
+// newSyslogWriter returns a syslogWriter for address, which is udp://, tcp:// or tls:// followed
+// by host:port. For TLS, the server's certificate is checked against caFile, if it's given, or
+// the system's roots.
+func newSyslogWriter(address string, caFile string) (*syslogWriter, error) {
+	u, err := url.Parse(address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "udp" && u.Scheme != "tcp" && u.Scheme != "tls" {
+		return nil, fmt.Errorf("syslog address %q should start with udp://, tcp:// or tls://", address)
+	}
+
+	if _, _, err := net.SplitHostPort(u.Host); err != nil {
+		return nil, fmt.Errorf("syslog address %q should have a host and port: %w", address, err)
+	}
+
+	w := &syslogWriter{
+		network: u.Scheme,
+		address: u.Host,
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exporter_syslog_failures_total",
+			Help:      "Number of errors while sending events to syslog.",
+		}),
+	}
+
+	if w.hostname, err = os.Hostname(); err != nil {
+		w.hostname = "-"
+	}
+
+	if u.Scheme == "tls" {
+		w.network = "tcp"
+		w.tlsConfig = &tls.Config{ServerName: u.Hostname()}
+
+		if caFile != "" {
+			pem, err := ioutil.ReadFile(caFile)
+
+			if err != nil {
+				return nil, err
+			}
+
+			w.tlsConfig.RootCAs = x509.NewCertPool()
+			if !w.tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in %s", caFile)
+			}
+		}
+	}
+
+	return w, nil
+}
+
+// event sends msg to syslog, with the given severity and MSGID, and params as structured data.
+// params are pairs of names and values. Failures are counted rather than returned, since there's
+// nothing the caller can do about them.
+func (w *syslogWriter) event(severity int, msgID string, msg string, params ...string) {
+	if w == nil {
+		return
+	}
+
+	if err := w.send(w.format(time.Now(), severity, msgID, msg, params...)); err != nil {
+		fmt.Printf("syslog: %+v\n", err)
+		w.failures.Inc()
+	}
+}
+
+func (w *syslogWriter) format(now time.Time, severity int, msgID string, msg string, params ...string) string {
+	structuredData := "-"
+
+	if len(params) > 0 {
+		var b strings.Builder
+		b.WriteString("[" + syslogStructuredDataID)
+
+		for i := 0; i+1 < len(params); i += 2 {
+			b.WriteString(" " + params[i] + `="` + escapeParamValue(params[i+1]) + `"`)
+		}
+
+		b.WriteString("]")
+		structuredData = b.String()
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s",
+		syslogFacilityDaemon*8+severity,
+		now.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		w.hostname,
+		syslogAppName,
+		os.Getpid(),
+		msgID,
+		structuredData,
+		msg)
+}
+
+// escapeParamValue escapes the characters which RFC 5424 doesn't allow in a PARAM-VALUE.
+func escapeParamValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(s)
+}
+
+// send writes message, connecting first if need be. After a failure, the connection is dropped,
+// so that the next event reconnects.
+func (w *syslogWriter) send(message string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		conn, err := w.dial()
+
+		if err != nil {
+			return err
+		}
+
+		w.conn = conn
+	}
+
+	if w.network == "tcp" {
+		message = strconv.Itoa(len(message)) + " " + message
+	}
+
+	_ = w.conn.SetWriteDeadline(time.Now().Add(syslogWriteTimeout))
+
+	if _, err := w.conn.Write([]byte(message)); err != nil {
+		w.conn.Close()
+		w.conn = nil
+		return err
+	}
+
+	return nil
+}
+
+func (w *syslogWriter) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: syslogWriteTimeout}
+
+	if w.tlsConfig != nil {
+		return tls.DialWithDialer(dialer, w.network, w.address, w.tlsConfig)
+	}
+
+	return dialer.Dial(w.network, w.address)
+}
+
+// logPollFailing sends an event when polling Docker Hub about t starts failing, which is an error
+// if the credentials were rejected, since that needs someone to fix them.
+func (e *Exporter) logPollFailing(t *target, err error) {
+	reason := failureReason(err)
+
+	if reason == failureReasonAuth {
+		username := ""
+		if e.credentials != nil {
+			username = e.credentials.username
+		}
+
+		e.events.event(severityError, eventCredentialsRejected, "Docker Hub rejected the credentials: "+err.Error(),
+			"repository", t.repository, "username", username)
+		return
+	}
+
+	e.events.event(severityWarning, eventPollFailing, "Polling Docker Hub about "+t.repository+" is failing: "+err.Error(),
+		"repository", t.repository, "reason", reason)
+}
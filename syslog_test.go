@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+)
+
+func TestSyslogMessagesAreRFC5424(t *testing.T) {
+	w := &syslogWriter{hostname: "exporter-1"}
+	now := time.Date(2020, 11, 16, 10, 0, 0, 0, time.UTC)
+
+	got := w.format(now, severityError, eventCredentialsRejected, "Docker Hub rejected the credentials",
+		"repository", defaultRepository, "username", `some"one]`)
+
+	expected := regexp.MustCompile(`^<27>1 2020-11-16T10:00:00.000000Z exporter-1 dockerhub_exporter \d+ credentials-rejected ` +
+		regexp.QuoteMeta(`[dockerhub@32473 repository="ratelimitpreview/test" username="some\"one\]"] Docker Hub rejected the credentials`) + `$`)
+
+	if !expected.MatchString(got) {
+		t.Errorf("Unexpected message %q", got)
+	}
+
+	if got := w.format(now, severityNotice, eventStart, "Starting"); !strings.Contains(got, " start - Starting") {
+		t.Errorf("Expected nil structured data without params, got %q", got)
+	}
+}
+
+func TestSyslogEventsAreSentOverUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w, err := newSyslogWriter("udp://"+conn.LocalAddr().String(), "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.event(severityNotice, eventStart, "Starting")
+
+	buf := make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := string(buf[:n]); !strings.HasPrefix(got, "<29>1 ") || !strings.HasSuffix(got, " start - Starting") {
+		t.Errorf("Unexpected datagram %q", got)
+	}
+}
+
+func TestRejectedCredentialsAreSentOverTCPWithOctetCounting(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		length, _ := r.ReadString(' ')
+		n, _ := strconv.Atoi(strings.TrimSpace(length))
+		message := make([]byte, n)
+		_, _ = r.Read(message)
+		received <- string(message)
+	}()
+
+	hub := registrytest.NewServer()
+	defer hub.Close()
+	hub.SetCredentials("username", "password")
+
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, &credentials{username: "username", passphrase: "wrong"})
+
+	if e.events, err = newSyslogWriter("tcp://"+listener.Addr().String(), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	e.scrape(context.Background(), e.targets[0], time.Now())
+
+	select {
+	case message := <-received:
+		if !strings.HasPrefix(message, "<27>1 ") || !strings.Contains(message, ` credentials-rejected [dockerhub@32473 repository="ratelimitpreview/test" username="username"] `) {
+			t.Errorf("Unexpected message %q", message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a credentials-rejected event")
+	}
+}
+
+func TestSyslogAddressMustHaveAKnownScheme(t *testing.T) {
+	for _, address := range []string{"localhost:514", "http://localhost:514", "udp://localhost"} {
+		if _, err := newSyslogWriter(address, ""); err == nil {
+			t.Errorf("Expected %q to be rejected", address)
+		}
+	}
+}
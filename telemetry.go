@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/prometheus/common/version"
+)
+
+const defaultTelemetryInterval = 24 * time.Hour
+
+// telemetryReport is all that the telemetry ping sends: which build is running, and which flags
+// and features it uses. Only the names of the flags are sent, never their values, so nothing about
+// the repositories, credentials or network gets out.
+type telemetryReport struct {
+	Instance  string   `json:"instance"` // random, and new each time the exporter starts
+	Version   string   `json:"version"`
+	Revision  string   `json:"revision"`
+	GoVersion string   `json:"go_version"`
+	Platform  string   `json:"platform"`
+	Flags     []string `json:"flags"`
+	Features  []string `json:"features"`
+}
+
+// telemetry pings -telemetry-url with a telemetryReport, so that whoever runs a fleet of exporters
+// can see which features it relies on before an upgrade. It's off unless -telemetry-url is set.
+type telemetry struct {
+	url    string
+	client *http.Client
+	report telemetryReport
+}
+
+func newTelemetry(url string, client *http.Client, flags []string, f features) *telemetry {
+	var instance [8]byte
+	_, _ = rand.Read(instance[:])
+
+	return &telemetry{
+		url:    url,
+		client: client,
+		report: telemetryReport{
+			Instance:  hex.EncodeToString(instance[:]),
+			Version:   version.Version,
+			Revision:  version.Revision,
+			GoVersion: runtime.Version(),
+			Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+			Flags:     flags,
+			Features:  f.names(),
+		},
+	}
+}
+
+// setFlags returns the names of the flags given on the command line, sorted.
+func setFlags(flags *flag.FlagSet) []string {
+	names := []string{}
+
+	flags.Visit(func(f *flag.Flag) {
+		names = append(names, f.Name)
+	})
+
+	sort.Strings(names)
+
+	return names
+}
+
+// run pings straight away, and then every interval, forever.
+func (t *telemetry) run(interval time.Duration) {
+	t.ping()
+
+	for range time.Tick(interval) {
+		t.ping()
+	}
+}
+
+func (t *telemetry) ping() {
+	if err := t.send(); err != nil {
+		fmt.Printf("Unable to send telemetry to %s: %v\n", t.url, err)
+	}
+}
+
+// send posts the report to t.url.
+func (t *telemetry) send() error {
+	body, err := json.Marshal(t.report)
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", t.url, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := fetchHTTP(context.Background(), t.client, req)
+
+	if err != nil {
+		return err
+	}
+
+	closeResponse(res.Body)
+
+	return nil
+}
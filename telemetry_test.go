@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTelemetryOnlySendsTheNamesOfTheFlags(t *testing.T) {
+	var got telemetryReport
+	var raw []byte
+
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ = ioutil.ReadAll(r.Body)
+		_ = json.Unmarshal(raw, &got)
+	}))
+	defer collector.Close()
+
+	flags := flag.NewFlagSet("dockerhub_exporter", flag.ContinueOnError)
+	flags.String("repository", "", "")
+	flags.String("source-address", "", "")
+	flags.String("peer", "", "")
+
+	if err := flags.Parse([]string{"-source-address", "192.0.2.10", "-repository", "example/private"}); err != nil {
+		t.Fatal(err)
+	}
+
+	telemetry := newTelemetry(collector.URL, nil, setFlags(flags), features{featurePrediction: true})
+
+	if err := telemetry.send(); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{"repository", "source-address"}; !reflect.DeepEqual(got.Flags, expected) {
+		t.Errorf("Expected flags %v, got %v", expected, got.Flags)
+	}
+
+	if expected := []string{featurePrediction}; !reflect.DeepEqual(got.Features, expected) {
+		t.Errorf("Expected features %v, got %v", expected, got.Features)
+	}
+
+	if got.Instance == "" || got.Platform == "" {
+		t.Errorf("Expected the instance and platform to be sent, got %+v", got)
+	}
+
+	for _, value := range []string{"192.0.2.10", "example/private"} {
+		if strings.Contains(string(raw), value) {
+			t.Errorf("Expected the value %q of a flag not to be sent, got %s", value, raw)
+		}
+	}
+}
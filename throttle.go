@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// clientLimiter rate limits the exporter's own endpoints with a token bucket per client IP, so that
+// a single misbehaving client can't use us to hammer Docker Hub. It advertises its state using the
+// same RateLimit-* headers that Docker Hub uses.
+type clientLimiter struct {
+	mu sync.Mutex
+
+	limit  int
+	window time.Duration
+	clock  func() time.Time
+
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newClientLimiter(limit int, window time.Duration) *clientLimiter {
+	return &clientLimiter{
+		limit:   limit,
+		window:  window,
+		clock:   time.Now,
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+// quota is the state of a client's bucket after a request.
+type quota struct {
+	allowed    bool
+	remaining  int
+	reset      time.Duration // until the bucket is full again
+	retryAfter time.Duration // until the next request would be allowed
+}
+
+// allow takes a token from the bucket for client, if there is one.
+func (l *clientLimiter) allow(client string) quota {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock()
+	l.forgetIdleClients(now)
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.limit), updated: now}
+		l.buckets[client] = b
+	}
+
+	refillRate := float64(l.limit) / l.window.Seconds()
+	b.tokens = math.Min(float64(l.limit), b.tokens+now.Sub(b.updated).Seconds()*refillRate)
+	b.updated = now
+
+	q := quota{allowed: b.tokens >= 1}
+	if q.allowed {
+		b.tokens--
+	}
+
+	q.remaining = int(b.tokens)
+	q.reset = time.Duration((float64(l.limit) - b.tokens) / refillRate * float64(time.Second))
+	q.retryAfter = time.Duration(math.Max(0, 1-b.tokens) / refillRate * float64(time.Second))
+
+	return q
+}
+
+// forgetIdleClients drops the buckets that have had time to fill back up, since they are no
+// different to a new bucket.
+func (l *clientLimiter) forgetIdleClients(now time.Time) {
+	for client, b := range l.buckets {
+		if now.Sub(b.updated) >= l.window {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// wrap returns a handler which rate limits requests to h.
+func (l *clientLimiter) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := l.allow(clientIP(r))
+		window := int(l.window.Seconds())
+
+		w.Header().Set("RateLimit-Limit", fmt.Sprintf("%d;w=%d", l.limit, window))
+		w.Header().Set("RateLimit-Remaining", fmt.Sprintf("%d;w=%d", q.remaining, window))
+		w.Header().Set("RateLimit-Reset", fmt.Sprintf("%.0f", math.Ceil(q.reset.Seconds())))
+
+		if !q.allowed {
+			w.Header().Set("Retry-After", fmt.Sprintf("%.0f", math.Ceil(q.retryAfter.Seconds())))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
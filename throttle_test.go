@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func limitedRequest(h http.Handler, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.RemoteAddr = remoteAddr
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestClientLimiterRejectsClientsOverTheLimit(t *testing.T) {
+	now := time.Now()
+	limiter := newClientLimiter(2, time.Minute)
+	limiter.clock = func() time.Time { return now }
+
+	h := limiter.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i, expected := range []string{"1;w=60", "0;w=60"} {
+		rec := limitedRequest(h, "10.0.0.1:1234")
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Request %d should have been allowed, got %d", i, rec.Code)
+		}
+
+		if remaining := rec.Header().Get("RateLimit-Remaining"); remaining != expected {
+			t.Errorf("Expected RateLimit-Remaining %q, got %q", expected, remaining)
+		}
+	}
+
+	rec := limitedRequest(h, "10.0.0.1:5678")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected request over the limit to be rejected, got %d", rec.Code)
+	}
+
+	if retryAfter := rec.Header().Get("Retry-After"); retryAfter != "30" {
+		t.Errorf("Expected Retry-After 30, got %q", retryAfter)
+	}
+
+	if rec := limitedRequest(h, "10.0.0.2:1234"); rec.Code != http.StatusOK {
+		t.Errorf("Other clients should not be limited, got %d", rec.Code)
+	}
+
+	now = now.Add(30 * time.Second)
+
+	if rec := limitedRequest(h, "10.0.0.1:1234"); rec.Code != http.StatusOK {
+		t.Errorf("Bucket should have refilled, got %d", rec.Code)
+	}
+}
+
+func TestClientLimiterForgetsIdleClients(t *testing.T) {
+	now := time.Now()
+	limiter := newClientLimiter(1, time.Minute)
+	limiter.clock = func() time.Time { return now }
+
+	limiter.allow("10.0.0.1")
+	now = now.Add(time.Minute)
+	limiter.allow("10.0.0.2")
+
+	if _, ok := limiter.buckets["10.0.0.1"]; ok {
+		t.Fatal("Expected idle client to have been forgotten")
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRequestTimeout    = 5 * time.Second
+	defaultServerReadTimeout = 30 * time.Second
+	defaultServerIdleTimeout = 2 * time.Minute
+)
+
+// serverTimeouts limit how long the exporter's own HTTP server waits on the clients scraping it.
+// There is no write timeout by default, since writing /metrics includes polling Docker Hub, which
+// has its own timeouts.
+type serverTimeouts struct {
+	read  time.Duration
+	write time.Duration
+	idle  time.Duration
+}
+
+// server returns an http.Server for the default mux which enforces the timeouts.
+func (s serverTimeouts) server() *http.Server {
+	return &http.Server{
+		ReadTimeout:  s.read,
+		WriteTimeout: s.write,
+		IdleTimeout:  s.idle,
+	}
+}
+
+// phaseTimeouts limit each phase of a request to Docker Hub separately, within the timeout for the
+// whole request, so that a slow resolver can't use it all up before the request has been sent.
+// Zero leaves a phase limited only by the timeout for the whole request.
+type phaseTimeouts struct {
+	dns             time.Duration
+	connect         time.Duration
+	tls             time.Duration
+	responseHeaders time.Duration
+}
+
+// transport returns an http.Transport which enforces the timeouts, and sets o on its connections.
+func (p phaseTimeouts) transport(o socketOptions) *http.Transport {
+	dialer := o.dialer()
+
+	if p.connect > 0 {
+		dialer.Timeout = p.connect
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = p.dialContext(dialer)
+
+	if o.family != "" {
+		dial := transport.DialContext
+		transport.DialContext = func(ctx context.Context, _ string, address string) (net.Conn, error) {
+			return dial(ctx, o.family, address)
+		}
+	}
+
+	if p.tls > 0 {
+		transport.TLSHandshakeTimeout = p.tls
+	}
+
+	transport.ResponseHeaderTimeout = p.responseHeaders
+
+	return transport
+}
+
+// dialContext resolves the address with its own deadline before connecting to it, since the
+// dialer's timeout would otherwise cover both.
+func (p phaseTimeouts) dialContext(dialer *net.Dialer) func(ctx context.Context, network string, address string) (net.Conn, error) {
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+
+		if err != nil || p.dns <= 0 || net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, address)
+		}
+
+		lookupCtx, cancel := context.WithTimeout(ctx, p.dns)
+		defer cancel()
+
+		// Only look up the addresses that can be dialled over network, eg for -ip-protocol
+		addrs, err := net.DefaultResolver.LookupIP(lookupCtx, "ip"+strings.TrimPrefix(network, "tcp"), host)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// Try each address in turn, like the dialer would have done
+		for _, addr := range addrs {
+			var conn net.Conn
+			conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(addr.String(), port))
+
+			if err == nil {
+				return conn, nil
+			}
+		}
+
+		return nil, err
+	}
+}
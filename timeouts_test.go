@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowResponseHeadersAreTimedOut(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: phaseTimeouts{responseHeaders: 20 * time.Millisecond}.transport(socketOptions{}),
+		Timeout:   time.Second,
+	}
+
+	_, err := client.Get(server.URL)
+
+	if reason := failureReason(err); reason != failureReasonTimeout {
+		t.Fatalf("Expected a timeout, got %q: %v", reason, err)
+	}
+}
+
+func TestHostnamesAreResolvedSeparately(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: phaseTimeouts{dns: time.Second, connect: time.Second}.transport(socketOptions{}),
+		Timeout:   time.Second,
+	}
+
+	res, err := client.Get(strings.Replace(server.URL, "127.0.0.1", "localhost", 1))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closeResponse(res.Body)
+}
+
+func TestTheExporterHasItsOwnClient(t *testing.T) {
+	args := lintArgs()
+	args.client = &http.Client{Timeout: time.Minute}
+
+	e := args.newExporter(nil)
+
+	if e.client != args.client {
+		t.Fatal("Expected the exporter to use the client from its arguments")
+	}
+
+	if NewExporter("", "", nil, nil).client == http.DefaultClient {
+		t.Error("Expected the exporter not to use http.DefaultClient")
+	}
+}
+
+func TestSlowClientsAreDisconnectedByTheServer(t *testing.T) {
+	listeners, err := listen([]string{"127.0.0.1:0"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := serverTimeouts{read: 50 * time.Millisecond}.server()
+	server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	go func() { _ = serve(server, listeners) }()
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", listeners[0].Addr().String())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Never finish sending the request's headers
+	if _, err := conn.Write([]byte("GET /metrics HTTP/1.1\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := bufio.NewReader(conn).ReadString('\n'); err == nil {
+		t.Fatal("Expected the server to close the connection")
+	} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Fatal("Expected the server to time out the request before the client did")
+	}
+}
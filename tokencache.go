@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// tokenCache keeps the tokens Docker Hub issued in a file, so that an exporter which restarts
+// often, eg a pod being rescheduled, can carry on with them rather than requesting new ones. Token
+// requests are rate limited by Docker Hub too. The file is only readable by its owner, and is
+// encrypted too if there's a key.
+type tokenCache struct {
+	path string
+	aead cipher.AEAD // nil to store the tokens in the clear
+
+	mu     sync.Mutex
+	tokens map[string]cachedToken // by repository
+}
+
+// cachedToken is a token, and who it was issued to so that it isn't reused with other credentials.
+type cachedToken struct {
+	Username string             `json:"username,omitempty"`
+	Token    *AuthTokenResponse `json:"token"`
+}
+
+// newTokenCache returns a cache of the tokens in path, encrypted with a key derived from key if it
+// isn't empty.
+func newTokenCache(path, key string) (*tokenCache, error) {
+	c := &tokenCache{path: path, tokens: map[string]cachedToken{}}
+
+	if key != "" {
+		sum := sha256.Sum256([]byte(key))
+		block, err := aes.NewCipher(sum[:])
+
+		if err != nil {
+			return nil, err
+		}
+
+		if c.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := ioutil.ReadFile(path)
+
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if c.aead != nil {
+		if b, err = c.open(b); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := json.Unmarshal(b, &c.tokens); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// get returns the cached token for repository, if it was issued to username.
+func (c *tokenCache) get(repository, username string) *AuthTokenResponse {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.tokens[repository]
+
+	if !ok || cached.Username != username {
+		return nil
+	}
+
+	return cached.Token
+}
+
+// put caches token for repository, issued to username, and saves the cache.
+func (c *tokenCache) put(repository, username string, token *AuthTokenResponse) error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.tokens[repository] = cachedToken{Username: username, Token: token}
+
+	b, err := json.Marshal(c.tokens)
+
+	if err != nil {
+		return err
+	}
+
+	if c.aead != nil {
+		if b, err = c.seal(b); err != nil {
+			return err
+		}
+	}
+
+	// Like saveState, replace the file so that a crash can't leave it half written. TempFile
+	// creates it readable only by its owner.
+	f, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path))
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), c.path)
+}
+
+// seal encrypts plaintext, prefixed with the nonce it was encrypted with.
+func (c *tokenCache) seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return c.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open decrypts what seal encrypted.
+func (c *tokenCache) open(sealed []byte) ([]byte, error) {
+	size := c.aead.NonceSize()
+
+	if len(sealed) < size {
+		return nil, errors.New("token cache is too short to have been encrypted")
+	}
+
+	return c.aead.Open(nil, sealed[:size], sealed[size:], nil)
+}
+
+// loadTokens gives e's targets the cached tokens which were issued to its credentials and haven't
+// expired yet.
+func (e *Exporter) loadTokens() {
+	e.lock()
+	defer e.mu.Unlock()
+
+	username := cachedUsername(e.credentials)
+
+	for _, t := range e.targets {
+		if token := e.tokenCache.get(t.repository, username); token != nil && token.isUsable(e.clock) {
+			t.authToken = token
+		}
+	}
+}
+
+// cachedUsername is who tokens requested with c are issued to, or empty for anonymous ones.
+func cachedUsername(c *credentials) string {
+	if c == nil {
+		return ""
+	}
+
+	return c.username
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+)
+
+func TestTokensAreReusedAcrossRestarts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, key := range []string{"", "secret"} {
+		hub := registrytest.NewServer()
+		defer hub.Close()
+
+		path := filepath.Join(dir, "tokens"+key+".json")
+
+		restart := func(c *credentials) *Exporter {
+			cache, err := newTokenCache(path, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, c)
+			e.tokenCache = cache
+			e.loadTokens()
+			e.scrape(context.Background(), e.targets[0], time.Now())
+
+			return e
+		}
+
+		first := restart(nil)
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if mode := info.Mode().Perm(); mode != 0600 {
+			t.Errorf("Expected the token cache to only be readable by its owner, got %v", mode)
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if encrypted := !bytes.Contains(b, []byte(first.targets[0].authToken.Token)); encrypted != (key != "") {
+			t.Errorf("Expected the token cache to be encrypted only with a key, got encrypted %v with key %q", encrypted, key)
+		}
+
+		restart(nil)
+
+		if requests := hub.TokenRequests(); requests != 1 {
+			t.Errorf("Expected the cached token to be reused after a restart, got %d token requests", requests)
+		}
+
+		restart(&credentials{username: "username", passphrase: "password"})
+
+		if requests := hub.TokenRequests(); requests != 2 {
+			t.Errorf("Expected a token for other credentials to be requested, got %d token requests", requests)
+		}
+	}
+}
+
+func TestTokenCacheNeedsTheKeyItWasEncryptedWith(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "tokens.json")
+
+	cache, err := newTokenCache(path, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cache.put(defaultRepository, "", &AuthTokenResponse{Token: "token", ExpiresIn: 300, IssuedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newTokenCache(path, "guess"); err == nil {
+		t.Error("Expected the token cache not to load with the wrong key")
+	}
+
+	if _, err := newTokenCache(path, ""); err == nil {
+		t.Error("Expected the token cache not to load without a key")
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// tokenGroup shares tokens between the exporters which poll with the same credentials, eg from
+// each -source-address, so that they don't each request the same token from Docker Hub. A request
+// for a token which another is already waiting for waits for that one, and a token which is still
+// usable is handed out again rather than requested. A nil *tokenGroup shares nothing.
+type tokenGroup struct {
+	mu     sync.Mutex
+	calls  map[string]*tokenCall
+	latest map[string]*AuthTokenResponse
+
+	shared prometheus.Counter
+}
+
+// tokenCall is a token request in progress, which other requests for the same token wait for.
+type tokenCall struct {
+	done  chan struct{}
+	token *AuthTokenResponse
+	err   error
+}
+
+func newTokenGroup() *tokenGroup {
+	return &tokenGroup{
+		calls:  map[string]*tokenCall{},
+		latest: map[string]*AuthTokenResponse{},
+		shared: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exporter_token_requests_shared_total",
+			Help:      "Number of tokens shared with another poll using the same credentials, rather than requested from Docker Hub.",
+		}),
+	}
+}
+
+// do returns the latest token for key if it's still usable, or waits for the request for it in
+// progress, or else requests it with fetch.
+func (g *tokenGroup) do(key string, now func() time.Time, fetch func() (*AuthTokenResponse, error)) (*AuthTokenResponse, error) {
+	if g == nil {
+		return fetch()
+	}
+
+	g.mu.Lock()
+
+	if token := g.latest[key]; token != nil && token.isUsable(now) {
+		g.mu.Unlock()
+		g.shared.Inc()
+		return token, nil
+	}
+
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-c.done
+
+		if c.err == nil {
+			g.shared.Inc()
+		}
+
+		return c.token, c.err
+	}
+
+	c := &tokenCall{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.token, c.err = fetch()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	if c.err == nil {
+		g.latest[key] = c.token
+	}
+	g.mu.Unlock()
+
+	close(c.done)
+
+	return c.token, c.err
+}
+
+// tokenKey identifies the token for t requested with c, which is the same for any exporter.
+func tokenKey(t *target, c *credentials) string {
+	if c == nil {
+		return t.authServerURL
+	}
+
+	return t.authServerURL + "\x00" + c.username + "\x00" + c.fingerprint()
+}
+
+// sharedToken gets a token for t with c, sharing it with the other exporters in e's token group.
+func (e *Exporter) sharedToken(ctx context.Context, t *target, c *credentials) (*string, error) {
+	token, err := e.tokens.do(tokenKey(t, c), e.clock, func() (*AuthTokenResponse, error) {
+		if t.authToken != nil {
+			e.tokenRefreshes.Inc()
+		}
+
+		if _, err := e.requestToken(ctx, t, c); err != nil {
+			return nil, err
+		}
+
+		return t.authToken, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	t.authToken = token
+
+	return &token.Token, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestConcurrentRequestsForATokenShareOne(t *testing.T) {
+	g := newTokenGroup()
+
+	var fetches int32
+	release := make(chan struct{})
+
+	fetch := func() (*AuthTokenResponse, error) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		return &AuthTokenResponse{Token: "token", ExpiresIn: 300, IssuedAt: time.Now()}, nil
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if token, err := g.do("key", time.Now, fetch); err != nil || token.Token != "token" {
+				t.Errorf("Expected the shared token, got %v: %v", token, err)
+			}
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if fetches != 1 {
+		t.Errorf("Expected one token request, got %d", fetches)
+	}
+
+	if shared := testutil.ToFloat64(g.shared); shared != 49 {
+		t.Errorf("Expected the token to be shared 49 times, got %v", shared)
+	}
+}
+
+func TestExportersWithTheSameCredentialsShareTokens(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	g := newTokenGroup()
+
+	newExporter := func(c *credentials) *Exporter {
+		e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, c)
+		e.tokens = g
+		e.scrape(context.Background(), e.targets[0], time.Now())
+
+		return e
+	}
+
+	c := &credentials{username: "username", passphrase: "password"}
+	newExporter(c)
+	newExporter(c)
+
+	if requests := hub.TokenRequests(); requests != 1 {
+		t.Errorf("Expected the second exporter to use the first's token, got %d token requests", requests)
+	}
+
+	newExporter(&credentials{username: "username", passphrase: "rotated"})
+	newExporter(nil)
+
+	if requests := hub.TokenRequests(); requests != 3 {
+		t.Errorf("Expected tokens for other credentials to be requested, got %d token requests", requests)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+// maxBufferedSpans bounds the memory used by spans waiting to be sent, if the collector is down.
+const maxBufferedSpans = 4096
+
+// tracer records a span for each phase of a scrape, so that slow scrapes can be broken down. A nil
+// *tracer records nothing.
+type tracer struct {
+	mu    sync.Mutex
+	spans []*span
+}
+
+// span times one phase of a scrape. A nil *span records nothing, so that the phases don't need to
+// check whether tracing is turned on.
+type span struct {
+	tracer *tracer
+
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+
+	name       string
+	client     bool // whether the span is a request to another service
+	start, end time.Time
+	attributes map[string]string
+	err        error
+}
+
+// start begins a new trace, with a root span called name.
+func (tr *tracer) start(name string) *span {
+	if tr == nil {
+		return nil
+	}
+
+	s := &span{tracer: tr, name: name, start: time.Now(), attributes: map[string]string{}}
+	_, _ = rand.Read(s.traceID[:])
+	_, _ = rand.Read(s.spanID[:])
+
+	return s
+}
+
+// take returns the finished spans, and forgets about them.
+func (tr *tracer) take() []*span {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	spans := tr.spans
+	tr.spans = nil
+
+	return spans
+}
+
+func (tr *tracer) record(s *span) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	if len(tr.spans) < maxBufferedSpans {
+		tr.spans = append(tr.spans, s)
+	}
+}
+
+// child begins a span called name within s.
+func (s *span) child(name string) *span {
+	if s == nil {
+		return nil
+	}
+
+	c := &span{tracer: s.tracer, traceID: s.traceID, parentID: s.spanID, name: name, start: time.Now(), attributes: map[string]string{}}
+	_, _ = rand.Read(c.spanID[:])
+
+	return c
+}
+
+// request begins a span within s for a request to another service.
+func (s *span) request(name string) *span {
+	c := s.child(name)
+
+	if c != nil {
+		c.client = true
+	}
+
+	return c
+}
+
+func (s *span) setAttribute(key, value string) {
+	if s != nil {
+		s.attributes[key] = value
+	}
+}
+
+// finish ends s, recording whether it failed.
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+
+	s.end = time.Now()
+	s.err = err
+	s.tracer.record(s)
+}
@@ -0,0 +1,8 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+// Embed the time zone database for -timezone, since the Docker image is built from scratch. The
+// minimal build relies on the host's instead.
+import _ "time/tzdata"
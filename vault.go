@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultVaultAuthMount = "kubernetes"
+
+// vaultSecret reads Docker Hub credentials from a secret in HashiCorp Vault, as its username and
+// password keys, logging in to Vault with the pod's Kubernetes service account. Like
+// kubernetesSecret, it talks to the HTTP API directly rather than taking on Vault's client.
+type vaultSecret struct {
+	addr      string
+	path      string
+	role      string
+	authMount string
+	jwtFile   string
+	client    *http.Client
+
+	token       string
+	renewable   bool
+	tokenIssued time.Time
+	tokenTTL    time.Duration
+}
+
+// newVaultSecret returns a vaultSecret for the secret at path, eg secret/data/dockerhub for a KV
+// version 2 secrets engine mounted at secret. The Vault server's certificate is checked against
+// caFile, if it's given, or the system's roots.
+func newVaultSecret(addr string, path string, role string, authMount string, caFile string) (*vaultSecret, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	}
+
+	client := &http.Client{Transport: transport, Timeout: 10 * time.Second}
+
+	return &vaultSecret{
+		addr:      strings.TrimSuffix(addr, "/"),
+		path:      strings.Trim(path, "/"),
+		role:      role,
+		authMount: strings.Trim(authMount, "/"),
+		jwtFile:   serviceAccountDir + "/token",
+		client:    client,
+	}, nil
+}
+
+func (v *vaultSecret) String() string {
+	return "Vault secret " + v.path
+}
+
+// read returns the Docker Hub credentials in the secret, and its version, logging in to Vault or
+// renewing the token first if needed.
+func (v *vaultSecret) read() (*credentials, string, error) {
+	if err := v.authenticate(); err != nil {
+		return nil, "", err
+	}
+
+	c, version, err := v.readSecret()
+
+	// The token may have been revoked, so log in again and have another go
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusForbidden {
+		v.token = ""
+
+		if err := v.authenticate(); err != nil {
+			return nil, "", err
+		}
+
+		return v.readSecret()
+	}
+
+	return c, version, err
+}
+
+func (v *vaultSecret) readSecret() (*credentials, string, error) {
+	var res struct {
+		Data map[string]interface{} `json:"data"`
+	}
+
+	if err := v.do("GET", v.path, nil, &res); err != nil {
+		return nil, "", fmt.Errorf("unable to read %s: %w", v, err)
+	}
+
+	data := res.Data
+	version := ""
+
+	// KV version 2 nests the secret's data, alongside its metadata
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if metadata, ok := data["metadata"].(map[string]interface{}); ok {
+			data = nested
+
+			if n, ok := metadata["version"].(float64); ok {
+				version = strconv.FormatFloat(n, 'f', -1, 64)
+			}
+		}
+	}
+
+	username, _ := data["username"].(string)
+	password, _ := data["password"].(string)
+
+	if username == "" || password == "" {
+		return nil, "", fmt.Errorf("%s should have a username and password", v)
+	}
+
+	c := &credentials{username: username, passphrase: password}
+
+	// KV version 1 doesn't version secrets, so changes are spotted from the credentials themselves
+	if version == "" {
+		version = c.fingerprint()
+	}
+
+	return c, version, nil
+}
+
+// authenticate makes sure there's a usable Vault token, renewing it once it is halfway to expiring
+// and logging in again if it can't be renewed.
+func (v *vaultSecret) authenticate() error {
+	if v.token != "" {
+		age := time.Since(v.tokenIssued)
+
+		if v.tokenTTL == 0 || age < v.tokenTTL/2 {
+			return nil
+		}
+
+		if v.renewable && age < v.tokenTTL {
+			if err := v.authRequest("auth/token/renew-self", nil); err == nil {
+				return nil
+			}
+		}
+	}
+
+	jwt, err := ioutil.ReadFile(v.jwtFile)
+
+	if err != nil {
+		return err
+	}
+
+	login := map[string]string{"role": v.role, "jwt": strings.TrimSpace(string(jwt))}
+	v.token = ""
+
+	if err := v.authRequest("auth/"+v.authMount+"/login", login); err != nil {
+		return fmt.Errorf("unable to log in to Vault as %s: %w", v.role, err)
+	}
+
+	return nil
+}
+
+// authRequest makes a login or renewal request, and keeps the token from the response.
+func (v *vaultSecret) authRequest(path string, body interface{}) error {
+	var res struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int    `json:"lease_duration"`
+			Renewable     bool   `json:"renewable"`
+		} `json:"auth"`
+	}
+
+	if err := v.do("POST", path, body, &res); err != nil {
+		return err
+	}
+
+	if res.Auth.ClientToken == "" {
+		return fmt.Errorf("no token in Vault's response")
+	}
+
+	v.token = res.Auth.ClientToken
+	v.renewable = res.Auth.Renewable
+	v.tokenIssued = time.Now()
+	v.tokenTTL = time.Duration(res.Auth.LeaseDuration) * time.Second
+
+	return nil
+}
+
+func (v *vaultSecret) do(method string, path string, body interface{}, res interface{}) error {
+	var payload []byte
+
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, v.addr+"/v1/"+path, bytes.NewReader(payload))
+
+	if err != nil {
+		return err
+	}
+
+	if v.token != "" {
+		req.Header.Set("X-Vault-Token", v.token)
+	}
+
+	r, err := v.client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer closeResponse(r.Body)
+
+	if r.StatusCode != http.StatusOK {
+		return &httpStatusError{StatusCode: r.StatusCode}
+	}
+
+	return json.NewDecoder(r.Body).Decode(res)
+}
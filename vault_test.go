@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// fakeVault is a Vault server with the Kubernetes auth method, and a KV version 2 secret at
+// secret/data/dockerhub.
+type fakeVault struct {
+	password string
+	version  int
+	logins   int
+	renewals int
+	revoked  bool
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := map[string]interface{}{
+		"auth": map[string]interface{}{"client_token": "vault-token", "lease_duration": 3600, "renewable": true},
+	}
+
+	switch r.URL.Path {
+	case "/v1/auth/kubernetes/login":
+		var login map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&login)
+
+		if login["role"] != "dockerhub-exporter" || login["jwt"] != "service-account-token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		f.logins++
+		f.revoked = false
+		_ = json.NewEncoder(w).Encode(auth)
+	case "/v1/auth/token/renew-self":
+		f.renewals++
+		_ = json.NewEncoder(w).Encode(auth)
+	case "/v1/secret/data/dockerhub":
+		if f.revoked || r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"data":     map[string]string{"username": "username", "password": f.password},
+				"metadata": map[string]interface{}{"version": f.version},
+			},
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestCredentialsAreReadFromVault(t *testing.T) {
+	vault := &fakeVault{password: "password", version: 1}
+	server := httptest.NewServer(vault)
+	defer server.Close()
+
+	token := tokenFile(t)
+	defer os.Remove(token)
+
+	secret, err := newVaultSecret(server.URL, "secret/data/dockerhub", "dockerhub-exporter", defaultVaultAuthMount, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret.jwtFile = token
+
+	c, version, err := secret.read()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *c != (credentials{username: "username", passphrase: "password"}) || version != "1" {
+		t.Fatalf("Unexpected credentials %+v at version %s", *c, version)
+	}
+
+	// Halfway through its lease, the token is renewed rather than logging in again
+	secret.tokenIssued = time.Now().Add(-45 * time.Minute)
+	vault.password, vault.version = "rotated", 2
+
+	c, version, err = secret.read()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.passphrase != "rotated" || version != "2" || vault.logins != 1 || vault.renewals != 1 {
+		t.Errorf("Expected the rotated credentials with a renewed token, got %+v at version %s after %d logins and %d renewals",
+			*c, version, vault.logins, vault.renewals)
+	}
+
+	// A revoked token is replaced by logging in again
+	vault.revoked = true
+
+	if _, _, err := secret.read(); err != nil || vault.logins != 2 {
+		t.Errorf("Expected to log in again, got %v after %d logins", err, vault.logins)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// webAuth protects the exporter's endpoints with basic auth or a static bearer token, for when
+// the port is reachable from a network which isn't fully trusted. The zero value protects nothing.
+type webAuth struct {
+	username, password string
+	token              string
+}
+
+// authorize adds the credentials, if there are any, to a request to an exporter that wraps its
+// handlers with the same webAuth.
+func (a webAuth) authorize(req *http.Request) {
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	} else if a.username != "" {
+		req.SetBasicAuth(a.username, a.password)
+	}
+}
+
+// wrap returns next, asking for the credentials first if there are any.
+func (a webAuth) wrap(next http.Handler) http.Handler {
+	if a.username == "" && a.token == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.token != "" {
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+a.token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="dockerhub_exporter"`)
+				http.Error(w, "Not authorized", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		username, password, _ := r.BasicAuth()
+
+		// Both are compared, whether or not the username matches, so as not to give that away
+		userOK := subtle.ConstantTimeCompare([]byte(username), []byte(a.username))
+		passOK := subtle.ConstantTimeCompare([]byte(password), []byte(a.password))
+
+		if userOK&passOK != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="dockerhub_exporter"`)
+			http.Error(w, "Not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebAuthProtectsTheEndpoints(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, test := range []struct {
+		auth     webAuth
+		setup    func(*http.Request)
+		expected int
+	}{
+		{webAuth{}, func(r *http.Request) {}, http.StatusOK},
+		{webAuth{username: "prometheus", password: "s3cret"}, func(r *http.Request) {}, http.StatusUnauthorized},
+		{webAuth{username: "prometheus", password: "s3cret"}, func(r *http.Request) { r.SetBasicAuth("prometheus", "wrong") }, http.StatusUnauthorized},
+		{webAuth{username: "prometheus", password: "s3cret"}, func(r *http.Request) { r.SetBasicAuth("prometheus", "s3cret") }, http.StatusOK},
+		{webAuth{token: "t0ken"}, func(r *http.Request) { r.SetBasicAuth("prometheus", "t0ken") }, http.StatusUnauthorized},
+		{webAuth{token: "t0ken"}, func(r *http.Request) { r.Header.Set("Authorization", "Bearer t0ken") }, http.StatusOK},
+	} {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		test.setup(req)
+		w := httptest.NewRecorder()
+
+		test.auth.wrap(ok).ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("Expected %d for %+v, got %d", test.expected, req.Header, w.Code)
+		}
+
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Error("Expected a WWW-Authenticate challenge")
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"time"
+)
+
+// lowRemainingFraction is how much of the limit is left when the remaining requests count as low,
+// for the time spent low in each window.
+const lowRemainingFraction = 0.1
+
+// windowStats are what has been seen of the rate limit since the current window started.
+type windowStats struct {
+	start        time.Time
+	consumed     float64
+	minRemaining float64
+	low          time.Duration
+}
+
+// observeWindow adds a freshly polled remaining to the stats for t's current window and, when the
+// window resets, exports the stats for the window which has just finished. A window resets when
+// the remaining requests go back up to the limit, or when it has lasted as long as the window in
+// the rate limit headers. The caller must call it before t.lastRemaining and t.lastRemainingAt are
+// updated.
+func (e *Exporter) observeWindow(t *target, now time.Time, limit float64, remaining float64) {
+	w := &t.currentWindow
+
+	if w.start.IsZero() {
+		*w = windowStats{start: now, minRemaining: remaining}
+		return
+	}
+
+	if t.hasRemaining {
+		if remaining < t.lastRemaining {
+			w.consumed += t.lastRemaining - remaining
+		}
+
+		// The time since the last poll counts as low if the remaining requests were low then
+		if !t.lastRemainingAt.IsZero() && now.After(t.lastRemainingAt) && t.lastRemaining < limit*lowRemainingFraction {
+			w.low += now.Sub(t.lastRemainingAt)
+		}
+	}
+
+	refilled := t.hasRemaining && t.lastRemaining < limit && remaining >= limit
+	elapsed := t.window > 0 && now.Sub(w.start) >= t.window
+
+	if !refilled && !elapsed {
+		if remaining < w.minRemaining {
+			w.minRemaining = remaining
+		}
+
+		return
+	}
+
+	e.windowConsumed.WithLabelValues(t.repository).Set(w.consumed)
+	e.windowMinRemaining.WithLabelValues(t.repository).Set(w.minRemaining)
+	e.windowLow.WithLabelValues(t.repository).Set(w.low.Seconds())
+	e.windowEnd.WithLabelValues(t.repository).Set(float64(now.Unix()))
+
+	*w = windowStats{start: now, minRemaining: remaining}
+}
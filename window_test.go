@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jabley/dockerhub_exporter/registrytest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestWindowIsSummarisedWhenItResets(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	hub.SetWindow(time.Hour)
+
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+	now := time.Date(2020, 11, 16, 10, 0, 0, 0, time.UTC)
+
+	for _, remaining := range []int{100, 95, 8, 5, 20, 50} {
+		hub.SetRateLimit(100, remaining)
+		e.scrape(context.Background(), e.targets[0], now)
+		now = now.Add(10 * time.Minute)
+	}
+
+	if testutil.CollectAndCount(e.windowConsumed) != 0 {
+		t.Fatal("Expected no summary before the window has reset")
+	}
+
+	hub.SetRateLimit(100, 60)
+	e.scrape(context.Background(), e.targets[0], now)
+
+	for _, c := range []struct {
+		name     string
+		value    float64
+		expected float64
+	}{
+		{"consumed", testutil.ToFloat64(e.windowConsumed.WithLabelValues(defaultRepository)), 95},
+		{"min remaining", testutil.ToFloat64(e.windowMinRemaining.WithLabelValues(defaultRepository)), 5},
+		{"low seconds", testutil.ToFloat64(e.windowLow.WithLabelValues(defaultRepository)), 20 * 60},
+		{"end", testutil.ToFloat64(e.windowEnd.WithLabelValues(defaultRepository)), float64(now.Unix())},
+	} {
+		if c.value != c.expected {
+			t.Errorf("Expected the window's %s to be %v, got %v", c.name, c.expected, c.value)
+		}
+	}
+}
+
+func TestWindowResetsWhenTheRemainingRequestsAreRefilled(t *testing.T) {
+	hub := registrytest.NewServer()
+	defer hub.Close()
+
+	e := NewExporter(hub.Auth.URL, hub.Registry.URL, []string{defaultRepository}, nil)
+	now := time.Date(2020, 11, 16, 10, 0, 0, 0, time.UTC)
+
+	for _, remaining := range []int{80, 70, 100, 90} {
+		hub.SetRateLimit(100, remaining)
+		e.scrape(context.Background(), e.targets[0], now)
+		now = now.Add(time.Minute)
+	}
+
+	if consumed := testutil.ToFloat64(e.windowConsumed.WithLabelValues(defaultRepository)); consumed != 10 {
+		t.Errorf("Expected 10 requests consumed in the window before the refill, got %v", consumed)
+	}
+
+	if end := testutil.ToFloat64(e.windowEnd.WithLabelValues(defaultRepository)); end != float64(now.Add(-2*time.Minute).Unix()) {
+		t.Errorf("Expected the window to end when the requests were refilled, got %v", end)
+	}
+}